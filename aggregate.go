@@ -31,12 +31,12 @@ func aggregate(newStocks []Stock, stockLastUpdates []StockLastUpdate) (*Aggregat
 	for _, stock := range newStocks {
 		lastUpdate, exist := lastUpdateMap[stock.Code]
 		if exist {
-			last, err := time.Parse("2006-01-02 15:04:05", lastUpdate)
+			last, err := time.Parse(dbTimeLayout, lastUpdate)
 			if err != nil {
 				return &res, err
 			}
 
-			updatedAt, err := time.Parse("2006-01-02T15:04:05", stock.LastUpdate)
+			updatedAt, err := time.Parse(apiTimeLayout, stock.LastUpdate)
 			if err != nil {
 				return &res, err
 			}
@@ -0,0 +1,166 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alertOps are the comparisons of alert conditions.
+var alertOps = map[string]func(v, threshold float64) bool{
+	">":  func(v, threshold float64) bool { return v > threshold },
+	">=": func(v, threshold float64) bool { return v >= threshold },
+	"<":  func(v, threshold float64) bool { return v < threshold },
+	"<=": func(v, threshold float64) bool { return v <= threshold },
+}
+
+// AlertRule alerts when the condition "Metric Op Threshold" of a code starts to hold,
+// e.g. "last > 9000", "one_day <= -0.05" or "rsi14 < 30". Triggered tells whether the condition
+// held at the last evaluation, so that the alert fires once per crossing.
+type AlertRule struct {
+	Id        int64
+	Code      string
+	Metric    string
+	Op        string
+	Threshold float64 `pg:",use_zero"`
+	Triggered bool    `pg:",use_zero"`
+	CreatedAt time.Time
+}
+
+// alert is a rule whose condition started to hold for a stock.
+type alert struct {
+	rule  AlertRule
+	stock Stock
+}
+
+// parseAlertCondition parses a condition of the form "metric op threshold", e.g. "last > 9000".
+func parseAlertCondition(s string) (metric, op string, threshold float64, err error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return "", "", 0, fmt.Errorf("invalid alert condition %q, expect \"metric op threshold\"", s)
+	}
+
+	metric, op = fields[0], fields[1]
+	if _, exist := metrics[metric]; !exist {
+		return "", "", 0, fmt.Errorf("unknown alert metric %q, expect one of %s", metric, metricNames())
+	}
+	if _, exist := alertOps[op]; !exist {
+		return "", "", 0, fmt.Errorf("invalid alert operator %q, expect one of >, >=, < or <=", op)
+	}
+	if threshold, err = strconv.ParseFloat(fields[2], 64); err != nil {
+		return "", "", 0, fmt.Errorf("invalid alert threshold %q", fields[2])
+	}
+
+	return metric, op, threshold, nil
+}
+
+func (r AlertRule) condition() string {
+	return fmt.Sprintf("%s %s %g", r.Metric, r.Op, r.Threshold)
+}
+
+// evaluateAlerts evaluates the rules of the codes in stocks and returns the alerts that fire,
+// and the rules whose Triggered state changed. A rule is not evaluated while its metric is unavailable.
+func evaluateAlerts(stocks []Stock, rules []AlertRule) (alerts []alert, changed []AlertRule) {
+	byCode := make(map[string]Stock, len(stocks))
+	for _, s := range stocks {
+		byCode[s.Code] = s
+	}
+
+	for _, r := range rules {
+		s, exist := byCode[r.Code]
+		metric, known := metrics[r.Metric]
+		op, valid := alertOps[r.Op]
+		if !exist || !known || !valid || !hasMetric(s, r.Metric) {
+			continue
+		}
+
+		holds := op(metric(s), r.Threshold)
+		if holds == r.Triggered {
+			continue
+		}
+		r.Triggered = holds
+		changed = append(changed, r)
+		if holds {
+			alerts = append(alerts, alert{r, s})
+		}
+	}
+
+	return alerts, changed
+}
+
+// checkAlerts evaluates the stored rules against stocks and stores the changed states.
+func checkAlerts(stocks []Stock, repo AlertRepository) ([]alert, error) {
+	rules, err := repo.List()
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	alerts, changed := evaluateAlerts(stocks, rules)
+	return alerts, repo.SetTriggered(changed)
+}
+
+func formatAlerts(alerts []alert) string {
+	lines := make([]string, len(alerts))
+	for i, a := range alerts {
+		lines[i] = fmt.Sprintf("%s %s, now %s", a.rule.Code, a.rule.condition(), formatMetric(a.rule.Metric, metrics[a.rule.Metric](a.stock)))
+	}
+	return "Alerts:\n" + strings.Join(lines, "\n")
+}
+
+func init() {
+	commands["alerts"] = command{"alerts: list the alert rules", listAlerts}
+	commands["alert-add"] = command{"alert-add CODE METRIC OP THRESHOLD: alert when the condition, e.g. last > 9000, starts to hold for a code", addAlert}
+	commands["alert-delete"] = command{"alert-delete ID: delete an alert rule", deleteAlert}
+}
+
+func listAlerts(w io.Writer, store *storage, _ []string) error {
+	rules, err := store.alerts.List()
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"Id", "Code", "Condition", "Triggered"}}
+	for _, r := range rules {
+		rows = append(rows, []string{strconv.FormatInt(r.Id, 10), r.Code, r.condition(), strconv.FormatBool(r.Triggered)})
+	}
+	_, err = fmt.Fprintln(w, alignColumns(rows, []bool{true, false, false, false}))
+	return err
+}
+
+// addAlert takes the condition as one argument, e.g. "last > 9000", or as three.
+func addAlert(w io.Writer, store *storage, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: alert-add CODE METRIC OP THRESHOLD")
+	}
+
+	metric, op, threshold, err := parseAlertCondition(strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+
+	rule := AlertRule{Code: strings.ToUpper(args[0]), Metric: metric, Op: op, Threshold: threshold, CreatedAt: time.Now()}
+	if err = store.alerts.Add(&rule); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Added alert %d: %s %s\n", rule.Id, rule.Code, rule.condition())
+	return err
+}
+
+func deleteAlert(w io.Writer, store *storage, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: alert-delete ID")
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid alert id %q", args[0])
+	}
+	if err = store.alerts.Delete(id); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Deleted alert %d\n", id)
+	return err
+}
@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chrishadi/instock/indicators"
+)
+
+func TestParseAlertConditionShouldParseMetricOperatorAndThreshold(t *testing.T) {
+	metric, op, threshold, err := parseAlertCondition(" one_day  <= -0.05 ")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metric != "one_day" || op != "<=" || threshold != -0.05 {
+		t.Errorf("Expect one_day <= -0.05, got %s %s %g", metric, op, threshold)
+	}
+}
+
+func TestParseAlertConditionGivenInvalidConditionShouldReturnError(t *testing.T) {
+	for _, cond := range []string{"last >", "price > 1", "last = 1", "last > x"} {
+		if _, _, _, err := parseAlertCondition(cond); err == nil {
+			t.Errorf("%q: expect error, got nil", cond)
+		}
+	}
+}
+
+func TestEvaluateAlertsShouldFireOncePerCrossing(t *testing.T) {
+	rules := []AlertRule{{Id: 1, Code: "A", Metric: "last", Op: ">", Threshold: 100}}
+	prices := []float32{90, 110, 120, 95, 105}
+	expected := []bool{false, true, false, false, true}
+
+	for i, price := range prices {
+		alerts, changed := evaluateAlerts([]Stock{{Code: "A", Last: price}}, rules)
+		if fired := len(alerts) > 0; fired != expected[i] {
+			t.Errorf("%g: expect fired to be %t, got %t", price, expected[i], fired)
+		}
+		for _, r := range changed {
+			rules[0].Triggered = r.Triggered
+		}
+	}
+}
+
+func TestEvaluateAlertsShouldSkipRulesOfOtherCodesAndUnavailableIndicators(t *testing.T) {
+	rules := []AlertRule{
+		{Id: 1, Code: "A", Metric: "rsi14", Op: "<", Threshold: 30},
+		{Id: 2, Code: "B", Metric: "rsi14", Op: "<", Threshold: 30},
+		{Id: 3, Code: "C", Metric: "volume", Op: ">=", Threshold: 1000},
+	}
+	stocks := []Stock{
+		{Code: "A", Indicators: indicators.Values{Bars: 5}},
+		{Code: "B", Indicators: indicators.Values{Bars: 30, Rsi14: 25}},
+	}
+
+	alerts, changed := evaluateAlerts(stocks, rules)
+
+	if len(alerts) != 1 || alerts[0].rule.Id != 2 {
+		t.Errorf("Expect alert 2 only, got %+v", alerts)
+	}
+	if len(changed) != 1 || !changed[0].Triggered {
+		t.Errorf("Expect alert 2 to be triggered, got %+v", changed)
+	}
+}
+
+func TestCheckAlertsShouldStoreTriggeredStates(t *testing.T) {
+	repo := &MemAlertRepository{}
+	repo.Add(&AlertRule{Code: "A", Metric: "one_day", Op: "<=", Threshold: -0.05})
+	repo.Add(&AlertRule{Code: "A", Metric: "volume", Op: ">", Threshold: 1000})
+	stocks := []Stock{{Code: "A", OneDay: -0.07, Volume: 500}}
+
+	alerts, err := checkAlerts(stocks, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("Expect 1 alert, got %+v", alerts)
+	}
+	if msg, expected := formatAlerts(alerts), "Alerts:\nA one_day <= -0.05, now -7.00%"; msg != expected {
+		t.Errorf("Expect %q, got %q", expected, msg)
+	}
+
+	rules, _ := repo.List()
+	if triggered := []bool{rules[0].Triggered, rules[1].Triggered}; !reflect.DeepEqual(triggered, []bool{true, false}) {
+		t.Errorf("Expect [true false], got %v", triggered)
+	}
+	if alerts, _ = checkAlerts(stocks, repo); len(alerts) != 0 {
+		t.Errorf("Expect no alert while the condition holds, got %+v", alerts)
+	}
+}
@@ -0,0 +1,479 @@
+package ingest
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tradingDaysPerYear annualizes the volatility of daily returns, by convention.
+const tradingDaysPerYear = 252
+
+// Analytics csv exports
+const (
+	csvSummary     = "summary"
+	csvRolling     = "rolling"
+	csvCorrelation = "correlation"
+)
+
+// returnSeries are the daily returns of a code or a custom index, oldest first.
+type returnSeries struct {
+	name    string
+	days    []time.Time
+	returns []float64
+}
+
+// codeRisk are the risk statistics of the returns of a code. Beta and correlation are against
+// the benchmark, on the days both have returns, and NaN without one.
+type codeRisk struct {
+	series      returnSeries
+	volatility  float64
+	rolling     []float64 // the rolling volatility of each day of the series
+	beta        float64
+	correlation float64
+	rollingBeta map[string]float64 // by day as 2006-01-02
+}
+
+type analyticsOptions struct {
+	codes     []string
+	days      int
+	window    int
+	benchmark string
+	csv       string
+}
+
+// marketSessions numbers the days between from and to with a bar of any code, oldest first,
+// by day as 2006-01-02. A day without bars, e.g. missed by the ingest, is no session.
+func marketSessions(repo DailyBarRepository, from, to time.Time) (map[string]int, error) {
+	bars, err := repo.Since(from)
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	seen := map[string]bool{}
+	for _, bar := range bars {
+		day := bar.Date.Format("2006-01-02")
+		if !bar.Date.After(to) && !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+
+	sessions := make(map[string]int, len(days))
+	for i, day := range days {
+		sessions[day] = i
+	}
+	return sessions, nil
+}
+
+// consecutive tells whether day is the session right after prev, so that a return between them
+// is a daily one rather than of the sessions in between, e.g. of a suspended code.
+func consecutive(sessions map[string]int, prev, day time.Time) bool {
+	i, ok := sessions[prev.Format("2006-01-02")]
+	if !ok {
+		return false
+	}
+	j, ok := sessions[day.Format("2006-01-02")]
+	return ok && j == i+1
+}
+
+// barReturns computes the daily returns of consecutive bars, adjusted for corporate actions
+// so that splits and the like are not returns. Bars with a session between them have no return.
+func barReturns(name string, bars []Bar, sessions map[string]int) returnSeries {
+	series := returnSeries{name: name}
+	for i := 1; i < len(bars); i++ {
+		prevClose, close := float64(bars[i-1].Close), float64(bars[i].Close)
+		if prevClose <= 0 || close <= 0 || !consecutive(sessions, bars[i-1].Date, bars[i].Date) {
+			continue
+		}
+		series.days = append(series.days, bars[i].Date)
+		series.returns = append(series.returns, close/prevClose-1)
+	}
+	return series
+}
+
+// indexReturns computes the daily returns of consecutive values of a custom index,
+// skipping values with a session between them like barReturns.
+func indexReturns(name string, values []IndexValue, sessions map[string]int) returnSeries {
+	series := returnSeries{name: name}
+	for i := 1; i < len(values); i++ {
+		if values[i-1].Value <= 0 || !consecutive(sessions, values[i-1].Date, values[i].Date) {
+			continue
+		}
+		series.days = append(series.days, values[i].Date)
+		series.returns = append(series.returns, values[i].Value/values[i-1].Value-1)
+	}
+	return series
+}
+
+// align returns the days both series have returns on, with the returns of each.
+func align(a, b returnSeries) (days []time.Time, x, y []float64) {
+	for i, j := 0, 0; i < len(a.days) && j < len(b.days); {
+		switch {
+		case a.days[i].Before(b.days[j]):
+			i++
+		case b.days[j].Before(a.days[i]):
+			j++
+		default:
+			days = append(days, a.days[i])
+			x = append(x, a.returns[i])
+			y = append(y, b.returns[j])
+			i++
+			j++
+		}
+	}
+	return days, x, y
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// covariance is the sample covariance of x and y, NaN if there are fewer than two pairs.
+func covariance(x, y []float64) float64 {
+	if len(x) < 2 {
+		return math.NaN()
+	}
+
+	mx, my := mean(x), mean(y)
+	var sum float64
+	for i := range x {
+		sum += (x[i] - mx) * (y[i] - my)
+	}
+	return sum / float64(len(x)-1)
+}
+
+// volatility is the annualized standard deviation of daily returns.
+func volatility(returns []float64) float64 {
+	return math.Sqrt(covariance(returns, returns) * tradingDaysPerYear)
+}
+
+// beta is the sensitivity of the returns x to the benchmark returns b, NaN if b does not vary.
+func beta(x, b []float64) float64 {
+	v := covariance(b, b)
+	if v == 0 {
+		return math.NaN()
+	}
+	return covariance(x, b) / v
+}
+
+// correlation is the Pearson correlation of x and y, NaN if either does not vary.
+func correlation(x, y []float64) float64 {
+	v := covariance(x, x) * covariance(y, y)
+	if v == 0 {
+		return math.NaN()
+	}
+	return covariance(x, y) / math.Sqrt(v)
+}
+
+// rolling applies f to every window of n consecutive pairs of x and y, NaN until the first window is full.
+func rolling(n int, x, y []float64, f func(x, y []float64) float64) []float64 {
+	res := make([]float64, len(x))
+	for i := range x {
+		if i+1 < n {
+			res[i] = math.NaN()
+			continue
+		}
+		res[i] = f(x[i+1-n:i+1], y[i+1-n:i+1])
+	}
+	return res
+}
+
+// computeRisk computes the risk statistics of the series, against the benchmark if it is not nil.
+func computeRisk(series []returnSeries, benchmark *returnSeries, window int) []codeRisk {
+	res := make([]codeRisk, len(series))
+	for i, s := range series {
+		risk := codeRisk{
+			series:      s,
+			volatility:  volatility(s.returns),
+			rolling:     rolling(window, s.returns, s.returns, func(x, _ []float64) float64 { return volatility(x) }),
+			beta:        math.NaN(),
+			correlation: math.NaN(),
+		}
+
+		if benchmark != nil {
+			days, x, b := align(s, *benchmark)
+			risk.beta = beta(x, b)
+			risk.correlation = correlation(x, b)
+			risk.rollingBeta = make(map[string]float64, len(days))
+			for j, v := range rolling(window, x, b, beta) {
+				risk.rollingBeta[days[j].Format("2006-01-02")] = v
+			}
+		}
+		res[i] = risk
+	}
+	return res
+}
+
+// correlationMatrix computes the correlation of the returns of every pair of series,
+// each on the days both have returns.
+func correlationMatrix(series []returnSeries) [][]float64 {
+	matrix := make([][]float64, len(series))
+	for i := range series {
+		matrix[i] = make([]float64, len(series))
+		for j := range series {
+			_, x, y := align(series[i], series[j])
+			matrix[i][j] = correlation(x, y)
+		}
+	}
+	return matrix
+}
+
+func init() {
+	commands["analytics"] = command{
+		"analytics CODE|index:NAME... [days=365] [window=20] [benchmark=CODE|index:NAME] [csv=summary|rolling|correlation]: " +
+			"volatility, beta and correlation of daily returns",
+		runAnalytics,
+	}
+}
+
+// parseAnalyticsArgs parses the codes and the key=value options of the analytics command.
+func parseAnalyticsArgs(args []string) (analyticsOptions, error) {
+	opts := analyticsOptions{days: 365, window: 20}
+	for _, arg := range args {
+		key, value, isOption := strings.Cut(arg, "=")
+		if !isOption {
+			opts.codes = append(opts.codes, arg)
+			continue
+		}
+
+		var err error
+		switch key {
+		case "days":
+			if opts.days, err = strconv.Atoi(value); err != nil || opts.days <= 0 {
+				return opts, fmt.Errorf("invalid days %q", value)
+			}
+		case "window":
+			if opts.window, err = strconv.Atoi(value); err != nil || opts.window < 2 {
+				return opts, fmt.Errorf("invalid window %q, expect at least 2", value)
+			}
+		case "benchmark":
+			opts.benchmark = value
+		case "csv":
+			switch value {
+			case csvSummary, csvRolling, csvCorrelation:
+				opts.csv = value
+			default:
+				return opts, fmt.Errorf("invalid csv %q, expect summary, rolling or correlation", value)
+			}
+		default:
+			return opts, fmt.Errorf("unknown option %q", key)
+		}
+	}
+
+	if len(opts.codes) == 0 {
+		return opts, errors.New("usage: analytics CODE|index:NAME... [days=365] [window=20] [benchmark=CODE|index:NAME] [csv=summary|rolling|correlation]")
+	}
+	return opts, nil
+}
+
+// indexPrefix marks the name of a custom index among the codes and benchmark of the analytics command,
+// so that an index cannot shadow a code of the same name.
+const indexPrefix = "index:"
+
+// loadReturns returns the daily returns between from and to of the code, or of the custom index
+// if name has the index prefix. A series without returns is an error, e.g. of a code or index
+// with less than two consecutive sessions of history.
+func loadReturns(store *storage, name string, from, to time.Time, sessions map[string]int) (returnSeries, error) {
+	var series returnSeries
+	if strings.HasPrefix(name, indexPrefix) {
+		name = strings.TrimPrefix(name, indexPrefix)
+		ix, err := store.indices.Get(name)
+		if err != nil {
+			return returnSeries{}, err
+		}
+		if ix == nil {
+			return returnSeries{}, fmt.Errorf("index %q not found", name)
+		}
+		values, err := store.indexValues.Get(name, from)
+		if err != nil {
+			return returnSeries{}, err
+		}
+		series = indexReturns(name, values, sessions)
+	} else {
+		code := strings.ToUpper(name)
+		bars, err := store.dailyBars.AdjustedDaily(code, from, to)
+		if err != nil {
+			return returnSeries{}, err
+		}
+		series = barReturns(code, bars, sessions)
+	}
+
+	if len(series.returns) == 0 {
+		return returnSeries{}, fmt.Errorf("not enough history of %s", series.name)
+	}
+	return series, nil
+}
+
+func runAnalytics(w io.Writer, store *storage, args []string) error {
+	opts, err := parseAnalyticsArgs(args)
+	if err != nil {
+		return err
+	}
+
+	to := tradingDay(time.Now())
+	from := to.AddDate(0, 0, -opts.days)
+	sessions, err := marketSessions(store.dailyBars, from, to)
+	if err != nil {
+		return err
+	}
+	series := make([]returnSeries, len(opts.codes))
+	for i, code := range opts.codes {
+		if series[i], err = loadReturns(store, code, from, to, sessions); err != nil {
+			return err
+		}
+	}
+
+	var benchmark *returnSeries
+	if len(opts.benchmark) > 0 {
+		b, err := loadReturns(store, opts.benchmark, from, to, sessions)
+		if err != nil {
+			return err
+		}
+		benchmark = &b
+	}
+
+	risks := computeRisk(series, benchmark, opts.window)
+	switch opts.csv {
+	case csvSummary:
+		return writeRiskCsv(w, risks, opts.window)
+	case csvRolling:
+		return writeRollingCsv(w, risks)
+	case csvCorrelation:
+		return writeCorrelationCsv(w, series, correlationMatrix(series))
+	}
+
+	out := fmt.Sprintf("Daily returns of the last %d days, rolling window %d", opts.days, opts.window)
+	if benchmark != nil {
+		out += ", benchmark " + benchmark.name
+	}
+	out += "\n" + formatRiskTable(risks, opts.window, benchmark != nil) + "\n"
+	if len(series) > 1 {
+		out += "Correlation:\n" + formatCorrelationTable(series, correlationMatrix(series)) + "\n"
+	}
+	_, err = io.WriteString(w, out)
+	return err
+}
+
+func formatRiskTable(risks []codeRisk, window int, hasBenchmark bool) string {
+	header := []string{"Code", "Days", "Vol", "Vol" + strconv.Itoa(window)}
+	rightAligned := []bool{false, true, true, true}
+	if hasBenchmark {
+		header = append(header, "Beta", "Corr")
+		rightAligned = append(rightAligned, true, true)
+	}
+
+	rows := [][]string{header}
+	for _, r := range risks {
+		row := []string{r.series.name, strconv.Itoa(len(r.series.returns)), formatRatio(r.volatility), formatRatio(last(r.rolling))}
+		if hasBenchmark {
+			row = append(row, formatStat(r.beta), formatStat(r.correlation))
+		}
+		rows = append(rows, row)
+	}
+	return alignColumns(rows, rightAligned)
+}
+
+func formatCorrelationTable(series []returnSeries, matrix [][]float64) string {
+	header := []string{""}
+	rightAligned := []bool{false}
+	for _, s := range series {
+		header = append(header, s.name)
+		rightAligned = append(rightAligned, true)
+	}
+
+	rows := [][]string{header}
+	for i, s := range series {
+		row := []string{s.name}
+		for _, v := range matrix[i] {
+			row = append(row, formatStat(v))
+		}
+		rows = append(rows, row)
+	}
+	return alignColumns(rows, rightAligned)
+}
+
+func writeRiskCsv(w io.Writer, risks []codeRisk, window int) error {
+	records := [][]string{{"code", "days", "volatility", "volatility_" + strconv.Itoa(window), "beta", "correlation"}}
+	for _, r := range risks {
+		records = append(records, []string{
+			r.series.name, strconv.Itoa(len(r.series.returns)), csvFloat(r.volatility), csvFloat(last(r.rolling)),
+			csvFloat(r.beta), csvFloat(r.correlation),
+		})
+	}
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+func writeRollingCsv(w io.Writer, risks []codeRisk) error {
+	records := [][]string{{"date", "code", "return", "volatility", "beta"}}
+	for _, r := range risks {
+		for i, day := range r.series.days {
+			b, exist := r.rollingBeta[day.Format("2006-01-02")]
+			if !exist {
+				b = math.NaN()
+			}
+			records = append(records, []string{
+				day.Format("2006-01-02"), r.series.name, csvFloat(r.series.returns[i]), csvFloat(r.rolling[i]), csvFloat(b),
+			})
+		}
+	}
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+func writeCorrelationCsv(w io.Writer, series []returnSeries, matrix [][]float64) error {
+	header := []string{"code"}
+	for _, s := range series {
+		header = append(header, s.name)
+	}
+
+	records := [][]string{header}
+	for i, s := range series {
+		record := []string{s.name}
+		for _, v := range matrix[i] {
+			record = append(record, csvFloat(v))
+		}
+		records = append(records, record)
+	}
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+func last(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	return values[len(values)-1]
+}
+
+// formatRatio formats a ratio as a percentage, and a missing one as "-".
+func formatRatio(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", v*100)
+}
+
+func formatStat(v float64) string {
+	if math.IsNaN(v) {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// csvFloat formats a value for csv export, a missing one being empty.
+func csvFloat(v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,206 @@
+package ingest
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBarReturnsOfAdjustedBarsShouldNotCountSplits(t *testing.T) {
+	actions := &MemCorporateActionRepository{}
+	actions.Upsert([]CorporateAction{{Code: "A", Type: actionSplit, ExDate: date("2020-01-06"), Old: 1, New: 2, Factor: 0.5}})
+	repo := &MemDailyBarRepository{actions: actions}
+	repo.Upsert([]Bar{
+		{Code: "A", Date: date("2020-01-02"), Close: 100},
+		{Code: "A", Date: date("2020-01-03"), Close: 110},
+		{Code: "A", Date: date("2020-01-07"), Close: 60},
+	})
+	bars, _ := repo.AdjustedDaily("A", date("2020-01-01"), date("2020-01-07"))
+	sessions, _ := marketSessions(repo, date("2020-01-01"), date("2020-01-07"))
+
+	series := barReturns("A", bars, sessions)
+
+	if !reflect.DeepEqual(series.days, []time.Time{date("2020-01-03"), date("2020-01-07")}) {
+		t.Errorf("Expect returns of the last two days, got %v", series.days)
+	}
+	if len(series.returns) != 2 || !almostEqual(series.returns[0], 0.1) || !almostEqual(series.returns[1], 60/55.0-1) {
+		t.Errorf("Expect [0.1 %v], got %v", 60/55.0-1, series.returns)
+	}
+}
+
+func TestBarReturnsShouldSkipReturnsAcrossMissingSessions(t *testing.T) {
+	repo := &MemDailyBarRepository{actions: &MemCorporateActionRepository{}}
+	repo.Upsert([]Bar{
+		{Code: "A", Date: date("2020-01-02"), Close: 100},
+		{Code: "A", Date: date("2020-01-03"), Close: 110},
+		{Code: "A", Date: date("2020-01-07"), Close: 121},
+		{Code: "A", Date: date("2020-01-08"), Close: 133.1},
+		// A is suspended on 2020-01-06, when B trades
+		{Code: "B", Date: date("2020-01-03"), Close: 50},
+		{Code: "B", Date: date("2020-01-06"), Close: 51},
+		{Code: "B", Date: date("2020-01-07"), Close: 52},
+	})
+	bars, _ := repo.AdjustedDaily("A", date("2020-01-01"), date("2020-01-08"))
+	sessions, err := marketSessions(repo, date("2020-01-01"), date("2020-01-08"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := barReturns("A", bars, sessions)
+
+	if !reflect.DeepEqual(series.days, []time.Time{date("2020-01-03"), date("2020-01-08")}) {
+		t.Errorf("Expect no return on 2020-01-07, got the returns of %v", series.days)
+	}
+	if len(series.returns) != 2 || !almostEqual(series.returns[0], 0.1) || !almostEqual(series.returns[1], 0.1) {
+		t.Errorf("Expect [0.1 0.1], got %v", series.returns)
+	}
+}
+
+func TestAlignShouldKeepTheDaysOfBothSeries(t *testing.T) {
+	a := returnSeries{days: []time.Time{date("2020-01-02"), date("2020-01-03"), date("2020-01-06")}, returns: []float64{1, 2, 3}}
+	b := returnSeries{days: []time.Time{date("2020-01-03"), date("2020-01-06"), date("2020-01-07")}, returns: []float64{4, 5, 6}}
+
+	days, x, y := align(a, b)
+
+	if !reflect.DeepEqual(days, []time.Time{date("2020-01-03"), date("2020-01-06")}) ||
+		!reflect.DeepEqual(x, []float64{2, 3}) || !reflect.DeepEqual(y, []float64{4, 5}) {
+		t.Errorf("Expect the returns of 2020-01-03 and 2020-01-06, got %v %v %v", days, x, y)
+	}
+}
+
+func TestRiskStatisticsShouldMatchTheirDefinitions(t *testing.T) {
+	b := []float64{0.01, -0.02, 0.03, 0.005}
+	twice, opposite := make([]float64, len(b)), make([]float64, len(b))
+	for i, v := range b {
+		twice[i], opposite[i] = 2*v, -v
+	}
+
+	// variance of b is 0.00126875 / 3, its mean being 0.00625
+	if expected := math.Sqrt(0.00126875 / 3 * 252); !almostEqual(volatility(b), expected) {
+		t.Errorf("Expect volatility %v, got %v", expected, volatility(b))
+	}
+	if !almostEqual(beta(twice, b), 2) || !almostEqual(correlation(twice, b), 1) || !almostEqual(correlation(opposite, b), -1) {
+		t.Errorf("Expect beta 2 and correlations 1 and -1, got %v, %v and %v", beta(twice, b), correlation(twice, b), correlation(opposite, b))
+	}
+	if flat := []float64{0.01, 0.01, 0.01}; !math.IsNaN(beta(b[:3], flat)) || !math.IsNaN(correlation(b[:3], flat)) {
+		t.Error("Expect NaN against a flat benchmark")
+	}
+	if !math.IsNaN(volatility(b[:1])) {
+		t.Error("Expect NaN given a single return")
+	}
+
+	sums := rolling(2, []float64{1, 2, 3}, []float64{10, 20, 30}, func(x, y []float64) float64 { return x[0] + y[1] })
+	if !math.IsNaN(sums[0]) || sums[1] != 21 || sums[2] != 32 {
+		t.Errorf("Expect [NaN 21 32], got %v", sums)
+	}
+}
+
+func TestParseAnalyticsArgsShouldParseCodesAndOptions(t *testing.T) {
+	opts, err := parseAnalyticsArgs([]string{"BBCA", "days=90", "BBRI", "benchmark=big", "window=10", "csv=rolling"})
+
+	expected := analyticsOptions{codes: []string{"BBCA", "BBRI"}, days: 90, window: 10, benchmark: "big", csv: csvRolling}
+	if err != nil || !reflect.DeepEqual(opts, expected) {
+		t.Errorf("Expect %+v, got %+v, %v", expected, opts, err)
+	}
+
+	for _, args := range [][]string{{"days=30"}, {"A", "window=1"}, {"A", "csv=xls"}, {"A", "size=3"}} {
+		if _, err = parseAnalyticsArgs(args); err == nil {
+			t.Errorf("%v: expect error, got nil", args)
+		}
+	}
+}
+
+// seedAnalytics stores the bars of A and B, moving opposite ways, of the last five days
+// and the values of an index of A.
+func seedAnalytics(store *storage) {
+	today := tradingDay(time.Now())
+	for i, close := range []float32{100, 102, 99, 103, 104} {
+		day := today.AddDate(0, 0, i-4)
+		store.dailyBars.Upsert([]Bar{
+			{Code: "A", Date: day, Close: close},
+			{Code: "B", Date: day, Close: 300 - 2*close},
+		})
+		store.indexValues.Upsert([]IndexValue{{Name: "idx", Date: day, Value: float64(close) * 10}})
+	}
+
+	store.indices.Save(CustomIndex{Name: "idx", Weighting: weightPrice, Codes: []string{"A"}, BaseValue: 1000})
+}
+
+func TestAnalyticsCommandShouldReportRiskAgainstTheBenchmark(t *testing.T) {
+	store := memStorage()
+	seedAnalytics(store)
+	out := &strings.Builder{}
+
+	if err := runAnalytics(out, store, []string{"a", "B", "benchmark=index:idx", "window=3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	if lines[0] != "Daily returns of the last 365 days, rolling window 3, benchmark idx" ||
+		!strings.HasPrefix(lines[1], "Code Days") || !strings.HasSuffix(lines[1], "Beta  Corr") {
+		t.Fatalf("Unexpected header\n%s", out)
+	}
+	// A is the index, so its beta and correlation are 1
+	if fields := strings.Fields(lines[2]); fields[0] != "A" || fields[1] != "4" || fields[4] != "1.00" || fields[5] != "1.00" {
+		t.Errorf("Expect A with 4 days, beta and correlation 1, got %q", lines[2])
+	}
+	if lines[4] != "Correlation:" || !reflect.DeepEqual(strings.Fields(lines[6]), []string{"A", "1.00", "-1.00"}) {
+		t.Errorf("Expect a correlation matrix, got\n%s", out)
+	}
+}
+
+func TestAnalyticsCommandShouldOnlyReadIndicesWithThePrefix(t *testing.T) {
+	store := memStorage()
+	seedAnalytics(store)
+	// an index named like a code, with a single value, i.e. without returns
+	store.indices.Save(CustomIndex{Name: "B", Weighting: weightEqual, Codes: []string{"A"}, BaseValue: 1000})
+	store.indexValues.Upsert([]IndexValue{{Name: "B", Date: tradingDay(time.Now()), Value: 1000}})
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"idx"}, "not enough history of IDX"},
+		{[]string{"index:B"}, "not enough history of B"},
+		{[]string{"A", "benchmark=index:nope"}, `index "nope" not found`},
+	}
+	for _, test := range tests {
+		if err := runAnalytics(&strings.Builder{}, store, test.args); err == nil || err.Error() != test.expected {
+			t.Errorf("%v: expect %q, got %v", test.args, test.expected, err)
+		}
+	}
+
+	out := &strings.Builder{}
+	if err := runAnalytics(out, store, []string{"A", "B", "csv=correlation"}); err != nil {
+		t.Fatal(err)
+	}
+	// B moves opposite to A, unlike the index
+	if !strings.HasPrefix(out.String(), "code,A,B\nA,1,-0.99") {
+		t.Errorf("Expect the returns of code B, got %q", out.String())
+	}
+}
+
+func TestAnalyticsCommandShouldExportCsv(t *testing.T) {
+	store := memStorage()
+	seedAnalytics(store)
+	out := &strings.Builder{}
+
+	if err := runAnalytics(out, store, []string{"A", "index:idx", "csv=correlation"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "code,A,idx\nA,1,1\nidx,1,1\n"; out.String() != expected {
+		t.Errorf("Expect %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := runAnalytics(out, store, []string{"A", "window=4", "csv=rolling"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 || lines[0] != "date,code,return,volatility,beta" ||
+		!strings.Contains(lines[1], ",A,0.02") || !strings.HasSuffix(lines[1], ",,") || strings.HasSuffix(lines[4], ",,") {
+		t.Errorf("Expect 4 returns with the rolling volatility of the last, got\n%s", out)
+	}
+}
@@ -0,0 +1,207 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bar periods
+const (
+	periodDaily   = "daily"
+	periodWeekly  = "weekly"
+	periodMonthly = "monthly"
+)
+
+// Bar is the OHLCV summary of a code over a period starting at Date.
+// Daily bars are stored, weekly and monthly bars are rolled up from them.
+type Bar struct {
+	tableName struct{} `pg:"daily_bars"`
+
+	Code      string    `pg:",pk"`
+	Date      time.Time `pg:",pk,type:date"`
+	Open      float32
+	High      float32
+	Low       float32
+	Close     float32
+	Volume    float64
+	Value     float64
+	Frequency float64
+}
+
+func tradingDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// deriveDailyBars builds one bar per code per trading day from intraday snapshots.
+// Snapshots carry the day's running open, high, low and totals, so the latest one wins
+// for close and totals while high and low are widened across all of them.
+func deriveDailyBars(stocks []Stock) ([]Bar, error) {
+	type snapshot struct {
+		stock Stock
+		at    time.Time
+	}
+
+	snapshots := make([]snapshot, len(stocks))
+	for i, s := range stocks {
+		at, err := parseLastUpdate(s.LastUpdate)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[i] = snapshot{s, at}
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].at.Before(snapshots[j].at)
+	})
+
+	index := make(map[string]int)
+	bars := make([]Bar, 0, len(stocks))
+	for _, snap := range snapshots {
+		bar := Bar{
+			Code:      snap.stock.Code,
+			Date:      tradingDay(snap.at),
+			Open:      snap.stock.AdjustedOpenPrice,
+			High:      snap.stock.AdjustedHighPrice,
+			Low:       snap.stock.AdjustedLowPrice,
+			Close:     snap.stock.Last,
+			Volume:    snap.stock.Volume,
+			Value:     snap.stock.Value,
+			Frequency: snap.stock.Frequency,
+		}
+
+		key := bar.Code + bar.Date.Format("2006-01-02")
+		if i, exist := index[key]; exist {
+			bars[i].update(bar)
+		} else {
+			index[key] = len(bars)
+			bars = append(bars, bar)
+		}
+	}
+
+	return bars, nil
+}
+
+// update merges a later snapshot bar of the same day into bar.
+func (bar *Bar) update(later Bar) {
+	if bar.Open == 0 {
+		bar.Open = later.Open
+	}
+	if later.High > bar.High {
+		bar.High = later.High
+	}
+	if later.Low < bar.Low {
+		bar.Low = later.Low
+	}
+	bar.Close = later.Close
+	bar.Volume = later.Volume
+	bar.Value = later.Value
+	bar.Frequency = later.Frequency
+}
+
+// WeeklyBars rolls up daily bars, oldest first, into bars starting on Monday.
+func WeeklyBars(daily []Bar) []Bar {
+	return rollUpBars(daily, func(t time.Time) time.Time {
+		offset := (int(t.Weekday()) + 6) % 7
+		return t.AddDate(0, 0, -offset)
+	})
+}
+
+// MonthlyBars rolls up daily bars, oldest first, into bars starting on the first of the month.
+func MonthlyBars(daily []Bar) []Bar {
+	return rollUpBars(daily, func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	})
+}
+
+func init() {
+	commands["bars"] = command{"bars CODE [daily|weekly|monthly] [DAYS]: print the adjusted bars of a code in the last DAYS, 90 by default", showBars}
+}
+
+func showBars(w io.Writer, store *storage, args []string) error {
+	if len(args) < 1 || len(args) > 3 {
+		return errors.New("usage: bars CODE [daily|weekly|monthly] [DAYS]")
+	}
+
+	period, days := periodDaily, 90
+	for _, arg := range args[1:] {
+		switch arg {
+		case periodDaily, periodWeekly, periodMonthly:
+			period = arg
+		default:
+			var err error
+			if days, err = strconv.Atoi(arg); err != nil || days <= 0 {
+				return fmt.Errorf("invalid days %q", arg)
+			}
+		}
+	}
+
+	code := strings.ToUpper(args[0])
+	to := tradingDay(time.Now())
+	bars, err := store.dailyBars.AdjustedDaily(code, to.AddDate(0, 0, -days), to)
+	if err != nil {
+		return err
+	}
+	if len(bars) == 0 {
+		return fmt.Errorf("no bars of %s", code)
+	}
+	switch period {
+	case periodWeekly:
+		bars = WeeklyBars(bars)
+	case periodMonthly:
+		bars = MonthlyBars(bars)
+	}
+
+	rows := [][]string{{"Date", "Open", "High", "Low", "Close", "Volume", "Value"}}
+	for _, bar := range bars {
+		rows = append(rows, []string{
+			bar.Date.Format("2006-01-02"), formatPrice(bar.Open), formatPrice(bar.High), formatPrice(bar.Low),
+			formatPrice(bar.Close), formatAmount(bar.Volume), formatAmount(bar.Value),
+		})
+	}
+	_, err = fmt.Fprintf(w, "%s (%s)\n%s\n", code, period, alignColumns(rows, []bool{false, true, true, true, true, true, true}))
+	return err
+}
+
+func rollUpBars(daily []Bar, periodStart func(time.Time) time.Time) []Bar {
+	index := make(map[string]int)
+	bars := make([]Bar, 0)
+	for _, day := range daily {
+		start := periodStart(day.Date)
+		key := day.Code + start.Format("2006-01-02")
+
+		i, exist := index[key]
+		if !exist {
+			day.Date = start
+			index[key] = len(bars)
+			bars = append(bars, day)
+			continue
+		}
+
+		bar := &bars[i]
+		if day.High > bar.High {
+			bar.High = day.High
+		}
+		if day.Low < bar.Low {
+			bar.Low = day.Low
+		}
+		bar.Close = day.Close
+		bar.Volume += day.Volume
+		bar.Value += day.Value
+		bar.Frequency += day.Frequency
+	}
+
+	return bars
+}
+
+func updateDailyBars(stocks []Stock, repo DailyBarRepository) error {
+	bars, err := deriveDailyBars(stocks)
+	if err != nil {
+		return err
+	}
+
+	return repo.Upsert(bars)
+}
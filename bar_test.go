@@ -0,0 +1,121 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeriveDailyBarsGivenIntradaySnapshotsShouldMergeThemPerCodeAndDay(t *testing.T) {
+	stocks := []Stock{
+		{Code: "A", LastUpdate: "2020-02-03T10:00:00", AdjustedOpenPrice: 100, AdjustedHighPrice: 105, AdjustedLowPrice: 99, Last: 104, Volume: 10, Value: 1000, Frequency: 1},
+		{Code: "A", LastUpdate: "2020-02-03T09:00:00", AdjustedOpenPrice: 100, AdjustedHighPrice: 102, AdjustedLowPrice: 98, Last: 101, Volume: 5, Value: 500, Frequency: 1},
+		{Code: "A", LastUpdate: "2020-02-04T09:00:00", AdjustedOpenPrice: 104, AdjustedHighPrice: 106, AdjustedLowPrice: 103, Last: 105, Volume: 3, Value: 300, Frequency: 2},
+		{Code: "B", LastUpdate: "2020-02-03T10:00:00", AdjustedOpenPrice: 50, AdjustedHighPrice: 51, AdjustedLowPrice: 49, Last: 50, Volume: 7, Value: 350, Frequency: 3},
+	}
+
+	expected := []Bar{
+		{Code: "A", Date: date("2020-02-03"), Open: 100, High: 105, Low: 98, Close: 104, Volume: 10, Value: 1000, Frequency: 1},
+		{Code: "B", Date: date("2020-02-03"), Open: 50, High: 51, Low: 49, Close: 50, Volume: 7, Value: 350, Frequency: 3},
+		{Code: "A", Date: date("2020-02-04"), Open: 104, High: 106, Low: 103, Close: 105, Volume: 3, Value: 300, Frequency: 2},
+	}
+	actual, err := deriveDailyBars(stocks)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func TestDeriveDailyBarsGivenInvalidLastUpdateShouldReturnError(t *testing.T) {
+	_, err := deriveDailyBars([]Stock{{Code: "A", LastUpdate: "invalid"}})
+
+	if err == nil {
+		t.Error("Expect error not to be nil")
+	}
+}
+
+var daily = []Bar{
+	{Code: "A", Date: date("2020-01-30"), Open: 10, High: 12, Low: 9, Close: 11, Volume: 1, Value: 10, Frequency: 1},
+	{Code: "A", Date: date("2020-01-31"), Open: 11, High: 13, Low: 10, Close: 12, Volume: 2, Value: 20, Frequency: 2},
+	{Code: "A", Date: date("2020-02-03"), Open: 12, High: 15, Low: 8, Close: 14, Volume: 3, Value: 30, Frequency: 3},
+}
+
+func TestWeeklyBarsShouldRollUpDailyBarsFromMonday(t *testing.T) {
+	expected := []Bar{
+		{Code: "A", Date: date("2020-01-27"), Open: 10, High: 13, Low: 9, Close: 12, Volume: 3, Value: 30, Frequency: 3},
+		{Code: "A", Date: date("2020-02-03"), Open: 12, High: 15, Low: 8, Close: 14, Volume: 3, Value: 30, Frequency: 3},
+	}
+
+	actual := WeeklyBars(daily)
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func TestMonthlyBarsShouldRollUpDailyBarsFromFirstOfMonth(t *testing.T) {
+	expected := []Bar{
+		{Code: "A", Date: date("2020-01-01"), Open: 10, High: 13, Low: 9, Close: 12, Volume: 3, Value: 30, Frequency: 3},
+		{Code: "A", Date: date("2020-02-01"), Open: 12, High: 15, Low: 8, Close: 14, Volume: 3, Value: 30, Frequency: 3},
+	}
+
+	actual := MonthlyBars(daily)
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func testDailyBarRepository(t *testing.T, repo DailyBarRepository) {
+	first := Bar{Code: "A", Date: date("2020-02-03"), Open: 100, High: 102, Low: 98, Close: 101, Volume: 5, Value: 500, Frequency: 1}
+	later := Bar{Code: "A", Date: date("2020-02-03"), Open: 100, High: 105, Low: 99, Close: 104, Volume: 10, Value: 1000, Frequency: 2}
+	other := Bar{Code: "A", Date: date("2020-02-04"), Open: 104, High: 106, Low: 103, Close: 105, Volume: 3, Value: 300, Frequency: 2}
+
+	if err := repo.Upsert([]Bar{first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert([]Bar{later, other}); err != nil {
+		t.Fatal(err)
+	}
+	bars, err := repo.Daily("A", date("2020-02-03"), date("2020-02-04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Bar{
+		{Code: "A", Date: date("2020-02-03"), Open: 100, High: 105, Low: 98, Close: 104, Volume: 10, Value: 1000, Frequency: 2},
+		other,
+	}
+	if !reflect.DeepEqual(bars, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, bars)
+	}
+}
+
+func TestMemDailyBarRepositoryUpsertShouldMergeBarsOfTheSameDay(t *testing.T) {
+	testDailyBarRepository(t, &MemDailyBarRepository{})
+}
+
+func TestShowBarsGivenWeeklyShouldPrintTheRolledUpAdjustedBars(t *testing.T) {
+	store := memStorage()
+	monday := WeeklyBars([]Bar{{Date: tradingDay(time.Now()).AddDate(0, 0, -7)}})[0].Date
+	store.dailyBars.Upsert([]Bar{
+		{Code: "A", Date: monday, Open: 200, High: 220, Low: 190, Close: 210, Volume: 10, Value: 2000},
+		{Code: "A", Date: monday.AddDate(0, 0, 1), Open: 105, High: 120, Low: 100, Close: 115, Volume: 30, Value: 3300},
+	})
+	store.corporateActions.Upsert([]CorporateAction{{Code: "A", Type: actionSplit, ExDate: monday.AddDate(0, 0, 1), Old: 1, New: 2, Factor: 0.5}})
+
+	out := commandOutput(store, "bars", "a", "weekly")
+
+	expected := "A (weekly)\n" +
+		"Date       Open High Low Close Volume Value\n" +
+		monday.Format("2006-01-02") + "  100  120  95   115     50  5.3K\n"
+	if out != expected {
+		t.Errorf("Expect %q, got %q", expected, out)
+	}
+	if out = commandOutput(store, "bars", "B"); out != "no bars of B" {
+		t.Errorf("Expect no bars of B, got %q", out)
+	}
+}
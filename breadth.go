@@ -0,0 +1,175 @@
+package ingest
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// MarketBreadth measures the participation of stocks in a trading day's move.
+// AdLine is the cumulative net advancers. NewHighs and NewLows count the day's 52-week extreme events,
+// and the AboveMa fields are the fractions of stocks with the moving average among the day's
+// indicators whose last price is above it.
+type MarketBreadth struct {
+	Date       time.Time `pg:",pk,type:date"`
+	Advancers  int       `pg:",use_zero"`
+	Decliners  int       `pg:",use_zero"`
+	Unchanged  int       `pg:",use_zero"`
+	AdRatio    float64   `pg:",use_zero"`
+	AdLine     int       `pg:",use_zero"`
+	NewHighs   int       `pg:",use_zero"`
+	NewLows    int       `pg:",use_zero"`
+	AboveMa20  float64   `pg:",use_zero"`
+	AboveMa50  float64   `pg:",use_zero"`
+	AboveMa200 float64   `pg:",use_zero"`
+}
+
+// computeBreadth computes the breadth of stocks on day given the day's events and indicators,
+// and the A/D line of the previous trading day.
+func computeBreadth(stocks []Stock, day time.Time, events []Event, values []Indicator, prevAdLine int) MarketBreadth {
+	codes := make(map[string]bool, len(stocks))
+	for _, s := range stocks {
+		codes[s.Code] = true
+	}
+	byCode := make(map[string]Indicator, len(values))
+	for _, v := range values {
+		if v.Date.Equal(day) {
+			byCode[v.Code] = v
+		}
+	}
+
+	b := MarketBreadth{Date: day}
+	for _, e := range events {
+		if !codes[e.Code] || !e.Date.Equal(day) {
+			continue
+		}
+		switch e.Type {
+		case eventYearHigh:
+			b.NewHighs++
+		case eventYearLow:
+			b.NewLows++
+		}
+	}
+
+	var above20, above50, above200, eligible20, eligible50, eligible200 int
+	for _, s := range stocks {
+		switch {
+		case s.OneDay > 0:
+			b.Advancers++
+		case s.OneDay < 0:
+			b.Decliners++
+		default:
+			b.Unchanged++
+		}
+
+		v := byCode[s.Code]
+		if v.Sma20 != 0 {
+			eligible20++
+			if float64(s.Last) > v.Sma20 {
+				above20++
+			}
+		}
+		if v.Sma50 != 0 {
+			eligible50++
+			if float64(s.Last) > v.Sma50 {
+				above50++
+			}
+		}
+		if v.Sma200 != 0 {
+			eligible200++
+			if float64(s.Last) > v.Sma200 {
+				above200++
+			}
+		}
+	}
+
+	b.AdRatio = float64(b.Advancers)
+	if b.Decliners > 0 {
+		b.AdRatio /= float64(b.Decliners)
+	}
+	b.AdLine = prevAdLine + b.Advancers - b.Decliners
+
+	if eligible20 > 0 {
+		b.AboveMa20 = float64(above20) / float64(eligible20)
+	}
+	if eligible50 > 0 {
+		b.AboveMa50 = float64(above50) / float64(eligible50)
+	}
+	if eligible200 > 0 {
+		b.AboveMa200 = float64(above200) / float64(eligible200)
+	}
+
+	return b
+}
+
+// updateBreadth computes the breadth of the stocks of the latest trading day of the batch.
+// It reads the day's extreme events and indicators, so it runs after they are updated.
+func updateBreadth(stocks []Stock, indicators IndicatorRepository, events EventRepository, repo MarketBreadthRepository) (*MarketBreadth, error) {
+	current, day, err := currentStocks(stocks)
+	if err != nil || len(current) == 0 {
+		return nil, err
+	}
+
+	prevAdLine := 0
+	prev, err := repo.Before(day)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		prevAdLine = prev.AdLine
+	}
+
+	dayEvents, err := events.Get("", day, day)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := indicators.Before(day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	b := computeBreadth(current, day, dayEvents, values, prevAdLine)
+	return &b, repo.Upsert(b)
+}
+
+func (b MarketBreadth) String() string {
+	return fmt.Sprintf("Adv: %d, Dec: %d, Unch: %d, A/D: %.2f, A/D line: %d, Highs: %d, Lows: %d, >MA20: %.1f%%, >MA50: %.1f%%, >MA200: %.1f%%",
+		b.Advancers, b.Decliners, b.Unchanged, b.AdRatio, b.AdLine, b.NewHighs, b.NewLows,
+		b.AboveMa20*100, b.AboveMa50*100, b.AboveMa200*100)
+}
+
+// PrintBreadth writes the market breadth of the last days, oldest first, as an aligned table.
+func PrintBreadth(w io.Writer, days int) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	to := tradingDay(time.Now())
+	breadths, err := store.breadth.Get(to.AddDate(0, 0, -days), to)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"Date", "Adv", "Dec", "Unch", "A/D", "A/D line", "Highs", "Lows", ">MA20", ">MA50", ">MA200"}}
+	for _, b := range breadths {
+		rows = append(rows, []string{
+			b.Date.Format("2006-01-02"),
+			fmt.Sprint(b.Advancers), fmt.Sprint(b.Decliners), fmt.Sprint(b.Unchanged),
+			fmt.Sprintf("%.2f", b.AdRatio), fmt.Sprint(b.AdLine),
+			fmt.Sprint(b.NewHighs), fmt.Sprint(b.NewLows),
+			fmt.Sprintf("%.1f%%", b.AboveMa20*100), fmt.Sprintf("%.1f%%", b.AboveMa50*100),
+			fmt.Sprintf("%.1f%%", b.AboveMa200*100),
+		})
+	}
+
+	_, err = fmt.Fprintln(w, alignColumns(rows, []bool{false, true, true, true, true, true, true, true, true, true, true}))
+	return err
+}
@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chrishadi/instock/indicators"
+)
+
+// risingBars returns n daily bars of code ending the day before end, closing at 1, 2, ..., n.
+func risingBars(code string, end time.Time, n int) []Bar {
+	bars := make([]Bar, n)
+	for i := range bars {
+		c := float32(i + 1)
+		bars[i] = Bar{Code: code, Date: end.AddDate(0, 0, i-n), Open: c, High: c, Low: c, Close: c}
+	}
+	return bars
+}
+
+func TestComputeBreadthShouldCountAdvancersDeclinersAndAccumulateAdLine(t *testing.T) {
+	day := date("2020-02-03")
+	stocks := []Stock{{Code: "A", OneDay: 0.1}, {Code: "B", OneDay: 0.2}, {Code: "C", OneDay: -0.1}, {Code: "D"}}
+
+	b := computeBreadth(stocks, day, nil, nil, 10)
+
+	if b.Advancers != 2 || b.Decliners != 1 || b.Unchanged != 1 {
+		t.Errorf("Expect 2/1/1, got %d/%d/%d", b.Advancers, b.Decliners, b.Unchanged)
+	}
+	if b.AdRatio != 2 {
+		t.Errorf("Expect A/D ratio 2, got %v", b.AdRatio)
+	}
+	if b.AdLine != 11 {
+		t.Errorf("Expect A/D line 11, got %d", b.AdLine)
+	}
+}
+
+func TestComputeBreadthShouldCountTheDayExtremeEventsOfTheStocks(t *testing.T) {
+	day := date("2020-02-03")
+	stocks := []Stock{{Code: "A"}, {Code: "B"}, {Code: "C"}}
+	events := []Event{
+		{Code: "A", Date: day, Type: eventYearHigh},
+		{Code: "A", Date: day, Type: eventAllTimeHigh},
+		{Code: "B", Date: day, Type: eventYearLow},
+		{Code: "C", Date: day.AddDate(0, 0, -1), Type: eventYearHigh},
+		{Code: "D", Date: day, Type: eventYearHigh},
+	}
+
+	b := computeBreadth(stocks, day, events, nil, 0)
+
+	if b.NewHighs != 1 || b.NewLows != 1 {
+		t.Errorf("Expect 1 high and 1 low, got %d and %d", b.NewHighs, b.NewLows)
+	}
+}
+
+func TestComputeBreadthShouldComputeFractionsAboveTheMovingAveragesOfTheDay(t *testing.T) {
+	day := date("2020-02-03")
+	values := []Indicator{
+		{Code: "A", Date: day, Values: indicators.Values{Sma20: 51, Sma50: 35, Sma200: 60}},
+		{Code: "B", Date: day, Values: indicators.Values{Sma20: 10, Sma200: 15}},
+		// C has no indicators of the day, e.g. without a bar of the day
+		{Code: "C", Date: day.AddDate(0, 0, -1), Values: indicators.Values{Sma20: 0.5, Sma50: 0.5}},
+	}
+	stocks := []Stock{{Code: "A", Last: 50}, {Code: "B", Last: 20}, {Code: "C", Last: 1}}
+
+	b := computeBreadth(stocks, day, nil, values, 0)
+
+	if b.AboveMa20 != 0.5 || b.AboveMa50 != 1 || b.AboveMa200 != 0.5 {
+		t.Errorf("Expect 0.5, 1 and 0.5, got %v, %v and %v", b.AboveMa20, b.AboveMa50, b.AboveMa200)
+	}
+}
+
+func TestUpdateBreadthShouldContinueAdLineOfThePreviousDay(t *testing.T) {
+	values := &MemIndicatorRepository{}
+	events := &MemEventRepository{}
+	repo := &MemMarketBreadthRepository{}
+	repo.Upsert(MarketBreadth{Date: date("2020-01-31"), AdLine: 5})
+	stocks := []Stock{
+		{Code: "A", OneDay: -0.1, LastUpdate: "2020-02-03T10:00:00"},
+		{Code: "B", OneDay: -0.2, LastUpdate: "2020-02-03T10:00:00"},
+		{Code: "C", OneDay: 0.3, LastUpdate: "2020-01-31T16:00:00"},
+	}
+
+	b, err := updateBreadth(stocks, values, events, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.AdLine != 3 {
+		t.Errorf("Expect A/D line 3, got %d", b.AdLine)
+	}
+
+	// a later run of the same day replaces, rather than adds to, the day's breadth
+	stocks[0].OneDay = 0.1
+	if _, err = updateBreadth(stocks, values, events, repo); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := repo.Get(date("2020-01-01"), date("2020-12-31"))
+	if len(stored) != 2 || stored[1].AdLine != 5 {
+		t.Errorf("Expect the day's A/D line to be 5, got %+v", stored)
+	}
+}
+
+func TestUpdateBreadthShouldReadTheStoredEventsAndIndicatorsOfTheDay(t *testing.T) {
+	day := date("2020-02-03")
+	values := &MemIndicatorRepository{}
+	values.Upsert([]Indicator{{Code: "A", Date: day, Values: indicators.Values{Sma20: 90, Sma50: 110}}})
+	events := &MemEventRepository{}
+	events.Upsert([]Event{{Code: "A", Date: day, Type: eventYearHigh}})
+	stocks := []Stock{{Code: "A", Last: 100, LastUpdate: "2020-02-03T10:00:00"}}
+
+	b, err := updateBreadth(stocks, values, events, &MemMarketBreadthRepository{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.NewHighs != 1 || b.AboveMa20 != 1 || b.AboveMa50 != 0 {
+		t.Errorf("Expect 1 high, 1 above MA20 and 0 above MA50, got %+v", b)
+	}
+}
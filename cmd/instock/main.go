@@ -0,0 +1,81 @@
+// Command instock runs maintenance tasks against the configured storage.
+// It reads the same environment variables as the Ingest function.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	ingest "github.com/chrishadi/instock"
+)
+
+const usage = `Usage: instock <command> [arguments]
+
+Commands:
+  load-actions FILE    load corporate actions from a csv file
+  downsample           downsample snapshots older than RETENTION_DAYS
+  breadth [DAYS]       print the market breadth of the last DAYS, 30 by default
+  events CODE [DAYS]   print the events of CODE in the last DAYS, 365 by default
+
+The commands below are also available to the bot, with underscores for dashes, e.g. /watchlist_add.
+Run "instock help" to list them.
+  alerts, alert-add, alert-delete
+  watchlists, watchlist, watchlist-add, watchlist-remove, watchlist-delete, watchlist-chat
+  trades, trade-add, trade-delete, portfolio
+  indices, index, index-add, index-delete
+  screens, screen, screen-add, screen-delete, screen-expr
+  bars, analytics
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "load-actions":
+		if len(args) != 1 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		err = ingest.LoadCorporateActions(args[0])
+	case "downsample":
+		err = ingest.Downsample(context.Background(), ingest.PubSubMessage{})
+	case "breadth":
+		days := 30
+		if len(args) > 0 {
+			if days, err = strconv.Atoi(args[0]); err != nil {
+				break
+			}
+		}
+		err = ingest.PrintBreadth(os.Stdout, days)
+	case "events":
+		if len(args) < 1 || len(args) > 2 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		days := 365
+		if len(args) > 1 {
+			if days, err = strconv.Atoi(args[1]); err != nil {
+				break
+			}
+		}
+		err = ingest.PrintEvents(os.Stdout, args[0], days)
+	default:
+		err = ingest.RunCommand(os.Stdout, cmd, args)
+		if errors.Is(err, ingest.ErrUnknownCommand) {
+			fmt.Fprintf(os.Stderr, "%v\n\n%s", err, usage)
+			os.Exit(2)
+		}
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
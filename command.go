@@ -0,0 +1,124 @@
+package ingest
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/chrishadi/instock/tbot"
+)
+
+// ErrUnknownCommand is returned by RunCommand given a command it does not know.
+var ErrUnknownCommand = errors.New("unknown command")
+
+// command is run by the CLI or the bot against the storage, and writes its output to w.
+type command struct {
+	usage string
+	run   func(w io.Writer, store *storage, args []string) error
+}
+
+// commands are registered by name, e.g. "watchlist-add", by the files that implement them.
+var commands = map[string]command{}
+
+func init() {
+	commands["help"] = command{"help", func(w io.Writer, _ *storage, _ []string) error {
+		_, err := fmt.Fprintln(w, commandUsage())
+		return err
+	}}
+}
+
+// commandUsage lists the usage of every command, ordered by name.
+func commandUsage() string {
+	usages := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		usages = append(usages, cmd.usage)
+	}
+	sort.Strings(usages)
+	return strings.Join(usages, "\n")
+}
+
+// RunCommand runs a command against the storage configured by the environment.
+func RunCommand(w io.Writer, name string, args []string) error {
+	cmd, exist := commands[name]
+	if !exist {
+		return fmt.Errorf("%w %q", ErrUnknownCommand, name)
+	}
+
+	return withStorage(func(store *storage) error {
+		return cmd.run(w, store, args)
+	})
+}
+
+// parseBotCommand parses a bot message such as "/watchlist_add@instockbot core BBCA" into the
+// command name, with underscores as dashes since bot commands cannot have dashes, and its arguments.
+func parseBotCommand(text string) (name string, args []string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", nil
+	}
+
+	name = strings.TrimPrefix(fields[0], "/")
+	if at := strings.IndexByte(name, '@'); at >= 0 {
+		name = name[:at]
+	}
+	return strings.ReplaceAll(name, "_", "-"), fields[1:]
+}
+
+// Webhook is the http function the bot posts its updates to. Commands sent from the configured chat,
+// e.g. "/watchlist_add core BBCA", are run and their output sent back to it.
+func Webhook(w http.ResponseWriter, r *http.Request) {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "misconfigured", http.StatusInternalServerError)
+		return
+	}
+
+	// without a secret anyone could run the commands, so no update is accepted
+	if len(cfg.Bot.WebhookSecret) == 0 {
+		log.Print("BOT_WEBHOOK_SECRET is not set, rejecting the update")
+		http.Error(w, "misconfigured", http.StatusInternalServerError)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(cfg.Bot.WebhookSecret)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update tbot.Update
+	if err = json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+
+	// other chats are ignored, and acknowledged so that they are not posted again
+	msg := update.Message
+	if msg == nil || msg.Chat.Id != cfg.Bot.ChatId {
+		return
+	}
+	name, args := parseBotCommand(msg.Text)
+	if len(name) == 0 {
+		return
+	}
+
+	out := &strings.Builder{}
+	if err = RunCommand(out, name, args); err != nil {
+		out.Reset()
+		out.WriteString(err.Error())
+	}
+	reply := strings.TrimSpace(out.String())
+	if len(reply) == 0 {
+		reply = "Done"
+	}
+
+	bot := tbot.New(cfg.Bot.Host, cfg.Bot.Token, msg.Chat.Id)
+	if err = sendMessage(reply, bot); err != nil {
+		log.Print(err)
+	}
+}
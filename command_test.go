@@ -0,0 +1,143 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chrishadi/instock/tbot"
+)
+
+func TestParseBotCommandShouldStripBotNameAndUseDashes(t *testing.T) {
+	name, args := parseBotCommand("/watchlist_add@instockbot core BBCA  BBRI")
+
+	if name != "watchlist-add" || !reflect.DeepEqual(args, []string{"core", "BBCA", "BBRI"}) {
+		t.Errorf("Expect watchlist-add [core BBCA BBRI], got %s %v", name, args)
+	}
+	if name, _ = parseBotCommand("hello"); name != "" {
+		t.Errorf("Expect no command, got %q", name)
+	}
+}
+
+func TestRunCommandGivenUnknownCommandShouldReturnErrUnknownCommand(t *testing.T) {
+	if err := RunCommand(&strings.Builder{}, "nope", nil); !errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("Expect unknown command error, got %v", err)
+	}
+}
+
+// memStorage returns a storage of empty in-memory repositories, wired together like the stored ones.
+func memStorage() *storage {
+	stocks := &MemStockRepository{}
+	actions := &MemCorporateActionRepository{}
+	return &storage{
+		stocks:           stocks,
+		lastUpdates:      &MemStockLastUpdateRepository{stocks: stocks},
+		history:          stocks,
+		retention:        stocks,
+		dailyBars:        &MemDailyBarRepository{actions: actions},
+		corporateActions: actions,
+		sectors:          &MemSectorPerformanceRepository{},
+		breadth:          &MemMarketBreadthRepository{},
+		indicators:       &MemIndicatorRepository{},
+		events:           &MemEventRepository{},
+		alerts:           &MemAlertRepository{},
+		watchlists:       &MemWatchlistRepository{},
+		trades:           &MemTradeRepository{},
+		portfolio:        &MemPortfolioSnapshotRepository{},
+		indices:          &MemCustomIndexRepository{},
+		indexValues:      &MemIndexValueRepository{},
+		ratios:           &MemStockRatiosRepository{},
+		screens:          &MemScreenRepository{},
+		close:            func() error { return nil },
+	}
+}
+
+// commandOutput runs the named command against store and returns its output, or its error message.
+func commandOutput(store *storage, name string, args ...string) string {
+	out := &strings.Builder{}
+	if err := commands[name].run(out, store, args); err != nil {
+		return err.Error()
+	}
+	return out.String()
+}
+
+// setUpWebhook configures the environment for a SQLite storage and a bot api server that records the sent messages.
+func setUpWebhook(t *testing.T) *[]tbot.SendMessageParams {
+	sent := &[]tbot.SendMessageParams{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params tbot.SendMessageParams
+		json.NewDecoder(r.Body).Decode(&params)
+		*sent = append(*sent, params)
+	}))
+	t.Cleanup(api.Close)
+
+	t.Setenv("STOCK_API_URL", "http://localhost")
+	t.Setenv("NUM_OF_TOP_RANK", "5")
+	t.Setenv("STORAGE", storageSQLite)
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "instock.db"))
+	t.Setenv("BOT_HOST", api.URL)
+	t.Setenv("BOT_TOKEN", "api:token")
+	t.Setenv("BOT_CHAT_ID", "123")
+	t.Setenv("BOT_WEBHOOK_SECRET", "secret")
+	return sent
+}
+
+func postUpdate(chatId int, text, secret string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(tbot.Update{Message: &tbot.Message{Chat: tbot.Chat{Id: chatId}, Text: text}})
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+	r.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	w := httptest.NewRecorder()
+	Webhook(w, r)
+	return w
+}
+
+func TestWebhookShouldRunCommandsAndReplyToTheChat(t *testing.T) {
+	sent := setUpWebhook(t)
+
+	postUpdate(123, "/watchlist_add core bbca bbri", "secret")
+	postUpdate(123, "/watchlist_remove core BBCA", "secret")
+	postUpdate(123, "/watchlist_delete other", "secret")
+
+	expected := []string{"<pre>core: BBCA BBRI</pre>", "<pre>core: BBRI</pre>", `<pre>watchlist &#34;other&#34; not found</pre>`}
+	if len(*sent) != len(expected) {
+		t.Fatalf("Expect %d replies, got %+v", len(expected), *sent)
+	}
+	for i, params := range *sent {
+		if params.ChatId != 123 || params.Text != expected[i] {
+			t.Errorf("Expect %q to chat 123, got %+v", expected[i], params)
+		}
+	}
+}
+
+func TestWebhookShouldIgnoreOtherChatsAndRejectInvalidSecret(t *testing.T) {
+	sent := setUpWebhook(t)
+
+	if w := postUpdate(456, "/watchlists", "secret"); w.Code != http.StatusOK {
+		t.Errorf("Expect other chats to be acknowledged, got %d", w.Code)
+	}
+	if w := postUpdate(123, "/watchlists", "wrong"); w.Code != http.StatusForbidden {
+		t.Errorf("Expect %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if len(*sent) != 0 {
+		t.Errorf("Expect no reply, got %+v", *sent)
+	}
+}
+
+func TestWebhookGivenNoSecretShouldRejectEveryUpdate(t *testing.T) {
+	sent := setUpWebhook(t)
+	t.Setenv("BOT_WEBHOOK_SECRET", "")
+
+	for _, secret := range []string{"", "secret"} {
+		if w := postUpdate(123, "/watchlists", secret); w.Code != http.StatusInternalServerError {
+			t.Errorf("Expect %d given secret %q, got %d", http.StatusInternalServerError, secret, w.Code)
+		}
+	}
+	if len(*sent) != 0 {
+		t.Errorf("Expect no reply, got %+v", *sent)
+	}
+}
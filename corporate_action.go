@@ -0,0 +1,251 @@
+package ingest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	actionSplit        = "split"
+	actionReverseSplit = "reverse_split"
+	actionRights       = "rights"
+	actionBonus        = "bonus"
+	actionDividend     = "dividend"
+)
+
+// CorporateAction is an event that changes the price of a code without a change in value.
+// Share ratios are given as Old:New, e.g. a 1:5 split is Old 1 and New 5.
+// Factor is the multiplier applied to prices before ExDate, resolved when the action is loaded.
+type CorporateAction struct {
+	Code   string    `pg:",pk"`
+	Type   string    `pg:",pk"`
+	ExDate time.Time `pg:",pk,type:date"`
+	Old    float64
+	New    float64
+	Price  float64
+	Amount float64
+	Factor float64
+}
+
+// shareCountChange tells whether the action changes the number of shares, and so the volume.
+func (action CorporateAction) shareCountChange() bool {
+	switch action.Type {
+	case actionSplit, actionReverseSplit, actionBonus:
+		return true
+	}
+	return false
+}
+
+// priceFactor computes the adjustment factor given the closing price before the ex-date.
+func (action CorporateAction) priceFactor(prevClose float64) (float64, error) {
+	switch action.Type {
+	case actionSplit, actionReverseSplit:
+		if action.Old <= 0 || action.New <= 0 {
+			return 0, fmt.Errorf("%s %s: invalid ratio %g:%g", action.Code, action.Type, action.Old, action.New)
+		}
+		return action.Old / action.New, nil
+	case actionBonus:
+		if action.Old <= 0 || action.New < 0 {
+			return 0, fmt.Errorf("%s %s: invalid ratio %g:%g", action.Code, action.Type, action.Old, action.New)
+		}
+		return action.Old / (action.Old + action.New), nil
+	case actionRights:
+		if action.Old <= 0 || action.New < 0 || prevClose <= 0 {
+			return 0, fmt.Errorf("%s %s: invalid ratio %g:%g or previous close %g", action.Code, action.Type, action.Old, action.New, prevClose)
+		}
+		terp := (action.Old*prevClose + action.New*action.Price) / (action.Old + action.New)
+		return terp / prevClose, nil
+	case actionDividend:
+		if prevClose <= action.Amount {
+			return 0, fmt.Errorf("%s %s: dividend %g is not less than previous close %g", action.Code, action.Type, action.Amount, prevClose)
+		}
+		return (prevClose - action.Amount) / prevClose, nil
+	default:
+		return 0, fmt.Errorf("%s: unknown corporate action type %q", action.Code, action.Type)
+	}
+}
+
+// parseCorporateActions reads a csv with the header
+// code,type,ex_date,old,new,price,amount where ex_date is formatted as 2006-01-02.
+// Empty numeric cells are read as zero.
+func parseCorporateActions(r io.Reader) ([]CorporateAction, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	actions := make([]CorporateAction, 0, len(records)-1)
+	for i, rec := range records[1:] {
+		if len(rec) != 7 {
+			return nil, fmt.Errorf("line %d: expect 7 fields, got %d", i+2, len(rec))
+		}
+
+		exDate, err := time.Parse("2006-01-02", strings.TrimSpace(rec[2]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+
+		var nums [4]float64
+		for j := range nums {
+			cell := strings.TrimSpace(rec[3+j])
+			if len(cell) == 0 {
+				continue
+			}
+			if nums[j], err = strconv.ParseFloat(cell, 64); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+2, err)
+			}
+		}
+
+		actions = append(actions, CorporateAction{
+			Code:   strings.TrimSpace(rec[0]),
+			Type:   strings.ToLower(strings.TrimSpace(rec[1])),
+			ExDate: exDate,
+			Old:    nums[0],
+			New:    nums[1],
+			Price:  nums[2],
+			Amount: nums[3],
+		})
+	}
+
+	return actions, nil
+}
+
+// actionCloseDays is how many days before its ex-date the close a rights issue or a dividend
+// is priced against may be, to span holidays.
+const actionCloseDays = 14
+
+// resolveFactors returns the actions with their factor set. Rights and dividends need the last close
+// before the ex-date, which is looked up in the stored daily bars, fetched once for all actions.
+// Actions that cannot be resolved, e.g. without a close, are skipped and their errors returned.
+func resolveFactors(actions []CorporateAction, bars DailyBarRepository) (resolved []CorporateAction, skipped []error, err error) {
+	var from time.Time
+	needClose := make(map[string]bool)
+	for _, action := range actions {
+		if action.Type == actionRights || action.Type == actionDividend {
+			needClose[action.Code] = true
+			if start := action.ExDate.AddDate(0, 0, -actionCloseDays); from.IsZero() || start.Before(from) {
+				from = start
+			}
+		}
+	}
+
+	byCode := make(map[string][]Bar)
+	if len(needClose) > 0 {
+		history, err := bars.Since(from)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, bar := range history {
+			if needClose[bar.Code] {
+				byCode[bar.Code] = append(byCode[bar.Code], bar)
+			}
+		}
+	}
+
+	for _, action := range actions {
+		var prevClose float64
+		if action.Type == actionRights || action.Type == actionDividend {
+			if prevClose = closeBefore(byCode[action.Code], action.ExDate); prevClose <= 0 {
+				skipped = append(skipped, fmt.Errorf("%s %s on %s: no close in the %d days before the ex-date",
+					action.Code, action.Type, action.ExDate.Format("2006-01-02"), actionCloseDays))
+				continue
+			}
+		}
+
+		factor, err := action.priceFactor(prevClose)
+		if err != nil {
+			skipped = append(skipped, err)
+			continue
+		}
+		action.Factor = factor
+		resolved = append(resolved, action)
+	}
+
+	return resolved, skipped, nil
+}
+
+// closeBefore returns the close of the last of bars, oldest first, in the days before day, or zero if there is none.
+func closeBefore(bars []Bar, day time.Time) float64 {
+	from := day.AddDate(0, 0, -actionCloseDays)
+	for i := len(bars) - 1; i >= 0; i-- {
+		if bars[i].Date.Before(day) {
+			if bars[i].Date.Before(from) {
+				return 0
+			}
+			return float64(bars[i].Close)
+		}
+	}
+	return 0
+}
+
+// adjustBars returns copies of the daily bars of a code with prices and volume adjusted
+// for the actions that went ex after each bar up to asOf, so that prices are continuous up to that day.
+func adjustBars(bars []Bar, actions []CorporateAction, asOf time.Time) []Bar {
+	res := make([]Bar, len(bars))
+	for i, bar := range bars {
+		price, volume := 1.0, 1.0
+		for _, action := range actions {
+			if action.Code != bar.Code || !action.ExDate.After(bar.Date) || action.ExDate.After(asOf) {
+				continue
+			}
+			price *= action.Factor
+			if action.shareCountChange() {
+				volume *= action.Factor
+			}
+		}
+
+		bar.Open = float32(float64(bar.Open) * price)
+		bar.High = float32(float64(bar.High) * price)
+		bar.Low = float32(float64(bar.Low) * price)
+		bar.Close = float32(float64(bar.Close) * price)
+		bar.Volume /= volume
+		res[i] = bar
+	}
+
+	return res
+}
+
+// LoadCorporateActions loads the corporate actions csv file at path into the configured storage.
+// Actions that cannot be resolved are logged and skipped.
+func LoadCorporateActions(path string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	actions, err := parseCorporateActions(f)
+	if err != nil {
+		return err
+	}
+
+	resolved, skipped, err := resolveFactors(actions, store.dailyBars)
+	if err != nil {
+		return err
+	}
+	for _, err := range skipped {
+		log.Print("skipped ", err)
+	}
+
+	return store.corporateActions.Upsert(resolved)
+}
@@ -0,0 +1,123 @@
+package ingest
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestParseCorporateActionsShouldReadEveryRecordAfterTheHeader(t *testing.T) {
+	csv := "code,type,ex_date,old,new,price,amount\n" +
+		"A,Split,2020-02-03,1,5,,\n" +
+		"B,dividend,2020-02-04,,,,25\n"
+
+	expected := []CorporateAction{
+		{Code: "A", Type: actionSplit, ExDate: date("2020-02-03"), Old: 1, New: 5},
+		{Code: "B", Type: actionDividend, ExDate: date("2020-02-04"), Amount: 25},
+	}
+	actual, err := parseCorporateActions(strings.NewReader(csv))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func TestParseCorporateActionsGivenInvalidDateShouldReturnError(t *testing.T) {
+	csv := "code,type,ex_date,old,new,price,amount\nA,split,03/02/2020,1,5,,\n"
+
+	_, err := parseCorporateActions(strings.NewReader(csv))
+
+	if err == nil {
+		t.Error("Expect error not to be nil")
+	}
+}
+
+func TestPriceFactorShouldDependOnActionType(t *testing.T) {
+	tests := []struct {
+		action    CorporateAction
+		prevClose float64
+		expected  float64
+	}{
+		{CorporateAction{Type: actionSplit, Old: 1, New: 5}, 0, 0.2},
+		{CorporateAction{Type: actionReverseSplit, Old: 10, New: 1}, 0, 10},
+		{CorporateAction{Type: actionBonus, Old: 4, New: 1}, 0, 0.8},
+		{CorporateAction{Type: actionRights, Old: 2, New: 1, Price: 700}, 1000, 0.9},
+		{CorporateAction{Type: actionDividend, Amount: 50}, 1000, 0.95},
+	}
+
+	for _, test := range tests {
+		actual, err := test.action.priceFactor(test.prevClose)
+		if err != nil {
+			t.Error(err)
+		}
+		if !almostEqual(actual, test.expected) {
+			t.Errorf("%s: expect %g, got %g", test.action.Type, test.expected, actual)
+		}
+	}
+}
+
+func TestPriceFactorGivenUnknownTypeShouldReturnError(t *testing.T) {
+	_, err := CorporateAction{Type: "merger"}.priceFactor(100)
+
+	if err == nil {
+		t.Error("Expect error not to be nil")
+	}
+}
+
+func TestResolveFactorsShouldUseLastCloseBeforeExDateAndSkipActionsWithoutOne(t *testing.T) {
+	bars := &MemDailyBarRepository{}
+	bars.Upsert([]Bar{
+		{Code: "A", Date: date("2020-02-02"), Close: 1000},
+		{Code: "A", Date: date("2020-02-03"), Close: 950},
+		{Code: "B", Date: date("2020-01-02"), Close: 500},
+	})
+	actions := []CorporateAction{
+		{Code: "A", Type: actionDividend, ExDate: date("2020-02-03"), Amount: 50},
+		{Code: "B", Type: actionDividend, ExDate: date("2020-02-03"), Amount: 10},
+		{Code: "C", Type: actionSplit, ExDate: date("2020-02-03"), Old: 1, New: 2},
+	}
+
+	resolved, skipped, err := resolveFactors(actions, bars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resolved) != 2 || resolved[0].Code != "A" || !almostEqual(resolved[0].Factor, 0.95) ||
+		resolved[1].Code != "C" || resolved[1].Factor != 0.5 {
+		t.Errorf("Expect A with factor 0.95 and C with 0.5, got %+v", resolved)
+	}
+	if len(skipped) != 1 || !strings.HasPrefix(skipped[0].Error(), "B dividend on 2020-02-03: no close") {
+		t.Errorf("Expect B skipped for lack of a recent close, got %v", skipped)
+	}
+}
+
+func TestAdjustedDailyShouldMakePricesContinuousAcrossASplit(t *testing.T) {
+	actions := &MemCorporateActionRepository{}
+	actions.Upsert([]CorporateAction{{Code: "A", Type: actionSplit, ExDate: date("2020-02-03"), Old: 1, New: 5, Factor: 0.2}})
+	repo := &MemDailyBarRepository{actions: actions}
+	repo.Upsert([]Bar{
+		{Code: "A", Date: date("2020-01-31"), Open: 990, High: 1010, Low: 980, Close: 1000, Volume: 100, Value: 100000},
+		{Code: "A", Date: date("2020-02-03"), Open: 200, High: 212, Low: 198, Close: 210, Volume: 500, Value: 105000},
+	})
+
+	bars, err := repo.AdjustedDaily("A", date("2020-01-01"), date("2020-02-04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Bar{
+		{Code: "A", Date: date("2020-01-31"), Open: 198, High: 202, Low: 196, Close: 200, Volume: 500, Value: 100000},
+		{Code: "A", Date: date("2020-02-03"), Open: 200, High: 212, Low: 198, Close: 210, Volume: 500, Value: 105000},
+	}
+	if !reflect.DeepEqual(bars, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, bars)
+	}
+}
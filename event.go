@@ -0,0 +1,74 @@
+package ingest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event types
+const (
+	eventYearHigh    = "52w_high"
+	eventYearLow     = "52w_low"
+	eventAllTimeHigh = "all_time_high"
+)
+
+// Event records that a stock did something notable on a trading day, e.g. set a new high.
+// Value is what triggered the event, e.g. the high price, and Reference what it is compared to,
+// e.g. the previous high.
+type Event struct {
+	Code      string    `pg:",pk"`
+	Date      time.Time `pg:",pk,type:date"`
+	Type      string    `pg:",pk"`
+	Value     float64   `pg:",use_zero"`
+	Reference float64   `pg:",use_zero"`
+}
+
+// eventCodes returns the codes of the events of the given type.
+func eventCodes(events []Event, eventType string) []string {
+	var codes []string
+	for _, e := range events {
+		if e.Type == eventType {
+			codes = append(codes, e.Code)
+		}
+	}
+	return codes
+}
+
+// PrintEvents writes the events of a code in the last days, oldest first, followed by their count per type.
+func PrintEvents(w io.Writer, code string, days int) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	to := tradingDay(time.Now())
+	events, err := store.events.Get(code, to.AddDate(0, 0, -days), to)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"Date", "Type", "Value", "Reference"}}
+	counts := make(map[string]int)
+	for _, e := range events {
+		rows = append(rows, []string{e.Date.Format("2006-01-02"), e.Type, fmt.Sprintf("%g", e.Value), fmt.Sprintf("%g", e.Reference)})
+		counts[e.Type]++
+	}
+
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, fmt.Sprintf("%s: %d", t, counts[t]))
+	}
+	sort.Strings(types)
+
+	_, err = fmt.Fprintf(w, "%s\n%s\n", alignColumns(rows, []bool{false, false, true, true}), strings.Join(types, ", "))
+	return err
+}
@@ -0,0 +1,68 @@
+package ingest
+
+import "time"
+
+// PriceExtremes are the highest and lowest prices of a code in its daily bars, adjusted for corporate actions.
+// YearLow ignores zero prices, i.e. of days without trade.
+type PriceExtremes struct {
+	Code        string
+	YearHigh    float32
+	YearLow     float32
+	AllTimeHigh float32
+}
+
+// extremeSections are the report sections of the extreme events, in order.
+var extremeSections = []struct {
+	eventType string
+	title     string
+}{
+	{eventAllTimeHigh, "All-time highs"},
+	{eventYearHigh, "52-week highs"},
+	{eventYearLow, "52-week lows"},
+}
+
+// detectExtremes returns the events of stocks that broke their extremes of the past year or all time.
+// Stocks without history, e.g. new listings, have no extremes to break.
+func detectExtremes(stocks []Stock, day time.Time, extremes []PriceExtremes) []Event {
+	byCode := make(map[string]PriceExtremes, len(extremes))
+	for _, e := range extremes {
+		byCode[e.Code] = e
+	}
+
+	var events []Event
+	for _, s := range stocks {
+		e, exist := byCode[s.Code]
+		if !exist {
+			continue
+		}
+
+		if e.AllTimeHigh > 0 && s.AdjustedHighPrice > e.AllTimeHigh {
+			events = append(events, Event{s.Code, day, eventAllTimeHigh, float64(s.AdjustedHighPrice), float64(e.AllTimeHigh)})
+		}
+		if e.YearHigh > 0 && s.AdjustedHighPrice > e.YearHigh {
+			events = append(events, Event{s.Code, day, eventYearHigh, float64(s.AdjustedHighPrice), float64(e.YearHigh)})
+		}
+		if e.YearLow > 0 && s.AdjustedLowPrice > 0 && s.AdjustedLowPrice < e.YearLow {
+			events = append(events, Event{s.Code, day, eventYearLow, float64(s.AdjustedLowPrice), float64(e.YearLow)})
+		}
+	}
+
+	return events
+}
+
+// updateExtremeEvents detects the stocks of the latest trading day of the batch that set new highs or lows,
+// compared to their history before that day, and stores them as events.
+func updateExtremeEvents(stocks []Stock, bars DailyBarRepository, repo EventRepository) ([]Event, error) {
+	current, day, err := currentStocks(stocks)
+	if err != nil || len(current) == 0 {
+		return nil, err
+	}
+
+	extremes, err := bars.Extremes(day.AddDate(-1, 0, 0), day)
+	if err != nil {
+		return nil, err
+	}
+
+	events := detectExtremes(current, day, extremes)
+	return events, repo.Upsert(events)
+}
@@ -0,0 +1,78 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectExtremesShouldReportBrokenHighsAndLows(t *testing.T) {
+	day := date("2020-02-03")
+	stocks := []Stock{
+		{Code: "A", AdjustedHighPrice: 110, AdjustedLowPrice: 100},
+		{Code: "B", AdjustedHighPrice: 90, AdjustedLowPrice: 40},
+		{Code: "C", AdjustedHighPrice: 60, AdjustedLowPrice: 0},
+		{Code: "D", AdjustedHighPrice: 1000, AdjustedLowPrice: 1},
+	}
+	extremes := []PriceExtremes{
+		{Code: "A", YearHigh: 105, YearLow: 80, AllTimeHigh: 108},
+		{Code: "B", YearHigh: 85, YearLow: 50, AllTimeHigh: 200},
+		{Code: "C", YearHigh: 70, YearLow: 50, AllTimeHigh: 70},
+	}
+
+	actual := detectExtremes(stocks, day, extremes)
+
+	expected := []Event{
+		{"A", day, eventAllTimeHigh, 110, 108},
+		{"A", day, eventYearHigh, 110, 105},
+		{"B", day, eventYearHigh, 90, 85},
+		{"B", day, eventYearLow, 40, 50},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func TestUpdateExtremeEventsShouldCompareToHistoryBeforeTheDay(t *testing.T) {
+	bars := &MemDailyBarRepository{}
+	bars.Upsert([]Bar{
+		{Code: "A", Date: date("2018-12-31"), High: 200, Low: 10},
+		{Code: "A", Date: date("2019-06-03"), High: 100, Low: 90},
+		{Code: "A", Date: date("2020-02-03"), High: 150, Low: 80},
+	})
+	repo := &MemEventRepository{}
+	stocks := []Stock{{Code: "A", AdjustedHighPrice: 160, AdjustedLowPrice: 80, LastUpdate: "2020-02-03T16:00:00"}}
+
+	actual, err := updateExtremeEvents(stocks, bars, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := date("2020-02-03")
+	expected := []Event{{"A", day, eventYearHigh, 160, 100}, {"A", day, eventYearLow, 80, 90}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+	if stored, _ := repo.Get("A", day, day); !reflect.DeepEqual(stored, expected) {
+		t.Errorf("Expect %+v stored, got %+v", expected, stored)
+	}
+}
+
+func TestUpdateExtremeEventsGivenSplitGoingExAfterTheDayShouldNotAdjustTheHistory(t *testing.T) {
+	actions := &MemCorporateActionRepository{}
+	actions.Upsert([]CorporateAction{{Code: "A", Type: actionSplit, ExDate: date("2020-03-02"), Old: 1, New: 2, Factor: 0.5}})
+	bars := &MemDailyBarRepository{actions: actions}
+	bars.Upsert([]Bar{
+		{Code: "A", Date: date("2019-06-03"), High: 200, Low: 90},
+		{Code: "A", Date: date("2020-01-31"), High: 150, Low: 100},
+	})
+	stocks := []Stock{{Code: "A", AdjustedHighPrice: 160, AdjustedLowPrice: 95, LastUpdate: "2020-02-03T16:00:00"}}
+
+	actual, err := updateExtremeEvents(stocks, bars, &MemEventRepository{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 0 {
+		t.Errorf("Expect no events, got %+v", actual)
+	}
+}
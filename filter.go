@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RankFilter excludes stocks from rankings, e.g. illiquid ones. Zero values disable a criterion.
+type RankFilter struct {
+	MinValue       float64  `split_words:"true"`
+	MinVolume      float64  `split_words:"true"`
+	MinPrice       float32  `split_words:"true"`
+	Sectors        []uint   // sector ids to include
+	ExcludeSectors []uint   `split_words:"true"`
+	Codes          []string // codes to include
+	Watchlist      string   // name of a saved watchlist whose codes to include
+
+	// watchlistCodes are the codes of Watchlist, once resolved
+	watchlistCodes []string
+}
+
+// resolve returns the filter with the codes of its watchlist, which must exist.
+func (f RankFilter) resolve(watchlists WatchlistRepository) (RankFilter, error) {
+	if len(f.Watchlist) == 0 {
+		return f, nil
+	}
+
+	wl, err := watchlists.Get(f.Watchlist)
+	if err != nil {
+		return f, err
+	}
+	if wl == nil {
+		return f, fmt.Errorf("rank watchlist %q not found", f.Watchlist)
+	}
+	f.watchlistCodes = wl.Codes
+	return f, nil
+}
+
+func (f RankFilter) apply(stocks []Stock) []Stock {
+	if f.isEmpty() {
+		return stocks
+	}
+
+	include := toSet(f.Sectors)
+	exclude := toSet(f.ExcludeSectors)
+	codes := toSet(append(append([]string(nil), f.Codes...), f.watchlistCodes...))
+	restrictCodes := len(f.Codes) > 0 || len(f.Watchlist) > 0
+
+	res := make([]Stock, 0, len(stocks))
+	for _, s := range stocks {
+		if s.Value < f.MinValue || s.Volume < f.MinVolume || s.Last < f.MinPrice {
+			continue
+		}
+		if len(include) > 0 && !include[s.SectorId] {
+			continue
+		}
+		if exclude[s.SectorId] {
+			continue
+		}
+		if restrictCodes && !codes[s.Code] {
+			continue
+		}
+		res = append(res, s)
+	}
+
+	return res
+}
+
+func (f RankFilter) isEmpty() bool {
+	return f.MinValue == 0 && f.MinVolume == 0 && f.MinPrice == 0 &&
+		len(f.Sectors) == 0 && len(f.ExcludeSectors) == 0 && len(f.Codes) == 0 && len(f.Watchlist) == 0
+}
+
+// String describes the criteria in effect, or returns an empty string if there is none.
+func (f RankFilter) String() string {
+	var criteria []string
+	if f.MinValue > 0 {
+		criteria = append(criteria, fmt.Sprintf("value >= %g", f.MinValue))
+	}
+	if f.MinVolume > 0 {
+		criteria = append(criteria, fmt.Sprintf("volume >= %g", f.MinVolume))
+	}
+	if f.MinPrice > 0 {
+		criteria = append(criteria, fmt.Sprintf("price >= %g", f.MinPrice))
+	}
+	if len(f.Sectors) > 0 {
+		criteria = append(criteria, fmt.Sprintf("sectors %v", f.Sectors))
+	}
+	if len(f.ExcludeSectors) > 0 {
+		criteria = append(criteria, fmt.Sprintf("excluding sectors %v", f.ExcludeSectors))
+	}
+	if len(f.Codes) > 0 {
+		criteria = append(criteria, fmt.Sprintf("%d codes", len(f.Codes)))
+	}
+	if len(f.Watchlist) > 0 {
+		criteria = append(criteria, "watchlist "+f.Watchlist)
+	}
+	return strings.Join(criteria, ", ")
+}
+
+func toSet[T comparable](values []T) map[T]bool {
+	set := make(map[T]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
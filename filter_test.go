@@ -0,0 +1,79 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+)
+
+var filterStocks = []Stock{
+	{Code: "A", SectorId: 1, Last: 1000, Volume: 1000, Value: 1e6},
+	{Code: "B", SectorId: 2, Last: 50, Volume: 1000, Value: 5e4},
+	{Code: "C", SectorId: 3, Last: 200, Volume: 10, Value: 2e3},
+	{Code: "D", SectorId: 2, Last: 500, Volume: 500, Value: 2.5e5},
+}
+
+func TestRankFilterApplyShouldKeepStocksMatchingAllCriteria(t *testing.T) {
+	tests := []struct {
+		filter   RankFilter
+		expected []string
+	}{
+		{RankFilter{}, []string{"A", "B", "C", "D"}},
+		{RankFilter{MinValue: 1e5}, []string{"A", "D"}},
+		{RankFilter{MinVolume: 100}, []string{"A", "B", "D"}},
+		{RankFilter{MinPrice: 100}, []string{"A", "C", "D"}},
+		{RankFilter{Sectors: []uint{2, 3}}, []string{"B", "C", "D"}},
+		{RankFilter{ExcludeSectors: []uint{2}}, []string{"A", "C"}},
+		{RankFilter{Codes: []string{"B", "C"}}, []string{"B", "C"}},
+		{RankFilter{MinPrice: 100, Sectors: []uint{2}}, []string{"D"}},
+	}
+
+	for _, test := range tests {
+		actual := extractCodes(test.filter.apply(filterStocks))
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%+v: expect %v, got %v", test.filter, test.expected, actual)
+		}
+	}
+}
+
+func TestRankFilterStringShouldDescribeCriteria(t *testing.T) {
+	filter := RankFilter{MinValue: 1e9, MinPrice: 50, ExcludeSectors: []uint{9}, Codes: []string{"A", "B"}}
+
+	expected := "value >= 1e+09, price >= 50, excluding sectors [9], 2 codes"
+	if actual := filter.String(); actual != expected {
+		t.Errorf("Expect %q, got %q", expected, actual)
+	}
+}
+
+func TestRankFilterStringGivenNoCriteriaShouldBeEmpty(t *testing.T) {
+	if actual := (RankFilter{}).String(); actual != "" {
+		t.Errorf("Expect empty string, got %q", actual)
+	}
+}
+
+func TestRankFilterResolveShouldIncludeTheCodesOfTheWatchlist(t *testing.T) {
+	watchlists := &MemWatchlistRepository{}
+	watchlists.Save(Watchlist{Name: "core", Codes: []string{"C", "D"}})
+
+	filter, err := RankFilter{Codes: []string{"A"}, Watchlist: "core"}.resolve(watchlists)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []string{"A", "C", "D"}, extractCodes(filter.apply(filterStocks)); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+	if expected, actual := "1 codes, watchlist core", filter.String(); actual != expected {
+		t.Errorf("Expect %q, got %q", expected, actual)
+	}
+}
+
+func TestRankFilterResolveGivenUnknownWatchlistShouldReturnErrorAndRankNoStock(t *testing.T) {
+	filter, err := RankFilter{Watchlist: "core"}.resolve(&MemWatchlistRepository{})
+
+	if err == nil || err.Error() != `rank watchlist "core" not found` {
+		t.Errorf("Expect watchlist not found, got %v", err)
+	}
+	if actual := filter.apply(filterStocks); len(actual) != 0 {
+		t.Errorf("Expect no stocks, got %v", extractCodes(actual))
+	}
+}
@@ -0,0 +1,372 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Index weightings
+const (
+	weightEqual = "equal"
+	weightPrice = "price"
+	weightCap   = "cap"
+)
+
+const (
+	defaultIndexBase = 100
+	sectorPrefix     = "sector:"
+)
+
+// CustomIndex is an index over a list of codes, or over the stocks of a sector if SectorId is not zero.
+// It was BaseValue as of the previous close of BaseDate, the first trading day it was computed on.
+type CustomIndex struct {
+	Name      string `pg:",pk"`
+	Weighting string
+	Codes     []string  `pg:",array"`
+	SectorId  uint      `pg:",use_zero"`
+	BaseDate  time.Time `pg:"type:date"`
+	BaseValue float64   `pg:",use_zero"`
+}
+
+// IndexValue is the value of a custom index at the end of a trading day, or as of the last run of the day.
+// Divisor scales the weighted sum of the prices of the members to the value. It is adjusted every day,
+// so that changes of the members or of their weights do not change the value.
+type IndexValue struct {
+	Name    string    `pg:",pk"`
+	Date    time.Time `pg:",pk,type:date"`
+	Value   float64   `pg:",use_zero"`
+	Change  float64   `pg:",use_zero"`
+	Divisor float64   `pg:",use_zero"`
+	Members int       `pg:",use_zero"`
+}
+
+// indexUnits returns the units of a stock an index holds, its weighted sum being the sum of the units
+// times the prices: a share for price weight, the shares outstanding for market cap weight, and shares
+// worth 1 at the previous close for equal weight. Stocks without prices or capitalization are left out.
+func indexUnits(weighting string, s Stock) float64 {
+	if s.Last <= 0 || s.PrevClosingPrice <= 0 {
+		return 0
+	}
+
+	switch weighting {
+	case weightPrice:
+		return 1
+	case weightCap:
+		return s.Capitalization / float64(s.Last)
+	case weightEqual:
+		return 1 / float64(s.PrevClosingPrice)
+	}
+	return 0
+}
+
+// members returns the stocks of the index, in the order of its codes or of stocks for a sector.
+func (ix CustomIndex) members(stocks []Stock) []Stock {
+	var res []Stock
+	if ix.SectorId != 0 {
+		for _, s := range stocks {
+			if s.SectorId == ix.SectorId {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+
+	byCode := make(map[string]Stock, len(stocks))
+	for _, s := range stocks {
+		byCode[s.Code] = s
+	}
+	for _, code := range ix.Codes {
+		if s, exist := byCode[code]; exist {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// computeIndex computes the value of the index on day from the stocks of the day. The divisor is set so
+// that the index at the previous close of its members is the previous value, or the base value if there
+// is none, carried by the move of the members from prevCloses, their closes of the day of the previous
+// value, to their previous close. The move covers the days the index was not computed on, and the prices
+// after the last run of the previous day. It returns false if the index has no members with prices.
+func computeIndex(ix CustomIndex, stocks []Stock, day time.Time, prev *IndexValue, prevCloses map[string]float32) (IndexValue, bool) {
+	var sum, prevSum, linkedSum, linkedPrevSum float64
+	members := 0
+	for _, s := range ix.members(stocks) {
+		units := indexUnits(ix.Weighting, s)
+		if units <= 0 {
+			continue
+		}
+		sum += units * float64(s.Last)
+		prevSum += units * float64(s.PrevClosingPrice)
+		members++
+
+		if c := prevCloses[s.Code]; c > 0 {
+			linkedSum += units * float64(c)
+			linkedPrevSum += units * float64(s.PrevClosingPrice)
+		}
+	}
+	if members == 0 {
+		return IndexValue{}, false
+	}
+
+	prevValue, linkValue := ix.BaseValue, ix.BaseValue
+	if prev != nil {
+		prevValue, linkValue = prev.Value, prev.Value
+		if linkedSum > 0 {
+			linkValue *= linkedPrevSum / linkedSum
+		}
+	}
+
+	val := IndexValue{Name: ix.Name, Date: day, Divisor: prevSum / linkValue, Members: members}
+	val.Value = sum / val.Divisor
+	val.Change = val.Value/prevValue - 1
+	return val, true
+}
+
+// closesOn returns the closes of the daily bars of every code by day, for the days of values.
+func closesOn(values []IndexValue, bars DailyBarRepository) (map[string]map[string]float32, error) {
+	closes := make(map[string]map[string]float32)
+	if len(values) == 0 {
+		return closes, nil
+	}
+
+	from := values[0].Date
+	for _, v := range values {
+		closes[v.Date.Format("2006-01-02")] = make(map[string]float32)
+		if v.Date.Before(from) {
+			from = v.Date
+		}
+	}
+
+	since, err := bars.Since(from)
+	if err != nil {
+		return nil, err
+	}
+	for _, bar := range since {
+		if byCode, exist := closes[bar.Date.Format("2006-01-02")]; exist {
+			byCode[bar.Code] = bar.Close
+		}
+	}
+	return closes, nil
+}
+
+// updateIndices computes every custom index from the current stocks of the batch and stores their values
+// of the day. An index computed for the first time is based on the day. The daily bars link each index
+// to its previous value.
+func updateIndices(stocks []Stock, indices CustomIndexRepository, values IndexValueRepository, bars DailyBarRepository) ([]IndexValue, error) {
+	list, err := indices.List()
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+
+	current, day, err := currentStocks(stocks)
+	if err != nil {
+		return nil, err
+	}
+
+	prevs, err := values.Before(day)
+	if err != nil {
+		return nil, err
+	}
+	prevByName := make(map[string]*IndexValue, len(prevs))
+	for i := range prevs {
+		prevByName[prevs[i].Name] = &prevs[i]
+	}
+	closes, err := closesOn(prevs, bars)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []IndexValue
+	for _, ix := range list {
+		var prevCloses map[string]float32
+		prev := prevByName[ix.Name]
+		if prev != nil {
+			prevCloses = closes[prev.Date.Format("2006-01-02")]
+		}
+		val, ok := computeIndex(ix, current, day, prev, prevCloses)
+		if !ok {
+			continue
+		}
+		if ix.BaseDate.IsZero() {
+			ix.BaseDate = day
+			if err = indices.Save(ix); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, val)
+	}
+
+	return res, values.Upsert(res)
+}
+
+func formatIndexTable(values []IndexValue) string {
+	rows := [][]string{{"Index", "Value", "Change", "Members"}}
+	for _, v := range values {
+		rows = append(rows, []string{v.Name, fmt.Sprintf("%.2f", v.Value), formatPercent(v.Change), strconv.Itoa(v.Members)})
+	}
+	return alignColumns(rows, []bool{false, true, true, true})
+}
+
+func init() {
+	commands["indices"] = command{"indices: list the custom indices", listIndices}
+	commands["index"] = command{"index NAME [DAYS]: print the values of a custom index in the last DAYS, 30 by default", showIndex}
+	commands["index-add"] = command{"index-add NAME equal|price|cap [BASE_VALUE] CODE...|sector:ID: define a custom index, or change the members and weighting of one", addIndex}
+	commands["index-delete"] = command{"index-delete NAME: delete a custom index and its values", deleteIndex}
+}
+
+func listIndices(w io.Writer, store *storage, _ []string) error {
+	indices, err := store.indices.List()
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"Name", "Weighting", "Members", "Base"}}
+	for _, ix := range indices {
+		base := fmt.Sprintf("%g", ix.BaseValue)
+		if !ix.BaseDate.IsZero() {
+			base += " on " + ix.BaseDate.Format("2006-01-02")
+		}
+		rows = append(rows, []string{ix.Name, ix.Weighting, ix.membersString(), base})
+	}
+	_, err = fmt.Fprintln(w, alignColumns(rows, []bool{false, false, false, false}))
+	return err
+}
+
+func (ix CustomIndex) membersString() string {
+	if ix.SectorId != 0 {
+		return sectorPrefix + strconv.FormatUint(uint64(ix.SectorId), 10)
+	}
+	return strings.Join(ix.Codes, " ")
+}
+
+func showIndex(w io.Writer, store *storage, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: index NAME [DAYS]")
+	}
+
+	days := 30
+	if len(args) > 1 {
+		var err error
+		if days, err = strconv.Atoi(args[1]); err != nil || days <= 0 {
+			return fmt.Errorf("invalid days %q", args[1])
+		}
+	}
+
+	ix, err := getIndex(store, args[0])
+	if err != nil {
+		return err
+	}
+	values, err := store.indexValues.Get(ix.Name, tradingDay(time.Now()).AddDate(0, 0, -days))
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"Date", "Value", "Change", "Divisor", "Members"}}
+	for _, v := range values {
+		rows = append(rows, []string{
+			v.Date.Format("2006-01-02"), fmt.Sprintf("%.2f", v.Value), formatPercent(v.Change),
+			fmt.Sprintf("%.6g", v.Divisor), strconv.Itoa(v.Members),
+		})
+	}
+	_, err = fmt.Fprintf(w, "%s (%s, %s)\n%s\n", ix.Name, ix.Weighting, ix.membersString(), alignColumns(rows, []bool{false, true, true, true, true}))
+	return err
+}
+
+func addIndex(w io.Writer, store *storage, args []string) error {
+	if len(args) < 3 {
+		return errors.New("usage: index-add NAME equal|price|cap [BASE_VALUE] CODE...|sector:ID")
+	}
+
+	ix, err := parseIndex(args)
+	if err != nil {
+		return err
+	}
+
+	// an existing index keeps its base, the divisor keeps its values continuous
+	stored, err := store.indices.Get(ix.Name)
+	if err != nil {
+		return err
+	}
+	if stored != nil {
+		ix.BaseDate, ix.BaseValue = stored.BaseDate, stored.BaseValue
+	}
+
+	if err = store.indices.Save(ix); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s: %s weighted %s, base %g\n", ix.Name, ix.Weighting, ix.membersString(), ix.BaseValue)
+	return err
+}
+
+// parseIndex parses the arguments of index-add. A number following the weighting is the base value.
+func parseIndex(args []string) (CustomIndex, error) {
+	ix := CustomIndex{Name: args[0], Weighting: strings.ToLower(args[1]), BaseValue: defaultIndexBase}
+	switch ix.Weighting {
+	case weightEqual, weightPrice, weightCap:
+	default:
+		return ix, fmt.Errorf("invalid weighting %q, expect equal, price or cap", args[1])
+	}
+
+	members := args[2:]
+	if base, err := strconv.ParseFloat(members[0], 64); err == nil {
+		if base <= 0 {
+			return ix, fmt.Errorf("invalid base value %q", members[0])
+		}
+		ix.BaseValue = base
+		members = members[1:]
+	}
+	if len(members) == 0 {
+		return ix, errors.New("no codes or sector given")
+	}
+
+	if strings.HasPrefix(strings.ToLower(members[0]), sectorPrefix) {
+		sectorId, err := strconv.ParseUint(members[0][len(sectorPrefix):], 10, 32)
+		if err != nil || sectorId == 0 || len(members) > 1 {
+			return ix, fmt.Errorf("invalid sector %q, expect a single sector:ID", strings.Join(members, " "))
+		}
+		ix.SectorId = uint(sectorId)
+		return ix, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range members {
+		code = strings.ToUpper(code)
+		if !seen[code] {
+			seen[code] = true
+			ix.Codes = append(ix.Codes, code)
+		}
+	}
+	return ix, nil
+}
+
+func deleteIndex(w io.Writer, store *storage, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: index-delete NAME")
+	}
+
+	if _, err := getIndex(store, args[0]); err != nil {
+		return err
+	}
+	if err := store.indexValues.Delete(args[0]); err != nil {
+		return err
+	}
+	if err := store.indices.Delete(args[0]); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Deleted %s\n", args[0])
+	return err
+}
+
+// getIndex returns the custom index of the given name, or an error if there is none.
+func getIndex(store *storage, name string) (*CustomIndex, error) {
+	ix, err := store.indices.Get(name)
+	if err == nil && ix == nil {
+		err = fmt.Errorf("index %q not found", name)
+	}
+	return ix, err
+}
@@ -0,0 +1,161 @@
+package ingest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var indexStocks = []Stock{
+	{Code: "A", SectorId: 1, Last: 110, PrevClosingPrice: 100, Capitalization: 1100, LastUpdate: "2020-02-03T16:00:00"},
+	{Code: "B", SectorId: 1, Last: 180, PrevClosingPrice: 200, Capitalization: 5400, LastUpdate: "2020-02-03T16:00:00"},
+	{Code: "C", SectorId: 2, Last: 50, PrevClosingPrice: 50, Capitalization: 500, LastUpdate: "2020-02-03T16:00:00"},
+}
+
+func TestComputeIndexShouldWeightTheMembers(t *testing.T) {
+	day := date("2020-02-03")
+	tests := map[string]struct {
+		weighting string
+		value     float64
+	}{
+		// (110 + 180) / (100 + 200)
+		"price": {weightPrice, 96.666666666},
+		// (10 * 110 + 30 * 180) / (10 * 100 + 30 * 200)
+		"cap": {weightCap, 92.857142857},
+		// (1.1 + 0.9) / 2
+		"equal": {weightEqual, 100},
+	}
+
+	for name, test := range tests {
+		ix := CustomIndex{Name: name, Weighting: test.weighting, SectorId: 1, BaseValue: 100}
+		val, ok := computeIndex(ix, indexStocks, day, nil, nil)
+
+		if !ok || val.Members != 2 || !almostEqual(val.Value, test.value) || !almostEqual(val.Change, test.value/100-1) {
+			t.Errorf("%s: expect value %v of 2 members, got %+v", name, test.value, val)
+		}
+	}
+}
+
+func TestComputeIndexShouldAdjustTheDivisorToKeepTheValueContinuous(t *testing.T) {
+	prev := &IndexValue{Value: 1000}
+	ix := CustomIndex{Weighting: weightPrice, Codes: []string{"A", "B", "C", "D"}, BaseValue: 100}
+
+	val, ok := computeIndex(ix, indexStocks, date("2020-02-03"), prev, nil)
+
+	// the members at their previous close, 350, are worth the previous value
+	if !ok || !almostEqual(val.Divisor, 0.35) || !almostEqual(val.Value, 340/0.35) || val.Members != 3 {
+		t.Errorf("Expect divisor 0.35 and value %v of 3 members, got %+v", 340/0.35, val)
+	}
+}
+
+func TestComputeIndexGivenClosesOfThePreviousValueShouldCarryItToThePreviousClose(t *testing.T) {
+	prev := &IndexValue{Value: 1000}
+	ix := CustomIndex{Weighting: weightPrice, Codes: []string{"A", "B", "C"}, BaseValue: 100}
+	// C has no close of the day of the previous value, e.g. a new member, so it does not move it
+	prevCloses := map[string]float32{"A": 90, "B": 190}
+
+	val, ok := computeIndex(ix, indexStocks, date("2020-02-03"), prev, prevCloses)
+
+	// the previous value moves by 300 / 280 to the previous close, then by 340 / 350 on the day
+	linked := 1000 * 300 / 280.0
+	if !ok || !almostEqual(val.Value, linked*340/350) || !almostEqual(val.Change, val.Value/1000-1) {
+		t.Errorf("Expect value %v, changed from the previous value, got %+v", linked*340/350, val)
+	}
+}
+
+func TestComputeIndexGivenNoMembersShouldReturnFalse(t *testing.T) {
+	ix := CustomIndex{Weighting: weightPrice, Codes: []string{"D"}, BaseValue: 100}
+
+	if _, ok := computeIndex(ix, indexStocks, date("2020-02-03"), nil, nil); ok {
+		t.Error("Expect false, got true")
+	}
+}
+
+func TestUpdateIndicesShouldChainTheValuesAndSetTheBaseDate(t *testing.T) {
+	indices := &MemCustomIndexRepository{}
+	indices.Save(CustomIndex{Name: "idx", Weighting: weightPrice, Codes: []string{"A", "B"}, BaseValue: 100})
+	values := &MemIndexValueRepository{}
+	values.Upsert([]IndexValue{
+		{Name: "idx", Date: date("2020-01-30"), Value: 80},
+		{Name: "idx", Date: date("2020-01-31"), Value: 120},
+	})
+
+	res, err := updateIndices(indexStocks, indices, values, &MemDailyBarRepository{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || !almostEqual(res[0].Value, 120*290.0/300) {
+		t.Errorf("Expect the value to change from the previous value, got %+v", res)
+	}
+	if stored, _ := values.Get("idx", date("2020-02-03")); !reflect.DeepEqual(stored, res) {
+		t.Errorf("Expect %+v stored, got %+v", res, stored)
+	}
+	if ix, _ := indices.Get("idx"); !ix.BaseDate.Equal(date("2020-02-03")) {
+		t.Errorf("Expect the base date to be set, got %v", ix.BaseDate)
+	}
+}
+
+func TestUpdateIndicesGivenAMissedDayShouldKeepItsMove(t *testing.T) {
+	indices := &MemCustomIndexRepository{}
+	indices.Save(CustomIndex{Name: "idx", Weighting: weightPrice, Codes: []string{"A", "B"}, BaseValue: 100, BaseDate: date("2020-01-30")})
+	values := &MemIndexValueRepository{}
+	values.Upsert([]IndexValue{{Name: "idx", Date: date("2020-01-30"), Value: 100}})
+	// A and B closed 2020-01-30 at 90 and 190, then nothing ran on 2020-01-31,
+	// when they closed at 100 and 200 as per their previous close of 2020-02-03
+	bars := &MemDailyBarRepository{}
+	bars.Upsert([]Bar{{Code: "A", Date: date("2020-01-30"), Close: 90}, {Code: "B", Date: date("2020-01-30"), Close: 190}})
+
+	res, err := updateIndices(indexStocks, indices, values, bars)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the index moves by 300 / 280 on the missed day, then by 290 / 300 on the day
+	expected := 100 * 300 / 280.0 * 290 / 300
+	if len(res) != 1 || !almostEqual(res[0].Value, expected) || !almostEqual(res[0].Change, expected/100-1) {
+		t.Errorf("Expect value %v, changed from the value of 2020-01-30, got %+v", expected, res)
+	}
+}
+
+func TestParseIndexShouldParseCodesOrSectorAndBaseValue(t *testing.T) {
+	tests := map[string]CustomIndex{
+		"big price bbca bbri bbca": {Name: "big", Weighting: weightPrice, Codes: []string{"BBCA", "BBRI"}, BaseValue: 100},
+		"fin CAP 1000 sector:3":    {Name: "fin", Weighting: weightCap, SectorId: 3, BaseValue: 1000},
+		"x equal 0 BBCA":           {},
+		"x median BBCA":            {},
+		"x equal 1000":             {},
+		"x equal sector:3 BBCA":    {},
+		"x equal sector:finance":   {},
+	}
+
+	for args, expected := range tests {
+		ix, err := parseIndex(strings.Fields(args))
+		if expected.Name == "" {
+			if err == nil {
+				t.Errorf("%s: expect error, got %+v", args, ix)
+			}
+		} else if err != nil || !reflect.DeepEqual(ix, expected) {
+			t.Errorf("%s: expect %+v, got %+v, %v", args, expected, ix, err)
+		}
+	}
+}
+
+func TestAddIndexGivenExistingIndexShouldKeepItsBase(t *testing.T) {
+	store := memStorage()
+	base := CustomIndex{Name: "idx", Weighting: weightPrice, Codes: []string{"A"}, BaseDate: date("2020-01-02"), BaseValue: 1000}
+	store.indices.Save(base)
+	out := &strings.Builder{}
+
+	if err := addIndex(out, store, []string{"idx", "equal", "500", "a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := CustomIndex{Name: "idx", Weighting: weightEqual, Codes: []string{"A", "B"}, BaseDate: base.BaseDate, BaseValue: 1000}
+	if ix, _ := store.indices.Get("idx"); !reflect.DeepEqual(*ix, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, *ix)
+	}
+	if expected := "idx: equal weighted A B, base 1000\n"; out.String() != expected {
+		t.Errorf("Expect %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,111 @@
+package ingest
+
+import (
+	"time"
+
+	"github.com/chrishadi/instock/indicators"
+)
+
+// indicatorHistoryDays is the number of calendar days of bars loaded to update the indicators,
+// enough to cover indicators.Window trading days across holidays.
+const indicatorHistoryDays = 320
+
+// Indicator holds the technical indicators of a code as of a trading day.
+type Indicator struct {
+	tableName struct{} `pg:"indicators"`
+
+	Code string    `pg:",pk"`
+	Date time.Time `pg:",pk,type:date"`
+	indicators.Values
+}
+
+// nextIndicator computes the indicators as of the last of bars, the daily bars of a code oldest first.
+// It continues from prev if prev is as of the bar before, otherwise it computes them from bars alone.
+func nextIndicator(prev *Indicator, bars []Bar) Indicator {
+	n := len(bars)
+	last := bars[n-1]
+	res := Indicator{Code: last.Code, Date: last.Date}
+
+	window := make([]indicators.Bar, n)
+	for i, bar := range bars {
+		window[i] = indicators.Bar{High: float64(bar.High), Low: float64(bar.Low), Close: float64(bar.Close)}
+	}
+
+	if prev != nil && n > 1 && prev.Date.Equal(bars[n-2].Date) {
+		if n > indicators.Window {
+			window = window[n-indicators.Window:]
+		}
+		res.Values = indicators.Next(prev.Values, window)
+	} else {
+		values := indicators.Compute(window)
+		res.Values = values[n-1]
+	}
+
+	return res
+}
+
+// updateIndicators updates the indicators of the stocks of the latest trading day of the batch,
+// from their adjusted daily bars and the indicators of the previous trading day. The indicators of
+// codes with corporate actions going ex within the bars are computed from the bars alone,
+// the previous ones being of prices before the adjustment.
+func updateIndicators(stocks []Stock, bars DailyBarRepository, actions CorporateActionRepository, repo IndicatorRepository) ([]Indicator, error) {
+	current, day, err := currentStocks(stocks)
+	if err != nil || len(current) == 0 {
+		return nil, err
+	}
+
+	from := day.AddDate(0, 0, -indicatorHistoryDays)
+	history, err := bars.AdjustedBetween(from, day)
+	if err != nil {
+		return nil, err
+	}
+	byCode := make(map[string][]Bar)
+	for _, bar := range history {
+		byCode[bar.Code] = append(byCode[bar.Code], bar)
+	}
+
+	prevs, err := repo.Before(day)
+	if err != nil {
+		return nil, err
+	}
+	prevByCode := make(map[string]*Indicator, len(prevs))
+	for i := range prevs {
+		prevByCode[prevs[i].Code] = &prevs[i]
+	}
+
+	adjusted, err := actions.Since(from.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	for _, action := range adjusted {
+		if !action.ExDate.After(day) {
+			delete(prevByCode, action.Code)
+		}
+	}
+
+	res := make([]Indicator, 0, len(current))
+	for _, s := range current {
+		codeBars := byCode[s.Code]
+		if len(codeBars) == 0 || !codeBars[len(codeBars)-1].Date.Equal(day) {
+			continue
+		}
+		res = append(res, nextIndicator(prevByCode[s.Code], codeBars))
+	}
+
+	return res, repo.Upsert(res)
+}
+
+// withIndicators returns a copy of stocks with the indicators of their codes, if any.
+func withIndicators(stocks []Stock, values []Indicator) []Stock {
+	byCode := make(map[string]indicators.Values, len(values))
+	for _, v := range values {
+		byCode[v.Code] = v.Values
+	}
+
+	res := make([]Stock, len(stocks))
+	for i, s := range stocks {
+		s.Indicators = byCode[s.Code]
+		res[i] = s
+	}
+	return res
+}
@@ -0,0 +1,83 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chrishadi/instock/indicators"
+)
+
+func TestUpdateIndicatorsShouldContinueFromThePreviousDay(t *testing.T) {
+	day := date("2020-04-01")
+	bars := &MemDailyBarRepository{}
+	all := risingBars("A", day.AddDate(0, 0, 1), 40)
+	bars.Upsert(all)
+	actions := &MemCorporateActionRepository{}
+	repo := &MemIndicatorRepository{}
+	stocks := []Stock{{Code: "A", LastUpdate: "2020-04-01T16:00:00"}, {Code: "B", LastUpdate: "2020-04-01T16:00:00"}}
+
+	// the first run computes the indicators from the history alone
+	first, err := updateIndicators([]Stock{{Code: "A", LastUpdate: "2020-03-31T16:00:00"}}, bars, actions, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := updateIndicators(stocks, bars, actions, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	window := make([]indicators.Bar, len(all))
+	for i, bar := range all {
+		window[i] = indicators.Bar{High: float64(bar.High), Low: float64(bar.Low), Close: float64(bar.Close)}
+	}
+	values := indicators.Compute(window)
+	if len(first) != 1 || first[0].Values != values[38] {
+		t.Errorf("Expect %+v, got %+v", values[38], first)
+	}
+	expected := []Indicator{{Code: "A", Date: day, Values: values[39]}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func TestUpdateIndicatorsGivenActionWithinTheBarsShouldComputeFromAdjustedBars(t *testing.T) {
+	day := date("2020-04-01")
+	actions := &MemCorporateActionRepository{}
+	bars := &MemDailyBarRepository{actions: actions}
+	bars.Upsert(risingBars("A", day.AddDate(0, 0, 1), 40))
+	repo := &MemIndicatorRepository{}
+
+	if _, err := updateIndicators([]Stock{{Code: "A", LastUpdate: "2020-03-31T16:00:00"}}, bars, actions, repo); err != nil {
+		t.Fatal(err)
+	}
+	actions.Upsert([]CorporateAction{{Code: "A", Type: actionSplit, ExDate: day.AddDate(0, 0, -10), Old: 1, New: 2, Factor: 0.5}})
+	actual, err := updateIndicators([]Stock{{Code: "A", LastUpdate: "2020-04-01T16:00:00"}}, bars, actions, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adjusted, _ := bars.AdjustedBetween(time.Time{}, day)
+	window := make([]indicators.Bar, len(adjusted))
+	for i, bar := range adjusted {
+		window[i] = indicators.Bar{High: float64(bar.High), Low: float64(bar.Low), Close: float64(bar.Close)}
+	}
+	expected := []Indicator{{Code: "A", Date: day, Values: indicators.Compute(window)[39]}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func TestWithIndicatorsShouldNotModifyTheGivenStocks(t *testing.T) {
+	stocks := []Stock{{Code: "A"}, {Code: "B"}}
+	values := []Indicator{{Code: "B", Values: indicators.Values{Bars: 1, Rsi14: 50}}}
+
+	actual := withIndicators(stocks, values)
+
+	if actual[0].Indicators.Bars != 0 || actual[1].Indicators != values[0].Values {
+		t.Errorf("Expect indicators of B only, got %+v", actual)
+	}
+	if stocks[1].Indicators.Bars != 0 {
+		t.Errorf("Expect the given stocks to be unchanged, got %+v", stocks)
+	}
+}
@@ -0,0 +1,186 @@
+// Package indicators computes technical indicators of daily bars. The values of a bar
+// only depend on the values of the bar before it and a trailing window of bars,
+// so that they can be updated incrementally as new bars arrive.
+package indicators
+
+import "math"
+
+const (
+	SmaShortPeriod  = 20
+	SmaLongPeriod   = 50
+	SmaTrendPeriod  = 200
+	EmaFastPeriod   = 12
+	EmaSlowPeriod   = 26
+	SignalPeriod    = 9
+	RsiPeriod       = 14
+	BollingerPeriod = 20
+	BollingerWidth  = 2
+	AtrPeriod       = 14
+)
+
+// Window is the number of trailing bars that Next needs.
+const Window = SmaTrendPeriod
+
+// Bar holds the prices of a trading period.
+type Bar struct {
+	High, Low, Close float64
+}
+
+// Values are the indicators as of a bar. An indicator is zero until Bars,
+// the number of bars it is computed from, is at least its period,
+// or its period plus one for those of price changes, i.e. RSI and ATR.
+// AvgGain and AvgLoss are the smoothed price changes the RSI is computed from.
+type Values struct {
+	Bars           int
+	Sma20          float64
+	Sma50          float64
+	Sma200         float64
+	Ema12          float64
+	Ema26          float64
+	Macd           float64
+	MacdSignal     float64
+	MacdHist       float64
+	Rsi14          float64
+	BollingerUpper float64
+	BollingerLower float64
+	Atr14          float64
+	AvgGain        float64
+	AvgLoss        float64
+}
+
+// Next returns the values as of the last of bars given prev, the values as of the bar before it.
+// bars is the history ending with the new bar, of which the last Window bars are enough.
+func Next(prev Values, bars []Bar) Values {
+	n := len(bars)
+	bar := bars[n-1]
+	v := Values{Bars: prev.Bars + 1}
+	ready := func(period int) bool { return v.Bars >= period && n >= period }
+
+	if ready(SmaShortPeriod) {
+		v.Sma20 = meanClose(bars[n-SmaShortPeriod:])
+	}
+	if ready(SmaLongPeriod) {
+		v.Sma50 = meanClose(bars[n-SmaLongPeriod:])
+	}
+	if ready(SmaTrendPeriod) {
+		v.Sma200 = meanClose(bars[n-SmaTrendPeriod:])
+	}
+
+	v.Ema12 = ema(prev.Ema12, bars, v.Bars, EmaFastPeriod)
+	v.Ema26 = ema(prev.Ema26, bars, v.Bars, EmaSlowPeriod)
+	if v.Bars >= EmaSlowPeriod {
+		// the signal line is seeded with the first MACD value
+		v.Macd = v.Ema12 - v.Ema26
+		v.MacdSignal = v.Macd
+		if v.Bars > EmaSlowPeriod {
+			v.MacdSignal = smooth(prev.MacdSignal, v.Macd, SignalPeriod)
+		}
+		v.MacdHist = v.Macd - v.MacdSignal
+	}
+
+	if ready(RsiPeriod + 1) {
+		if v.Bars == RsiPeriod+1 {
+			for i := n - RsiPeriod; i < n; i++ {
+				gain, loss := change(bars[i-1], bars[i])
+				v.AvgGain += gain / RsiPeriod
+				v.AvgLoss += loss / RsiPeriod
+			}
+		} else {
+			gain, loss := change(bars[n-2], bar)
+			v.AvgGain = wilder(prev.AvgGain, gain, RsiPeriod)
+			v.AvgLoss = wilder(prev.AvgLoss, loss, RsiPeriod)
+		}
+		v.Rsi14 = rsi(v.AvgGain, v.AvgLoss)
+	}
+
+	if ready(BollingerPeriod) {
+		window := bars[n-BollingerPeriod:]
+		mid := meanClose(window)
+		var sq float64
+		for _, b := range window {
+			sq += (b.Close - mid) * (b.Close - mid)
+		}
+		width := BollingerWidth * math.Sqrt(sq/BollingerPeriod)
+		v.BollingerUpper = mid + width
+		v.BollingerLower = mid - width
+	}
+
+	if ready(AtrPeriod + 1) {
+		if v.Bars == AtrPeriod+1 {
+			for i := n - AtrPeriod; i < n; i++ {
+				v.Atr14 += trueRange(bars[i-1], bars[i]) / AtrPeriod
+			}
+		} else {
+			v.Atr14 = wilder(prev.Atr14, trueRange(bars[n-2], bar), AtrPeriod)
+		}
+	}
+
+	return v
+}
+
+// Compute returns the values as of every bar, computed from scratch.
+func Compute(bars []Bar) []Values {
+	res := make([]Values, len(bars))
+	var prev Values
+	for i := range bars {
+		from := 0
+		if i+1 > Window {
+			from = i + 1 - Window
+		}
+		prev = Next(prev, bars[from:i+1])
+		res[i] = prev
+	}
+	return res
+}
+
+func meanClose(bars []Bar) float64 {
+	var sum float64
+	for _, b := range bars {
+		sum += b.Close
+	}
+	return sum / float64(len(bars))
+}
+
+// ema seeds the moving average with the simple average of the first period closes.
+func ema(prev float64, bars []Bar, count, period int) float64 {
+	switch {
+	case count < period || len(bars) < period && prev == 0:
+		return 0
+	case count == period || prev == 0:
+		return meanClose(bars[len(bars)-period:])
+	default:
+		return smooth(prev, bars[len(bars)-1].Close, period)
+	}
+}
+
+func smooth(prev, v float64, period int) float64 {
+	k := 2 / float64(period+1)
+	return prev + k*(v-prev)
+}
+
+// wilder is Wilder's smoothing, used by RSI and ATR.
+func wilder(prev, v float64, period int) float64 {
+	return (prev*float64(period-1) + v) / float64(period)
+}
+
+func change(prev, bar Bar) (gain, loss float64) {
+	d := bar.Close - prev.Close
+	if d > 0 {
+		return d, 0
+	}
+	return 0, -d
+}
+
+func rsi(avgGain, avgLoss float64) float64 {
+	if avgLoss == 0 {
+		if avgGain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+avgGain/avgLoss)
+}
+
+func trueRange(prev, bar Bar) float64 {
+	return math.Max(bar.High-bar.Low, math.Max(math.Abs(bar.High-prev.Close), math.Abs(bar.Low-prev.Close)))
+}
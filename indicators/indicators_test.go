@@ -0,0 +1,138 @@
+package indicators
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func closes(values ...float64) []Bar {
+	bars := make([]Bar, len(values))
+	for i, c := range values {
+		bars[i] = Bar{High: c, Low: c, Close: c}
+	}
+	return bars
+}
+
+func rising(n int) []Bar {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	return closes(values...)
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestComputeShouldLeaveIndicatorsZeroUntilTheirPeriod(t *testing.T) {
+	values := Compute(rising(EmaSlowPeriod - 1))
+	last := values[len(values)-1]
+
+	if last.Bars != EmaSlowPeriod-1 {
+		t.Errorf("Expect %d bars, got %d", EmaSlowPeriod-1, last.Bars)
+	}
+	if last.Sma50 != 0 || last.Ema26 != 0 || last.Macd != 0 {
+		t.Errorf("Expect SMA50, EMA26 and MACD to be zero, got %+v", last)
+	}
+	if values[SmaShortPeriod-2].Sma20 != 0 || values[SmaShortPeriod-1].Sma20 == 0 {
+		t.Errorf("Expect SMA20 from the %dth bar, got %+v", SmaShortPeriod, values[SmaShortPeriod-1])
+	}
+}
+
+func TestComputeShouldComputeMovingAverages(t *testing.T) {
+	values := Compute(rising(60))
+	last := values[59]
+
+	if !almostEqual(last.Sma20, 50.5) || !almostEqual(last.Sma50, 35.5) {
+		t.Errorf("Expect SMA20 50.5 and SMA50 35.5, got %v and %v", last.Sma20, last.Sma50)
+	}
+	// an EMA of a linear series lags it by (period-1)/2 once seeded with the SMA
+	if !almostEqual(last.Ema12, 54.5) || !almostEqual(last.Ema26, 47.5) {
+		t.Errorf("Expect EMA12 54.5 and EMA26 47.5, got %v and %v", last.Ema12, last.Ema26)
+	}
+	if !almostEqual(last.Macd, 7) || !almostEqual(last.MacdSignal, 7) || !almostEqual(last.MacdHist, 0) {
+		t.Errorf("Expect MACD 7, signal 7 and histogram 0, got %v, %v and %v", last.Macd, last.MacdSignal, last.MacdHist)
+	}
+}
+
+func TestComputeShouldComputeTheTrendMovingAverageFromItsPeriod(t *testing.T) {
+	values := Compute(rising(SmaTrendPeriod + 1))
+
+	if values[SmaTrendPeriod-2].Sma200 != 0 {
+		t.Errorf("Expect SMA200 to be zero before the %dth bar, got %v", SmaTrendPeriod, values[SmaTrendPeriod-2].Sma200)
+	}
+	if sma := values[SmaTrendPeriod].Sma200; !almostEqual(sma, 101.5) {
+		t.Errorf("Expect SMA200 101.5, got %v", sma)
+	}
+}
+
+func TestComputeShouldComputeRsi(t *testing.T) {
+	up := Compute(rising(RsiPeriod + 1))
+	if rsi := up[RsiPeriod].Rsi14; rsi != 100 {
+		t.Errorf("Expect RSI of a rising series to be 100, got %v", rsi)
+	}
+
+	values := Compute(closes(10, 11, 10, 11, 10, 11, 10, 11, 10, 11, 10, 11, 10, 11, 10, 12))
+	last := values[len(values)-1]
+	// 7 gains and 7 losses of 1, then a gain of 2
+	expectedGain := (0.5*13 + 2) / 14
+	expectedLoss := 0.5 * 13 / 14
+	if !almostEqual(last.AvgGain, expectedGain) || !almostEqual(last.AvgLoss, expectedLoss) {
+		t.Errorf("Expect average gain %v and loss %v, got %v and %v", expectedGain, expectedLoss, last.AvgGain, last.AvgLoss)
+	}
+	if expected := 100 - 100/(1+expectedGain/expectedLoss); !almostEqual(last.Rsi14, expected) {
+		t.Errorf("Expect RSI %v, got %v", expected, last.Rsi14)
+	}
+}
+
+func TestComputeShouldComputeBollingerBands(t *testing.T) {
+	values := make([]float64, BollingerPeriod)
+	for i := range values {
+		values[i] = float64(10 + i%2*2)
+	}
+
+	last := Compute(closes(values...))[BollingerPeriod-1]
+
+	if !almostEqual(last.BollingerUpper, 13) || !almostEqual(last.BollingerLower, 9) {
+		t.Errorf("Expect bands 13 and 9, got %v and %v", last.BollingerUpper, last.BollingerLower)
+	}
+}
+
+func TestComputeShouldComputeAtr(t *testing.T) {
+	bars := make([]Bar, AtrPeriod+2)
+	for i := range bars {
+		bars[i] = Bar{High: 12, Low: 10, Close: 11}
+	}
+	bars[len(bars)-1] = Bar{High: 20, Low: 18, Close: 19}
+
+	values := Compute(bars)
+
+	if atr := values[AtrPeriod].Atr14; !almostEqual(atr, 2) {
+		t.Errorf("Expect ATR 2, got %v", atr)
+	}
+	// the true range of the gap up is from the previous close to the high
+	if atr, expected := values[AtrPeriod+1].Atr14, (2*13+9)/14.0; !almostEqual(atr, expected) {
+		t.Errorf("Expect ATR %v, got %v", expected, atr)
+	}
+}
+
+func TestNextGivenTrailingWindowShouldMatchComputingFromScratch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	bars := make([]Bar, 2*Window)
+	price := 100.0
+	for i := range bars {
+		price *= 1 + (r.Float64()-0.5)/10
+		bars[i] = Bar{High: price * 1.02, Low: price * 0.98, Close: price}
+	}
+
+	all := Compute(bars)
+	prev := Compute(bars[:Window+10])[Window+9]
+	for i := Window + 10; i < len(bars); i++ {
+		prev = Next(prev, bars[i+1-Window:i+1])
+		if prev != all[i] {
+			t.Fatalf("Expect %+v, got %+v", all[i], prev)
+		}
+	}
+}
@@ -38,6 +38,274 @@ CREATE MATERIALIZED VIEW IF NOT EXISTS public.stock_last_updates AS
   GROUP BY stocks.code
   WITH NO DATA;
 
+--
+-- Name: daily_bars; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.daily_bars (
+    code character varying NOT NULL,
+    date date NOT NULL,
+    open numeric,
+    high numeric,
+    low numeric,
+    close numeric,
+    volume numeric,
+    value numeric,
+    frequency numeric,
+    PRIMARY KEY (code, date)
+);
+
+--
+-- Name: corporate_actions; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.corporate_actions (
+    code character varying NOT NULL,
+    type character varying NOT NULL,
+    ex_date date NOT NULL,
+    old numeric,
+    new numeric,
+    price numeric,
+    amount numeric,
+    factor numeric,
+    PRIMARY KEY (code, type, ex_date)
+);
+
+--
+-- Name: adjusted_stocks; Type: VIEW; Schema: public
+-- Prices multiplied by the factors of actions going ex after the snapshot up to today,
+-- previous close also by those going ex on the snapshot day.
+--
+
+CREATE OR REPLACE VIEW public.adjusted_stocks AS
+ SELECT s.name,
+    s.code,
+    s.sub_sector_id,
+    s.sub_sector_name,
+    s.sector_id,
+    s.sector_name,
+    s.last * f.after AS last,
+    s.prev_closing_price * f.before AS prev_closing_price,
+    s.adjusted_open_price * f.after AS adjusted_open_price,
+    s.adjusted_high_price * f.after AS adjusted_high_price,
+    s.adjusted_low_price * f.after AS adjusted_low_price,
+    s.volume / f.shares AS volume,
+    s.frequency,
+    s.value,
+    CASE WHEN s.prev_closing_price * f.before = 0 THEN s.one_day
+         ELSE s.last * f.after / (s.prev_closing_price * f.before) - 1
+    END AS one_day,
+    s.last_update
+   FROM public.stocks s,
+    LATERAL ( SELECT COALESCE(exp(sum(ln(a.factor)) FILTER (WHERE a.ex_date > s.last_update::date)), 1) AS after,
+            COALESCE(exp(sum(ln(a.factor)) FILTER (WHERE a.ex_date >= s.last_update::date)), 1) AS before,
+            COALESCE(exp(sum(ln(a.factor)) FILTER (WHERE a.ex_date > s.last_update::date
+                AND a.type IN ('split', 'reverse_split', 'bonus'))), 1) AS shares
+           FROM public.corporate_actions a
+          WHERE a.code = s.code AND a.ex_date <= CURRENT_DATE) f;
+
+--
+-- Name: adjusted_daily_bars; Type: VIEW; Schema: public
+-- Prices multiplied by the factors of actions going ex after the bar up to today.
+--
+
+CREATE OR REPLACE VIEW public.adjusted_daily_bars AS
+ SELECT b.code,
+    b.date,
+    b.open * f.after AS open,
+    b.high * f.after AS high,
+    b.low * f.after AS low,
+    b.close * f.after AS close,
+    b.volume / f.shares AS volume,
+    b.value,
+    b.frequency
+   FROM public.daily_bars b,
+    LATERAL ( SELECT COALESCE(exp(sum(ln(a.factor))), 1) AS after,
+            COALESCE(exp(sum(ln(a.factor)) FILTER (WHERE a.type IN ('split', 'reverse_split', 'bonus'))), 1) AS shares
+           FROM public.corporate_actions a
+          WHERE a.code = b.code AND a.ex_date > b.date AND a.ex_date <= CURRENT_DATE) f;
+
+--
+-- Name: sector_performances; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.sector_performances (
+    date date NOT NULL,
+    level character varying NOT NULL,
+    id integer NOT NULL,
+    name character varying,
+    count integer,
+    advancers integer,
+    decliners integer,
+    unchanged integer,
+    avg_change numeric,
+    weighted_change numeric,
+    value numeric,
+    PRIMARY KEY (date, level, id)
+);
+
+--
+-- Name: market_breadths; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.market_breadths (
+    date date PRIMARY KEY,
+    advancers integer,
+    decliners integer,
+    unchanged integer,
+    ad_ratio numeric,
+    ad_line integer,
+    new_highs integer,
+    new_lows integer,
+    above_ma20 numeric,
+    above_ma50 numeric,
+    above_ma200 numeric
+);
+
+--
+-- Name: indicators; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.indicators (
+    code text NOT NULL,
+    date date NOT NULL,
+    bars integer,
+    sma20 numeric,
+    sma50 numeric,
+    sma200 numeric,
+    ema12 numeric,
+    ema26 numeric,
+    macd numeric,
+    macd_signal numeric,
+    macd_hist numeric,
+    rsi14 numeric,
+    bollinger_upper numeric,
+    bollinger_lower numeric,
+    atr14 numeric,
+    avg_gain numeric,
+    avg_loss numeric,
+    PRIMARY KEY (code, date)
+);
+
+--
+-- Name: events; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.events (
+    code text NOT NULL,
+    date date NOT NULL,
+    type text NOT NULL,
+    value numeric,
+    reference numeric,
+    PRIMARY KEY (code, date, type)
+);
+
+--
+-- Name: alert_rules; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.alert_rules (
+    id bigserial PRIMARY KEY,
+    code text NOT NULL,
+    metric text NOT NULL,
+    op text NOT NULL,
+    threshold numeric,
+    triggered boolean NOT NULL DEFAULT false,
+    created_at timestamp with time zone
+);
+
+--
+-- Name: watchlists; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.watchlists (
+    name text PRIMARY KEY,
+    codes text[],
+    chat_id bigint
+);
+
+--
+-- Name: trades; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.trades (
+    id bigserial PRIMARY KEY,
+    code text NOT NULL,
+    date date NOT NULL,
+    side text NOT NULL,
+    lots integer NOT NULL,
+    price numeric,
+    fees numeric
+);
+
+--
+-- Name: portfolio_snapshots; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.portfolio_snapshots (
+    date date PRIMARY KEY,
+    market_value numeric,
+    cost numeric,
+    unrealized numeric,
+    realized numeric,
+    daily_pnl numeric
+);
+
+--
+-- Name: custom_indices; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.custom_indices (
+    name text PRIMARY KEY,
+    weighting text NOT NULL,
+    codes text[],
+    sector_id integer,
+    base_date date,
+    base_value numeric
+);
+
+--
+-- Name: index_values; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.index_values (
+    name text NOT NULL,
+    date date NOT NULL,
+    value numeric,
+    change numeric,
+    divisor numeric,
+    members integer,
+    PRIMARY KEY (name, date)
+);
+
+--
+-- Name: stock_ratios; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.stock_ratios (
+    code text PRIMARY KEY,
+    one_week numeric,
+    one_month numeric,
+    three_month numeric,
+    six_month numeric,
+    one_year numeric,
+    mtd numeric,
+    ytd numeric,
+    per numeric,
+    pbr numeric,
+    roe numeric,
+    capitalization numeric
+);
+
+--
+-- Name: screens; Type: TABLE; Schema: public
+--
+
+CREATE TABLE IF NOT EXISTS public.screens (
+    name text PRIMARY KEY,
+    expression text NOT NULL
+);
+
 --
 -- PostgreSQL database dump complete
 --
@@ -0,0 +1,309 @@
+--
+-- SQLite schema, mirrors instock.sql
+--
+
+--
+-- Name: stocks; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS stocks (
+    name text,
+    code text,
+    sub_sector_id integer,
+    sub_sector_name text,
+    sector_id integer,
+    sector_name text,
+    last numeric,
+    prev_closing_price numeric,
+    adjusted_open_price numeric,
+    adjusted_high_price numeric,
+    adjusted_low_price numeric,
+    volume numeric,
+    frequency numeric,
+    value numeric,
+    one_day numeric,
+    last_update timestamp
+);
+
+CREATE INDEX IF NOT EXISTS stocks_code_idx ON stocks (code);
+
+--
+-- Name: stock_last_updates; Type: TABLE
+-- SQLite has no materialized views, the table is rebuilt on refresh.
+--
+
+CREATE TABLE IF NOT EXISTS stock_last_updates (
+    code text PRIMARY KEY,
+    last_update timestamp
+);
+
+--
+-- Name: daily_bars; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS daily_bars (
+    code text NOT NULL,
+    date text NOT NULL,
+    open numeric,
+    high numeric,
+    low numeric,
+    close numeric,
+    volume numeric,
+    value numeric,
+    frequency numeric,
+    PRIMARY KEY (code, date)
+);
+
+--
+-- Name: corporate_actions; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS corporate_actions (
+    code text NOT NULL,
+    type text NOT NULL,
+    ex_date text NOT NULL,
+    old numeric,
+    new numeric,
+    price numeric,
+    amount numeric,
+    factor numeric,
+    PRIMARY KEY (code, type, ex_date)
+);
+
+--
+-- Name: adjusted_stocks; Type: VIEW
+-- Prices multiplied by the factors of actions going ex after the snapshot up to today,
+-- previous close also by those going ex on the snapshot day.
+-- exp and ln are registered by the application if SQLite lacks them.
+--
+
+DROP VIEW IF EXISTS adjusted_stocks;
+CREATE VIEW adjusted_stocks AS
+SELECT name, code, sub_sector_id, sub_sector_name, sector_id, sector_name,
+    last * after AS last,
+    prev_closing_price * before AS prev_closing_price,
+    adjusted_open_price * after AS adjusted_open_price,
+    adjusted_high_price * after AS adjusted_high_price,
+    adjusted_low_price * after AS adjusted_low_price,
+    volume / shares AS volume,
+    frequency,
+    value,
+    CASE WHEN prev_closing_price * before = 0 THEN one_day
+         ELSE last * after / (prev_closing_price * before) - 1
+    END AS one_day,
+    last_update
+FROM (
+    SELECT s.*,
+        COALESCE(exp(sum(ln(a.factor)) FILTER (WHERE a.ex_date > substr(s.last_update, 1, 10))), 1) AS after,
+        COALESCE(exp(sum(ln(a.factor)) FILTER (WHERE a.ex_date >= substr(s.last_update, 1, 10))), 1) AS before,
+        COALESCE(exp(sum(ln(a.factor)) FILTER (WHERE a.ex_date > substr(s.last_update, 1, 10)
+            AND a.type IN ('split', 'reverse_split', 'bonus'))), 1) AS shares
+    FROM stocks s
+    LEFT JOIN corporate_actions a ON a.code = s.code AND a.ex_date <= date('now')
+    GROUP BY s.rowid
+);
+
+--
+-- Name: adjusted_daily_bars; Type: VIEW
+-- Prices multiplied by the factors of actions going ex after the bar up to today.
+--
+
+DROP VIEW IF EXISTS adjusted_daily_bars;
+CREATE VIEW adjusted_daily_bars AS
+SELECT code, date,
+    open * after AS open,
+    high * after AS high,
+    low * after AS low,
+    close * after AS close,
+    volume / shares AS volume,
+    value,
+    frequency
+FROM (
+    SELECT b.*,
+        COALESCE(exp(sum(ln(a.factor))), 1) AS after,
+        COALESCE(exp(sum(ln(a.factor)) FILTER (WHERE a.type IN ('split', 'reverse_split', 'bonus'))), 1) AS shares
+    FROM daily_bars b
+    LEFT JOIN corporate_actions a ON a.code = b.code AND a.ex_date > b.date AND a.ex_date <= date('now')
+    GROUP BY b.code, b.date
+);
+
+--
+-- Name: sector_performances; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS sector_performances (
+    date text NOT NULL,
+    level text NOT NULL,
+    id integer NOT NULL,
+    name text,
+    count integer,
+    advancers integer,
+    decliners integer,
+    unchanged integer,
+    avg_change numeric,
+    weighted_change numeric,
+    value numeric,
+    PRIMARY KEY (date, level, id)
+);
+
+--
+-- Name: market_breadths; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS market_breadths (
+    date text PRIMARY KEY,
+    advancers integer,
+    decliners integer,
+    unchanged integer,
+    ad_ratio numeric,
+    ad_line integer,
+    new_highs integer,
+    new_lows integer,
+    above_ma20 numeric,
+    above_ma50 numeric,
+    above_ma200 numeric
+);
+
+--
+-- Name: indicators; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS indicators (
+    code text NOT NULL,
+    date text NOT NULL,
+    bars integer,
+    sma20 numeric,
+    sma50 numeric,
+    sma200 numeric,
+    ema12 numeric,
+    ema26 numeric,
+    macd numeric,
+    macd_signal numeric,
+    macd_hist numeric,
+    rsi14 numeric,
+    bollinger_upper numeric,
+    bollinger_lower numeric,
+    atr14 numeric,
+    avg_gain numeric,
+    avg_loss numeric,
+    PRIMARY KEY (code, date)
+);
+
+--
+-- Name: events; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS events (
+    code text NOT NULL,
+    date text NOT NULL,
+    type text NOT NULL,
+    value numeric,
+    reference numeric,
+    PRIMARY KEY (code, date, type)
+);
+
+--
+-- Name: alert_rules; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    code text NOT NULL,
+    metric text NOT NULL,
+    op text NOT NULL,
+    threshold numeric,
+    triggered integer NOT NULL DEFAULT 0,
+    created_at timestamp
+);
+
+--
+-- Name: watchlists; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS watchlists (
+    name text PRIMARY KEY,
+    codes text,
+    chat_id bigint
+);
+
+--
+-- Name: trades; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS trades (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    code text NOT NULL,
+    date text NOT NULL,
+    side text NOT NULL,
+    lots integer NOT NULL,
+    price numeric,
+    fees numeric
+);
+
+--
+-- Name: portfolio_snapshots; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS portfolio_snapshots (
+    date text PRIMARY KEY,
+    market_value numeric,
+    cost numeric,
+    unrealized numeric,
+    realized numeric,
+    daily_pnl numeric
+);
+
+--
+-- Name: custom_indices; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS custom_indices (
+    name text PRIMARY KEY,
+    weighting text NOT NULL,
+    codes text,
+    sector_id integer,
+    base_date text,
+    base_value numeric
+);
+
+--
+-- Name: index_values; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS index_values (
+    name text NOT NULL,
+    date text NOT NULL,
+    value numeric,
+    change numeric,
+    divisor numeric,
+    members integer,
+    PRIMARY KEY (name, date)
+);
+
+--
+-- Name: stock_ratios; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS stock_ratios (
+    code text PRIMARY KEY,
+    one_week numeric,
+    one_month numeric,
+    three_month numeric,
+    six_month numeric,
+    one_year numeric,
+    mtd numeric,
+    ytd numeric,
+    per numeric,
+    pbr numeric,
+    roe numeric,
+    capitalization numeric
+);
+
+--
+-- Name: screens; Type: TABLE
+--
+
+CREATE TABLE IF NOT EXISTS screens (
+    name text PRIMARY KEY,
+    expression text NOT NULL
+);
@@ -0,0 +1,133 @@
+package ingest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit event types
+const (
+	eventUpperLimit = "upper_limit"
+	eventLowerLimit = "lower_limit"
+)
+
+// LimitConfig describes the exchange's auto-rejection limits. Bands is a comma separated list of
+// "min_price:upper[:lower]", e.g. "0:0.35,200:0.25,5000:0.2", where the limits of the band with the
+// highest min_price not above PrevClosingPrice apply, and lower defaults to upper. A stock is at a limit
+// when its last price is within Tolerance, a ratio of the limit price, of it.
+type LimitConfig struct {
+	Bands     string  `default:"0:0.35,200:0.25,5000:0.2"`
+	Tolerance float64 `default:"0.005"`
+}
+
+// priceBand holds the auto-rejection limits, as ratios of the previous close, of the prices from MinPrice.
+type priceBand struct {
+	MinPrice float32
+	Upper    float64
+	Lower    float64
+}
+
+// parsePriceBands parses the bands of a LimitConfig, ordered by min price.
+func parsePriceBands(spec string) ([]priceBand, error) {
+	var bands []priceBand
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid price band %q", item)
+		}
+
+		values := make([]float64, len(parts))
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("invalid price band %q", item)
+			}
+			values[i] = v
+		}
+
+		band := priceBand{MinPrice: float32(values[0]), Upper: values[1], Lower: values[1]}
+		if len(values) > 2 {
+			band.Lower = values[2]
+		}
+		bands = append(bands, band)
+	}
+
+	sort.SliceStable(bands, func(i, j int) bool { return bands[i].MinPrice < bands[j].MinPrice })
+	return bands, nil
+}
+
+// bandOf returns the band of the given price, or false if it is below all bands.
+func bandOf(bands []priceBand, price float32) (priceBand, bool) {
+	for i := len(bands) - 1; i >= 0; i-- {
+		if price >= bands[i].MinPrice {
+			return bands[i], true
+		}
+	}
+	return priceBand{}, false
+}
+
+// detectLimits returns the events of stocks at or near their upper or lower limit.
+func detectLimits(stocks []Stock, day time.Time, bands []priceBand, tolerance float64) []Event {
+	var events []Event
+	for _, s := range stocks {
+		if s.PrevClosingPrice <= 0 || s.Last <= 0 {
+			continue
+		}
+		band, exist := bandOf(bands, s.PrevClosingPrice)
+		if !exist {
+			continue
+		}
+
+		prev, last := float64(s.PrevClosingPrice), float64(s.Last)
+		upper := prev * (1 + band.Upper)
+		lower := prev * (1 - band.Lower)
+		switch {
+		case band.Upper > 0 && last >= upper*(1-tolerance):
+			events = append(events, Event{s.Code, day, eventUpperLimit, last, upper})
+		case band.Lower > 0 && last <= lower*(1+tolerance):
+			events = append(events, Event{s.Code, day, eventLowerLimit, last, lower})
+		}
+	}
+
+	return events
+}
+
+// updateLimitEvents detects the stocks of the latest trading day of the batch at their limits
+// and stores them as events.
+func updateLimitEvents(stocks []Stock, cfg LimitConfig, repo EventRepository) ([]Event, error) {
+	bands, err := parsePriceBands(cfg.Bands)
+	if err != nil {
+		return nil, err
+	}
+
+	current, day, err := currentStocks(stocks)
+	if err != nil || len(current) == 0 {
+		return nil, err
+	}
+
+	events := detectLimits(current, day, bands, cfg.Tolerance)
+	return events, repo.Upsert(events)
+}
+
+// splitByEvents returns the stocks with an event of the given type, highest value first, and the rest.
+func splitByEvents(stocks []Stock, events []Event, eventType string) (hit, rest []Stock) {
+	codes := toSet(eventCodes(events, eventType))
+	for _, s := range stocks {
+		if codes[s.Code] {
+			hit = append(hit, s)
+		} else {
+			rest = append(rest, s)
+		}
+	}
+
+	sort.SliceStable(hit, func(i, j int) bool { return hit[i].Value > hit[j].Value })
+	return hit, rest
+}
@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePriceBandsShouldOrderBandsAndDefaultLowerToUpper(t *testing.T) {
+	actual, err := parsePriceBands("5000:0.2, 0:0.35:0.15,200:0.25")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []priceBand{{0, 0.35, 0.15}, {200, 0.25, 0.25}, {5000, 0.2, 0.2}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func TestParsePriceBandsGivenInvalidSpecShouldReturnError(t *testing.T) {
+	for _, spec := range []string{"0", "0:0.1:0.1:0.1", "0:x", "-1:0.1"} {
+		if _, err := parsePriceBands(spec); err == nil {
+			t.Errorf("%q: expect error, got nil", spec)
+		}
+	}
+}
+
+func TestDetectLimitsShouldUseTheBandOfThePreviousClose(t *testing.T) {
+	day := date("2020-02-03")
+	bands := []priceBand{{50, 0.35, 0.35}, {200, 0.25, 0.25}, {5000, 0.2, 0.07}}
+	stocks := []Stock{
+		{Code: "A", PrevClosingPrice: 100, Last: 135},
+		{Code: "B", PrevClosingPrice: 1000, Last: 1248},
+		{Code: "C", PrevClosingPrice: 1000, Last: 1240},
+		{Code: "D", PrevClosingPrice: 10000, Last: 9300},
+		{Code: "E", PrevClosingPrice: 10000, Last: 9400},
+		{Code: "F", PrevClosingPrice: 40, Last: 54},
+		{Code: "G", Last: 100},
+	}
+
+	actual := detectLimits(stocks, day, bands, 0.005)
+
+	expected := []Event{
+		{"A", day, eventUpperLimit, 135, 135},
+		{"B", day, eventUpperLimit, 1248, 1250},
+		{"D", day, eventLowerLimit, 9300, 9300},
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Expect %+v, got %+v", expected, actual)
+	}
+	for i := range expected {
+		if a, e := actual[i], expected[i]; a.Code != e.Code || a.Type != e.Type || !almostEqual(a.Reference, e.Reference) {
+			t.Errorf("Expect %+v, got %+v", e, a)
+		}
+	}
+}
+
+func TestSplitByEventsShouldSeparateStocksWithTheEventType(t *testing.T) {
+	stocks := []Stock{{Code: "A", Value: 1}, {Code: "B", Value: 2}, {Code: "C", Value: 3}, {Code: "D"}}
+	events := []Event{{Code: "A", Type: eventUpperLimit}, {Code: "C", Type: eventUpperLimit}, {Code: "D", Type: eventLowerLimit}}
+
+	hit, rest := splitByEvents(stocks, events, eventUpperLimit)
+
+	if codes := extractCodes(hit); !reflect.DeepEqual(codes, []string{"C", "A"}) {
+		t.Errorf("Expect [C A], got %v", codes)
+	}
+	if codes := extractCodes(rest); !reflect.DeepEqual(codes, []string{"B", "D"}) {
+		t.Errorf("Expect [B D], got %v", codes)
+	}
+}
@@ -1,7 +1,6 @@
 package ingest
 
 import (
-	"container/list"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -11,50 +10,86 @@ import (
 
 	"github.com/chrishadi/instock/reader"
 	"github.com/chrishadi/instock/tbot"
-	"github.com/chrishadi/instock/toplist"
-	"github.com/go-pg/pg/v10"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
 	StockApiUrl string `required:"true" split_words:"true"`
+	Storage     string `default:"postgres"`
 	PG          struct {
 		Network      string
 		Addr         string
-		Database     string `required:"true"`
+		Database     string
 		TestDatabase string `split_words:"true"`
-		User         string `required:"true"`
-		Password     string `required:"true"`
+		User         string
+		Password     string
+	}
+	SQLite struct {
+		Path string
 	}
 	Bot struct {
-		Host   string
-		Token  string
-		ChatId int `split_words:"true"`
+		Host          string
+		Token         string
+		ChatId        int    `split_words:"true"`
+		WebhookSecret string `split_words:"true"`
 	}
 	NumOfTopRank int `required:"true" split_words:"true"`
+	Rank         RankConfig
+	Report       struct {
+		SubSectors bool `split_words:"true"`
+	}
+	Spike     SpikeConfig
+	Limit     LimitConfig
+	Pattern   PatternConfig
+	Retention struct {
+		Days       int
+		Resolution string `default:"day"`
+	}
 }
 
 type PubSubMessage struct {
 	Data []byte `json:"data"`
 }
 
-type StockGain struct {
-	Code string
-	Gain float64
+type RankConfig struct {
+	TieBreak    string `split_words:"true" default:"value"`
+	IncludeTies bool   `split_words:"true"`
+	Metrics     string
+	RankFilter
 }
 
+const (
+	tieBreakCode  = "code"
+	tieBreakValue = "value"
+)
+
 type report struct {
-	received int
-	active   int
-	stale    int
-	new      []string
-	gainers  []string
-	losers   []string
+	received   int
+	active     int
+	stale      int
+	new        []string
+	gainers    []Stock
+	losers     []Stock
+	upper      []Stock
+	lower      []Stock
+	rankings   []rankingResult
+	filter     string
+	ranked     int
+	sectors    []SectorPerformance
+	breadth    *MarketBreadth
+	events     []Event
+	unusual    []unusualActivity
+	patterns   []stockPatterns
+	watchlists []watchlistSection
+	portfolio  *portfolioValuation
+	indices    []IndexValue
+
+	showSubSectors bool
 }
 
 func Ingest(ctx context.Context, m PubSubMessage) error {
-	var cfg Config
-	if err := envconfig.Process("", &cfg); err != nil {
+	cfg, err := loadConfig()
+	if err != nil {
 		log.Panic(err)
 	}
 
@@ -62,15 +97,12 @@ func Ingest(ctx context.Context, m PubSubMessage) error {
 	sb := &strings.Builder{}
 	defer sendBufferToBot(sb, bot)
 
-	pgOpts := pg.Options{
-		Network:  cfg.PG.Network,
-		Addr:     cfg.PG.Addr,
-		Database: cfg.PG.Database,
-		User:     cfg.PG.User,
-		Password: cfg.PG.Password,
+	store, err := openStorage(cfg)
+	if err != nil {
+		logwb(err, sb)
+		return err
 	}
-	db := pg.Connect(&pgOpts)
-	defer db.Close()
+	defer store.close()
 
 	buf, err := getStockJsonFromApi(cfg.StockApiUrl)
 	if err != nil {
@@ -83,8 +115,7 @@ func Ingest(ctx context.Context, m PubSubMessage) error {
 		return err
 	}
 
-	stockLastUpdateRepo := PGStockLastUpdateRepository{db: db}
-	stockLastUpdates, err := stockLastUpdateRepo.Get()
+	stockLastUpdates, err := store.lastUpdates.Get()
 	if err != nil {
 		logwb(err, sb)
 		return err
@@ -95,30 +126,155 @@ func Ingest(ctx context.Context, m PubSubMessage) error {
 		return err
 	}
 
-	var gainers, losers []string
+	var gainers, losers, upper, lower []Stock
+	var rankings []rankingResult
+	var sectors []SectorPerformance
+	var breadth *MarketBreadth
+	var events []Event
+	var unusual []unusualActivity
+	var patterns []stockPatterns
+	var watchlists []watchlistSection
+	var portfolio *portfolioValuation
+	var indices []IndexValue
+	// without its watchlist, the filter ranks no stock rather than all of them
+	if cfg.Rank.RankFilter, err = cfg.Rank.resolve(store.watchlists); err != nil {
+		logwb(err, sb)
+	}
+	candidates := cfg.Rank.apply(facets.Active)
 
 	if len(facets.Active) > 0 {
-		stockRepo := PGStockRepository{db: db}
-		if err = ingestStocks(facets.Active, stockRepo, stockLastUpdateRepo); err != nil {
+		if err = ingestStocks(facets.Active, store.stocks, store.lastUpdates); err != nil {
+			logwb(err, sb)
+		}
+		if err = store.ratios.Upsert(stockRatios(facets.Active)); err != nil {
+			logwb(err, sb)
+		}
+		if err = updateDailyBars(facets.Active, store.dailyBars); err != nil {
+			logwb(err, sb)
+		}
+
+		values, err := updateIndicators(facets.Active, store.dailyBars, store.corporateActions, store.indicators)
+		if err != nil {
+			logwb(err, sb)
+		}
+		candidates = withIndicators(candidates, values)
+
+		alerts, err := checkAlerts(withIndicators(facets.Active, values), store.alerts)
+		if err != nil {
+			logwb(err, sb)
+		}
+		if len(alerts) > 0 {
+			msg := formatAlerts(alerts)
+			log.Print(msg)
+			if err = sendMessage(msg, bot); err != nil {
+				logwb(err, sb)
+			}
+		}
+
+		events, err = updateExtremeEvents(facets.Active, store.dailyBars, store.events)
+		if err != nil {
+			logwb(err, sb)
+		}
+
+		unusual, err = updateSpikeEvents(facets.Active, cfg.Spike, store.dailyBars, store.events)
+		if err != nil {
+			logwb(err, sb)
+		}
+
+		patterns, err = updatePatternEvents(facets.Active, cfg.Pattern, store.events)
+		if err != nil {
+			logwb(err, sb)
+		}
+
+		// stocks at their limits are reported apart from ordinary gainers and losers
+		limits, err := updateLimitEvents(facets.Active, cfg.Limit, store.events)
+		if err != nil {
+			logwb(err, sb)
+		}
+		var ordinary []Stock
+		upper, ordinary = splitByEvents(candidates, limits, eventUpperLimit)
+		lower, ordinary = splitByEvents(ordinary, limits, eventLowerLimit)
+
+		gainers, losers, err = getTopStocks(ordinary, cfg.NumOfTopRank, cfg.Rank)
+		if err != nil {
+			logwb(err, sb)
+		}
+
+		rankings, err = getRankings(candidates, cfg.NumOfTopRank, cfg.Rank)
+		if err != nil {
+			logwb(err, sb)
+		}
+
+		sectors, err = updateSectorPerformances(stocks, store.sectors)
+		if err != nil {
+			logwb(err, sb)
+		}
+
+		breadth, err = updateBreadth(stocks, store.indicators, store.events, store.breadth)
+		if err != nil {
 			logwb(err, sb)
 		}
 
-		gainers, losers = getTopStockCodes(facets.Active, cfg.NumOfTopRank)
+		lists, err := store.watchlists.List()
+		if err != nil {
+			logwb(err, sb)
+		}
+		watchlists = watchlistSections(stocks, lists)
+
+		portfolio, err = updatePortfolio(stocks, store.trades, store.portfolio)
+		if err != nil {
+			logwb(err, sb)
+		}
+
+		indices, err = updateIndices(stocks, store.indices, store.indexValues, store.dailyBars)
+		if err != nil {
+			logwb(err, sb)
+		}
 	}
 
 	rep := &report{
-		received: len(stocks),
-		active:   len(facets.Active),
-		stale:    len(facets.Stale),
-		new:      extractCodes(facets.New),
-		gainers:  gainers,
-		losers:   losers,
+		received:   len(stocks),
+		active:     len(facets.Active),
+		stale:      len(facets.Stale),
+		new:        extractCodes(facets.New),
+		gainers:    gainers,
+		losers:     losers,
+		upper:      upper,
+		lower:      lower,
+		rankings:   rankings,
+		filter:     cfg.Rank.RankFilter.String(),
+		ranked:     len(candidates),
+		sectors:    sectors,
+		breadth:    breadth,
+		events:     events,
+		unusual:    unusual,
+		patterns:   patterns,
+		watchlists: watchlists,
+		portfolio:  portfolio,
+		indices:    indices,
+
+		showSubSectors: cfg.Report.SubSectors,
 	}
 	logReport(rep, sb)
 
+	// watchlists of other chats are sent on their own
+	for _, section := range watchlists {
+		if section.watchlist.ChatId != 0 && len(section.stocks) > 0 {
+			if err = sendMessage(section.String(), bot.WithChat(section.watchlist.ChatId)); err != nil {
+				logwb(err, sb)
+			}
+		}
+	}
+
 	return nil
 }
 
+func loadConfig() (*Config, error) {
+	var cfg Config
+	err := envconfig.Process("", &cfg)
+	return &cfg, err
+}
+
 func getStockJsonFromApi(url string) ([]byte, error) {
 	resp, err := http.Get(url)
 	if err != nil {
@@ -150,41 +306,27 @@ func insertStocks(stocks []Stock, repo StockRepository) error {
 	return nil
 }
 
-func getTopStockCodes(stocks []Stock, n int) ([]string, []string) {
-	gainers := toplist.New(n, func(a, b interface{}) bool {
-		return a.(StockGain).Gain > b.(StockGain).Gain
-	})
-	losers := toplist.New(n, func(a, b interface{}) bool {
-		return a.(StockGain).Gain < b.(StockGain).Gain
-	})
-
+func getTopStocks(stocks []Stock, n int, rank RankConfig) ([]Stock, []Stock, error) {
+	var up, down []Stock
 	for _, stock := range stocks {
-		gain := stock.OneDay
-		if gain == 0.0 {
-			continue
+		if stock.OneDay > 0.0 {
+			up = append(up, stock)
+		} else if stock.OneDay < 0.0 {
+			down = append(down, stock)
 		}
-
-		var list *toplist.TopList
-		if gain > 0.0 {
-			list = gainers
-		} else {
-			list = losers
-		}
-		list.Add(StockGain{stock.Code, stock.OneDay})
 	}
 
-	gainerCodes := extractTopRankCodes(gainers.Elements())
-	loserCodes := extractTopRankCodes(losers.Elements())
-
-	return gainerCodes, loserCodes
-}
+	gainers, err := rankStocks(up, Ranking{Metric: "one_day", Desc: true, Size: n}, rank)
+	if err != nil {
+		return nil, nil, err
+	}
 
-func extractTopRankCodes(ls *list.List) []string {
-	codes := make([]string, 0, ls.Len())
-	for e := ls.Front(); e != nil; e = e.Next() {
-		codes = append(codes, e.Value.(StockGain).Code)
+	losers, err := rankStocks(down, Ranking{Metric: "one_day", Desc: false, Size: n}, rank)
+	if err != nil {
+		return nil, nil, err
 	}
-	return codes
+
+	return gainers, losers, nil
 }
 
 func extractCodes(stocks []Stock) []string {
@@ -203,11 +345,56 @@ func logReport(rep *report, sb *strings.Builder) {
 		logwb(strings.Join(rep.new, " "), sb)
 	}
 
+	if rep.breadth != nil {
+		logwb("Breadth: "+rep.breadth.String(), sb)
+	}
+	if len(rep.filter) > 0 {
+		logwb(fmt.Sprintf("Filter: %s, Ranked: %d", rep.filter, rep.ranked), sb)
+	}
+	if len(rep.upper) > 0 {
+		logwb("Upper limit:\n"+formatStockTable(rep.upper, "one_day"), sb)
+	}
 	if len(rep.gainers) > 0 {
-		logwb("Gainers: "+strings.Join(rep.gainers, " "), sb)
+		logwb("Gainers:\n"+formatStockTable(rep.gainers, "one_day"), sb)
 	}
 	if len(rep.losers) > 0 {
-		logwb("Losers: "+strings.Join(rep.losers, " "), sb)
+		logwb("Losers:\n"+formatStockTable(rep.losers, "one_day"), sb)
+	}
+	if len(rep.lower) > 0 {
+		logwb("Lower limit:\n"+formatStockTable(rep.lower, "one_day"), sb)
+	}
+	if len(rep.indices) > 0 {
+		logwb("Indices:\n"+formatIndexTable(rep.indices), sb)
+	}
+	for _, res := range rep.rankings {
+		if len(res.stocks) > 0 {
+			logwb(res.ranking.title()+":\n"+formatStockTable(res.stocks, res.ranking.Metric), sb)
+		}
+	}
+	if len(rep.sectors) > 0 {
+		logwb("Sectors:\n"+formatSectorTable(rep.sectors, levelSector), sb)
+		if rep.showSubSectors {
+			logwb("Sub-sectors:\n"+formatSectorTable(rep.sectors, levelSubSector), sb)
+		}
+	}
+	if len(rep.unusual) > 0 {
+		logwb("Unusual activity:\n"+formatSpikeTable(rep.unusual), sb)
+	}
+	if len(rep.patterns) > 0 {
+		logwb("Patterns:\n"+formatPatternTable(rep.patterns), sb)
+	}
+	for _, section := range rep.watchlists {
+		if section.watchlist.ChatId == 0 && len(section.stocks) > 0 {
+			logwb(section.String(), sb)
+		}
+	}
+	if rep.portfolio != nil {
+		logwb("Portfolio:\n"+rep.portfolio.String(), sb)
+	}
+	for _, section := range extremeSections {
+		if codes := eventCodes(rep.events, section.eventType); len(codes) > 0 {
+			logwb(section.title+": "+strings.Join(codes, " "), sb)
+		}
 	}
 }
 
@@ -232,5 +419,5 @@ func sendMessage(msg string, bot *tbot.Bot) error {
 		return nil
 	}
 
-	return bot.SendMessage(msg)
+	return bot.SendPreformatted(msg)
 }
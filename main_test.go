@@ -1,7 +1,6 @@
 package ingest
 
 import (
-	"container/list"
 	"context"
 	"errors"
 	"net/http"
@@ -66,17 +65,50 @@ func TestExtractCodesGivenStocksShouldReturnStockCodes(t *testing.T) {
 	}
 }
 
-func TestExtractTopRankCodesGivenListOfStockGainShouldReturnStockCodes(t *testing.T) {
-	ls := list.New()
-	ls.PushBack(StockGain{"A", 3.0})
-	ls.PushBack(StockGain{"B", 2.0})
-	ls.PushBack(StockGain{"C", 1.0})
-	expected := []string{"A", "B", "C"}
+func TestGetTopStocksGivenTiedGainsShouldRankByTieBreak(t *testing.T) {
+	stocks := []Stock{
+		{Code: "C", OneDay: 0.1, Value: 100},
+		{Code: "B", OneDay: 0.1, Value: 300},
+		{Code: "A", OneDay: 0.1, Value: 100},
+		{Code: "D", OneDay: -0.1, Value: 100},
+	}
 
-	actual := extractTopRankCodes(ls)
+	gainers, losers, err := getTopStocks(stocks, 2, RankConfig{TieBreak: tieBreakValue})
 
-	if !reflect.DeepEqual(actual, expected) {
-		t.Errorf("Expect %v, got %v", expected, actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []string{"B", "A"}, extractCodes(gainers); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect gainers %v, got %v", expected, actual)
+	}
+	if expected, actual := []string{"D"}, extractCodes(losers); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect losers %v, got %v", expected, actual)
+	}
+}
+
+func TestGetTopStocksGivenIncludeTiesShouldIncludeAllTiedAtTheCutoff(t *testing.T) {
+	stocks := []Stock{
+		{Code: "A", OneDay: 0.3},
+		{Code: "C", OneDay: 0.1},
+		{Code: "B", OneDay: 0.1},
+		{Code: "D", OneDay: 0.05},
+	}
+
+	gainers, _, err := getTopStocks(stocks, 2, RankConfig{TieBreak: tieBreakCode, IncludeTies: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := []string{"A", "B", "C"}, extractCodes(gainers); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect gainers %v, got %v", expected, actual)
+	}
+}
+
+func TestGetTopStocksGivenUnknownTieBreakShouldReturnError(t *testing.T) {
+	_, _, err := getTopStocks([]Stock{a}, 2, RankConfig{TieBreak: "name"})
+
+	if err == nil {
+		t.Error("Expect error not to be nil")
 	}
 }
 
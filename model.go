@@ -1,5 +1,16 @@
 package ingest
 
+import (
+	"time"
+
+	"github.com/chrishadi/instock/indicators"
+)
+
+const (
+	apiTimeLayout = "2006-01-02T15:04:05"
+	dbTimeLayout  = "2006-01-02 15:04:05"
+)
+
 type Stock struct {
 	Name              string  `json:"Name"`
 	Code              string  `json:"Code"`
@@ -17,9 +28,83 @@ type Stock struct {
 	Value             float64 `json:"Value"`
 	OneDay            float64 `json:"OneDay"`
 	LastUpdate        string  `json:"LastUpdate"`
+
+	// Multi-horizon returns, used for rankings and not stored.
+	OneWeek    float64 `json:"OneWeek" pg:"-"`
+	OneMonth   float64 `json:"OneMonth" pg:"-"`
+	ThreeMonth float64 `json:"ThreeMonth" pg:"-"`
+	SixMonth   float64 `json:"SixMonth" pg:"-"`
+	OneYear    float64 `json:"OneYear" pg:"-"`
+	Mtd        float64 `json:"Mtd" pg:"-"`
+	Ytd        float64 `json:"Ytd" pg:"-"`
+
+	// Valuation ratios and market capitalization, used for rankings, screens and custom indices,
+	// and not stored with the snapshots, see StockRatios.
+	Per            float64 `json:"Per" pg:"-"`
+	Pbr            float64 `json:"Pbr" pg:"-"`
+	Roe            float64 `json:"Roe" pg:"-"`
+	Capitalization float64 `json:"Capitalization" pg:"-"`
+
+	// Technical indicators as of the stock's trading day, used for rankings and not stored.
+	Indicators indicators.Values `json:"-" pg:"-"`
+}
+
+// StockRatios are the fields of the latest snapshot of a code that the snapshots do not store,
+// kept so that stored stocks can be screened like those of a batch.
+type StockRatios struct {
+	Code           string  `pg:",pk"`
+	OneWeek        float64 `pg:",use_zero"`
+	OneMonth       float64 `pg:",use_zero"`
+	ThreeMonth     float64 `pg:",use_zero"`
+	SixMonth       float64 `pg:",use_zero"`
+	OneYear        float64 `pg:",use_zero"`
+	Mtd            float64 `pg:",use_zero"`
+	Ytd            float64 `pg:",use_zero"`
+	Per            float64 `pg:",use_zero"`
+	Pbr            float64 `pg:",use_zero"`
+	Roe            float64 `pg:",use_zero"`
+	Capitalization float64 `pg:",use_zero"`
 }
 
 type StockLastUpdate struct {
 	Code       string `json:"Code"`
 	LastUpdate string `json:"LastUpdate"`
 }
+
+// parseLastUpdate parses a LastUpdate as received from the api or as read back from the database.
+func parseLastUpdate(s string) (time.Time, error) {
+	t, err := time.Parse(apiTimeLayout, s)
+	if err != nil {
+		t, err = time.Parse(dbTimeLayout, s)
+	}
+	return t, err
+}
+
+func stockRatios(stocks []Stock) []StockRatios {
+	res := make([]StockRatios, len(stocks))
+	for i, s := range stocks {
+		res[i] = StockRatios{
+			Code: s.Code, OneWeek: s.OneWeek, OneMonth: s.OneMonth, ThreeMonth: s.ThreeMonth, SixMonth: s.SixMonth,
+			OneYear: s.OneYear, Mtd: s.Mtd, Ytd: s.Ytd, Per: s.Per, Pbr: s.Pbr, Roe: s.Roe, Capitalization: s.Capitalization,
+		}
+	}
+	return res
+}
+
+// withRatios returns a copy of stocks with the stored ratios of their codes.
+func withRatios(stocks []Stock, ratios []StockRatios) []Stock {
+	byCode := make(map[string]StockRatios, len(ratios))
+	for _, r := range ratios {
+		byCode[r.Code] = r
+	}
+
+	res := make([]Stock, len(stocks))
+	for i, s := range stocks {
+		if r, exist := byCode[s.Code]; exist {
+			s.OneWeek, s.OneMonth, s.ThreeMonth, s.SixMonth, s.OneYear, s.Mtd, s.Ytd = r.OneWeek, r.OneMonth, r.ThreeMonth, r.SixMonth, r.OneYear, r.Mtd, r.Ytd
+			s.Per, s.Pbr, s.Roe, s.Capitalization = r.Per, r.Pbr, r.Roe, r.Capitalization
+		}
+		res[i] = s
+	}
+	return res
+}
@@ -0,0 +1,123 @@
+package ingest
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// Pattern event types
+const (
+	eventGapUp        = "gap_up"
+	eventGapDown      = "gap_down"
+	eventGapFill      = "gap_fill"
+	eventReversalUp   = "reversal_up"
+	eventReversalDown = "reversal_down"
+)
+
+// PatternConfig holds the thresholds of the price patterns. Gap is the minimum opening gap and
+// Reversal the minimum intraday move, both ratios of the previous close, that a reversal gives back
+// to close within ReversalClose, a ratio of the day's range, of the opposite extreme,
+// and beyond both the previous close and the open.
+type PatternConfig struct {
+	Gap           float64 `default:"0.03"`
+	Reversal      float64 `default:"0.05"`
+	ReversalClose float64 `split_words:"true" default:"0.25"`
+}
+
+// stockPatterns is a stock with the patterns it formed, in the order detected.
+type stockPatterns struct {
+	stock    Stock
+	patterns []string
+}
+
+// detectPatterns returns the pattern events of stocks: opening gaps, gaps filled during the day,
+// and reversals of a big intraday move, e.g. up big then closing near the low.
+func detectPatterns(stocks []Stock, day time.Time, cfg PatternConfig) []Event {
+	var events []Event
+	for _, s := range stocks {
+		prev, open := float64(s.PrevClosingPrice), float64(s.AdjustedOpenPrice)
+		high, low, last := float64(s.AdjustedHighPrice), float64(s.AdjustedLowPrice), float64(s.Last)
+		if prev <= 0 || open <= 0 || low <= 0 {
+			continue
+		}
+
+		switch {
+		case open >= prev*(1+cfg.Gap):
+			events = append(events, Event{s.Code, day, eventGapUp, open, prev})
+			if low <= prev {
+				events = append(events, Event{s.Code, day, eventGapFill, low, prev})
+			}
+		case open <= prev*(1-cfg.Gap):
+			events = append(events, Event{s.Code, day, eventGapDown, open, prev})
+			if high >= prev {
+				events = append(events, Event{s.Code, day, eventGapFill, high, prev})
+			}
+		}
+
+		// a reversal closes beyond both the previous close and the open, giving back the whole move,
+		// so neither a day without range, e.g. locked at a limit, nor a gap that held is one
+		if high <= low {
+			continue
+		}
+		margin := cfg.ReversalClose * (high - low)
+		switch {
+		case high >= prev*(1+cfg.Reversal) && last-low <= margin && last <= math.Min(prev, open):
+			events = append(events, Event{s.Code, day, eventReversalDown, last, high})
+		case low <= prev*(1-cfg.Reversal) && high-last <= margin && last >= math.Max(prev, open):
+			events = append(events, Event{s.Code, day, eventReversalUp, last, low})
+		}
+	}
+
+	return events
+}
+
+// groupPatterns returns the stocks with patterns, in the order of their first event.
+func groupPatterns(stocks []Stock, events []Event) []stockPatterns {
+	byCode := make(map[string]Stock, len(stocks))
+	for _, s := range stocks {
+		byCode[s.Code] = s
+	}
+
+	index := make(map[string]int)
+	var res []stockPatterns
+	for _, e := range events {
+		i, exist := index[e.Code]
+		if !exist {
+			i = len(res)
+			index[e.Code] = i
+			res = append(res, stockPatterns{stock: byCode[e.Code]})
+		}
+		res[i].patterns = append(res[i].patterns, e.Type)
+	}
+	return res
+}
+
+// updatePatternEvents detects the patterns of the stocks of the latest trading day of the batch
+// and stores them as events.
+func updatePatternEvents(stocks []Stock, cfg PatternConfig, repo EventRepository) ([]stockPatterns, error) {
+	current, day, err := currentStocks(stocks)
+	if err != nil || len(current) == 0 {
+		return nil, err
+	}
+
+	events := detectPatterns(current, day, cfg)
+	if err = repo.Upsert(events); err != nil {
+		return nil, err
+	}
+	return groupPatterns(current, events), nil
+}
+
+// formatPatternTable renders the stocks as aligned columns of code, name, last price, change, gap and patterns.
+func formatPatternTable(patterns []stockPatterns) string {
+	rows := [][]string{{"Code", "Name", "Last", "Chg", "Gap", "Patterns"}}
+	for _, p := range patterns {
+		s := p.stock
+		rows = append(rows, []string{
+			s.Code, truncate(s.Name, maxNameLength), formatPrice(s.Last), formatPercent(s.OneDay),
+			formatPercent(metrics["gap"](s)), strings.Join(p.patterns, " "),
+		})
+	}
+
+	return alignColumns(rows, []bool{false, false, true, true, true, false})
+}
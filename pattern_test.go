@@ -0,0 +1,81 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectPatternsShouldFlagGapsFillsAndReversals(t *testing.T) {
+	day := date("2020-02-03")
+	cfg := PatternConfig{Gap: 0.03, Reversal: 0.05, ReversalClose: 0.25}
+	stocks := []Stock{
+		// gap up that held
+		{Code: "A", PrevClosingPrice: 100, AdjustedOpenPrice: 104, AdjustedHighPrice: 106, AdjustedLowPrice: 103, Last: 105},
+		// gap down filled
+		{Code: "B", PrevClosingPrice: 100, AdjustedOpenPrice: 96, AdjustedHighPrice: 101, AdjustedLowPrice: 95, Last: 98},
+		// up big then closing near the low
+		{Code: "C", PrevClosingPrice: 100, AdjustedOpenPrice: 101, AdjustedHighPrice: 110, AdjustedLowPrice: 98, Last: 100},
+		// gap up filled, then down big and closing near the high
+		{Code: "D", PrevClosingPrice: 100, AdjustedOpenPrice: 103, AdjustedHighPrice: 104, AdjustedLowPrice: 94, Last: 103},
+		// ordinary day
+		{Code: "E", PrevClosingPrice: 100, AdjustedOpenPrice: 101, AdjustedHighPrice: 104, AdjustedLowPrice: 99, Last: 100},
+		// no trade
+		{Code: "F", PrevClosingPrice: 100},
+		// locked at the upper limit, without range
+		{Code: "G", PrevClosingPrice: 100, AdjustedOpenPrice: 125, AdjustedHighPrice: 125, AdjustedLowPrice: 125, Last: 125},
+		// gap up that held, closing at the low but above the previous close
+		{Code: "H", PrevClosingPrice: 100, AdjustedOpenPrice: 110, AdjustedHighPrice: 111, AdjustedLowPrice: 109, Last: 109},
+	}
+
+	actual := detectPatterns(stocks, day, cfg)
+
+	expected := []Event{
+		{"A", day, eventGapUp, 104, 100},
+		{"B", day, eventGapDown, 96, 100},
+		{"B", day, eventGapFill, 101, 100},
+		{"C", day, eventReversalDown, 100, 110},
+		{"D", day, eventGapUp, 103, 100},
+		{"D", day, eventGapFill, 94, 100},
+		{"D", day, eventReversalUp, 103, 94},
+		{"G", day, eventGapUp, 125, 100},
+		{"H", day, eventGapUp, 110, 100},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func TestUpdatePatternEventsShouldStoreEventsAndGroupThemByStock(t *testing.T) {
+	repo := &MemEventRepository{}
+	stocks := []Stock{
+		{Code: "A", PrevClosingPrice: 100, AdjustedOpenPrice: 96, AdjustedHighPrice: 101, AdjustedLowPrice: 95, Last: 98, LastUpdate: "2020-02-03T16:00:00"},
+		{Code: "B", PrevClosingPrice: 100, AdjustedOpenPrice: 100, AdjustedHighPrice: 100, AdjustedLowPrice: 100, Last: 100, LastUpdate: "2020-02-03T16:00:00"},
+	}
+
+	actual, err := updatePatternEvents(stocks, PatternConfig{Gap: 0.03, Reversal: 0.05, ReversalClose: 0.25}, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []stockPatterns{{stocks[0], []string{eventGapDown, eventGapFill}}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+	if stored, _ := repo.Get("A", date("2020-02-03"), date("2020-02-03")); len(stored) != 2 {
+		t.Errorf("Expect 2 events stored, got %+v", stored)
+	}
+}
+
+func TestFormatPatternTableShouldListPatternsOfEachStock(t *testing.T) {
+	patterns := []stockPatterns{
+		{Stock{Code: "A", Name: "Alpha", Last: 98, OneDay: -0.02, PrevClosingPrice: 100, AdjustedOpenPrice: 96}, []string{eventGapDown, eventGapFill}},
+	}
+
+	actual := formatPatternTable(patterns)
+
+	expected := "Code Name  Last    Chg    Gap Patterns\n" +
+		"A    Alpha   98 -2.00% -4.00% gap_down gap_fill"
+	if actual != expected {
+		t.Errorf("Expect\n%s\ngot\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,407 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sharesPerLot is the number of shares in a lot, the unit stocks are traded in.
+const sharesPerLot = 100
+
+// Trade sides
+const (
+	sideBuy  = "buy"
+	sideSell = "sell"
+)
+
+// Trade is a buy or sell of a code. Fees are the total fees of the trade, added to the cost of a buy
+// and deducted from the proceeds of a sell. Positions are derived from the trades.
+type Trade struct {
+	Id    int64
+	Code  string
+	Date  time.Time `pg:"type:date"`
+	Side  string
+	Lots  int
+	Price float64 `pg:",use_zero"`
+	Fees  float64 `pg:",use_zero"`
+}
+
+// describe names the trade in errors, a trade not yet added having no Id.
+func (t Trade) describe() string {
+	if t.Id == 0 {
+		return "the new trade"
+	}
+	return fmt.Sprintf("trade %d", t.Id)
+}
+
+// PortfolioSnapshot values the portfolio at the end of a trading day, or as of the last run of the day.
+// DailyPnl is the change of the total, unrealized and realized, P&L since the previous snapshot.
+type PortfolioSnapshot struct {
+	Date        time.Time `pg:",pk,type:date"`
+	MarketValue float64   `pg:",use_zero"`
+	Cost        float64   `pg:",use_zero"`
+	Unrealized  float64   `pg:",use_zero"`
+	Realized    float64   `pg:",use_zero"`
+	DailyPnl    float64   `pg:",use_zero"`
+}
+
+// position is the holding of a code, at its average cost including fees.
+type position struct {
+	code     string
+	shares   float64
+	cost     float64
+	realized float64
+}
+
+// positionValue is a position marked to the market price of its stock.
+type positionValue struct {
+	position
+	stock      Stock
+	value      float64
+	unrealized float64
+}
+
+type sectorAllocation struct {
+	name   string
+	value  float64
+	weight float64
+}
+
+type portfolioValuation struct {
+	positions  []positionValue
+	allocation []sectorAllocation
+	snapshot   PortfolioSnapshot
+}
+
+// buildPositions replays the trades up to day, oldest first, into positions ordered by code.
+// Trades of the same day are replayed in the order added, a trade not yet added, i.e. without Id, last.
+// Closed positions are kept for their realized P&L.
+func buildPositions(trades []Trade, day time.Time) ([]position, error) {
+	sorted := append([]Trade(nil), trades...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Date.Before(sorted[j].Date)
+		}
+		if sorted[i].Id == 0 || sorted[j].Id == 0 {
+			return sorted[j].Id == 0 && sorted[i].Id != 0
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+
+	index := make(map[string]int)
+	var positions []position
+	for _, t := range sorted {
+		if t.Date.After(day) {
+			break
+		}
+
+		i, exist := index[t.Code]
+		if !exist {
+			i = len(positions)
+			index[t.Code] = i
+			positions = append(positions, position{code: t.Code})
+		}
+
+		p := &positions[i]
+		shares := float64(t.Lots * sharesPerLot)
+		switch t.Side {
+		case sideBuy:
+			p.shares += shares
+			p.cost += shares*t.Price + t.Fees
+		case sideSell:
+			if shares > p.shares {
+				return nil, fmt.Errorf("%s sells %d lots of %s on %s, more than the %g held",
+					t.describe(), t.Lots, t.Code, t.Date.Format("2006-01-02"), p.shares/sharesPerLot)
+			}
+			avg := p.cost / p.shares
+			p.realized += shares*t.Price - t.Fees - shares*avg
+			p.cost -= shares * avg
+			p.shares -= shares
+		default:
+			return nil, fmt.Errorf("%s has invalid side %q", t.describe(), t.Side)
+		}
+	}
+
+	sort.Slice(positions, func(i, j int) bool { return positions[i].code < positions[j].code })
+	return positions, nil
+}
+
+// checkTrades replays the whole ledger, rejecting it if any trade sells more than held at its date.
+func checkTrades(trades []Trade) error {
+	var last time.Time
+	for _, t := range trades {
+		if t.Date.After(last) {
+			last = t.Date
+		}
+	}
+	_, err := buildPositions(trades, last)
+	return err
+}
+
+// valuePortfolio marks the positions of the trades to the last prices of stocks on day.
+// Positions of codes missing from stocks are valued at cost. Without a previous snapshot,
+// the daily P&L is that of the price changes of the positions.
+func valuePortfolio(trades []Trade, stocks []Stock, day time.Time, prev *PortfolioSnapshot) (*portfolioValuation, error) {
+	positions, err := buildPositions(trades, day)
+	if err != nil {
+		return nil, err
+	}
+
+	byCode := make(map[string]Stock, len(stocks))
+	for _, s := range stocks {
+		byCode[s.Code] = s
+	}
+
+	val := &portfolioValuation{snapshot: PortfolioSnapshot{Date: day}}
+	snap := &val.snapshot
+	sectors := make(map[string]float64)
+	var priceChange float64
+	for _, p := range positions {
+		snap.Realized += p.realized
+		if p.shares == 0 {
+			continue
+		}
+
+		pv := positionValue{position: p, value: p.cost}
+		if s, exist := byCode[p.code]; exist && s.Last > 0 {
+			pv.stock = s
+			pv.value = p.shares * float64(s.Last)
+			if s.PrevClosingPrice > 0 {
+				priceChange += p.shares * float64(s.Last-s.PrevClosingPrice)
+			}
+		}
+		pv.unrealized = pv.value - p.cost
+
+		snap.MarketValue += pv.value
+		snap.Cost += p.cost
+		snap.Unrealized += pv.unrealized
+		sectors[pv.stock.SectorName] += pv.value
+		val.positions = append(val.positions, pv)
+	}
+
+	snap.DailyPnl = priceChange
+	if prev != nil {
+		snap.DailyPnl = snap.Unrealized + snap.Realized - prev.Unrealized - prev.Realized
+	}
+
+	for name, value := range sectors {
+		a := sectorAllocation{name: name, value: value}
+		if snap.MarketValue > 0 {
+			a.weight = value / snap.MarketValue
+		}
+		val.allocation = append(val.allocation, a)
+	}
+	sort.Slice(val.allocation, func(i, j int) bool {
+		if val.allocation[i].value != val.allocation[j].value {
+			return val.allocation[i].value > val.allocation[j].value
+		}
+		return val.allocation[i].name < val.allocation[j].name
+	})
+
+	return val, nil
+}
+
+// updatePortfolio values the portfolio at the last prices of the batch and stores its snapshot of the day.
+func updatePortfolio(stocks []Stock, trades TradeRepository, snapshots PortfolioSnapshotRepository) (*portfolioValuation, error) {
+	list, err := trades.List()
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+
+	_, day, err := currentStocks(stocks)
+	if err != nil {
+		return nil, err
+	}
+
+	prev, err := snapshots.Before(day)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := valuePortfolio(list, stocks, day, prev)
+	if err != nil {
+		return nil, err
+	}
+	return val, snapshots.Upsert(val.snapshot)
+}
+
+func (val portfolioValuation) String() string {
+	rows := [][]string{{"Code", "Lots", "Avg", "Last", "Value", "P&L", "%"}}
+	for _, p := range val.positions {
+		rows = append(rows, []string{
+			p.code, fmt.Sprintf("%g", p.shares/sharesPerLot), fmt.Sprintf("%.0f", p.cost/p.shares), formatPrice(p.stock.Last),
+			formatAmount(p.value), formatSignedAmount(p.unrealized), formatPercent(p.unrealized / p.cost),
+		})
+	}
+
+	snap := val.snapshot
+	totals := fmt.Sprintf("Value: %s, Cost: %s, Unrealized: %s, Realized: %s, Daily: %s",
+		formatAmount(snap.MarketValue), formatAmount(snap.Cost), formatSignedAmount(snap.Unrealized),
+		formatSignedAmount(snap.Realized), formatSignedAmount(snap.DailyPnl))
+
+	allocation := [][]string{{"Sector", "Value", "Weight"}}
+	for _, a := range val.allocation {
+		name := a.name
+		if len(name) == 0 {
+			name = "Unknown"
+		}
+		allocation = append(allocation, []string{truncate(name, maxNameLength), formatAmount(a.value), fmt.Sprintf("%.2f%%", a.weight*100)})
+	}
+
+	return alignColumns(rows, []bool{false, true, true, true, true, true, true}) + "\n" + totals + "\n" +
+		alignColumns(allocation, []bool{false, true, true})
+}
+
+func formatSignedAmount(v float64) string {
+	if v > 0 {
+		return "+" + formatAmount(v)
+	}
+	return formatAmount(v)
+}
+
+func init() {
+	commands["trades"] = command{"trades [CODE]: list the trades, of a code if given", listTrades}
+	commands["trade-add"] = command{"trade-add CODE buy|sell LOTS PRICE [FEES [DATE]]: record a trade, of today unless DATE is given as 2006-01-02", addTrade}
+	commands["trade-delete"] = command{"trade-delete ID: delete a trade", deleteTrade}
+	commands["portfolio"] = command{"portfolio: value the portfolio at the latest stored prices", showPortfolio}
+}
+
+func listTrades(w io.Writer, store *storage, args []string) error {
+	trades, err := store.trades.List()
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"Id", "Date", "Code", "Side", "Lots", "Price", "Fees"}}
+	for _, t := range trades {
+		if len(args) > 0 && !strings.EqualFold(t.Code, args[0]) {
+			continue
+		}
+		rows = append(rows, []string{
+			strconv.FormatInt(t.Id, 10), t.Date.Format("2006-01-02"), t.Code, t.Side,
+			strconv.Itoa(t.Lots), fmt.Sprintf("%g", t.Price), fmt.Sprintf("%g", t.Fees),
+		})
+	}
+	_, err = fmt.Fprintln(w, alignColumns(rows, []bool{true, false, false, false, true, true, true}))
+	return err
+}
+
+func addTrade(w io.Writer, store *storage, args []string) error {
+	if len(args) < 4 || len(args) > 6 {
+		return errors.New("usage: trade-add CODE buy|sell LOTS PRICE [FEES [DATE]]")
+	}
+
+	t, err := parseTrade(args, tradingDay(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	// replay the ledger with the trade to reject selling more than held, at its date or later
+	trades, err := store.trades.List()
+	if err != nil {
+		return err
+	}
+	if err = checkTrades(append(trades, t)); err != nil {
+		return err
+	}
+
+	if err = store.trades.Add(&t); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Added trade %d: %s %s %d lots of %s at %g\n", t.Id, t.Date.Format("2006-01-02"), t.Side, t.Lots, t.Code, t.Price)
+	return err
+}
+
+// parseTrade parses the arguments of trade-add, the trade being of today unless a date is given.
+func parseTrade(args []string, today time.Time) (Trade, error) {
+	t := Trade{Code: strings.ToUpper(args[0]), Side: strings.ToLower(args[1]), Date: today}
+	if t.Side != sideBuy && t.Side != sideSell {
+		return t, fmt.Errorf("invalid trade side %q, expect buy or sell", args[1])
+	}
+
+	var err error
+	if t.Lots, err = strconv.Atoi(args[2]); err != nil || t.Lots <= 0 {
+		return t, fmt.Errorf("invalid lots %q", args[2])
+	}
+	if t.Price, err = strconv.ParseFloat(args[3], 64); err != nil || t.Price <= 0 {
+		return t, fmt.Errorf("invalid price %q", args[3])
+	}
+	if len(args) > 4 {
+		if t.Fees, err = strconv.ParseFloat(args[4], 64); err != nil || t.Fees < 0 {
+			return t, fmt.Errorf("invalid fees %q", args[4])
+		}
+	}
+	if len(args) > 5 {
+		if t.Date, err = time.Parse("2006-01-02", args[5]); err != nil {
+			return t, fmt.Errorf("invalid date %q", args[5])
+		}
+	}
+
+	return t, nil
+}
+
+func deleteTrade(w io.Writer, store *storage, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: trade-delete ID")
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid trade id %q", args[0])
+	}
+
+	// replay the ledger without the trade, e.g. a buy that later sells depend on
+	trades, err := store.trades.List()
+	if err != nil {
+		return err
+	}
+	kept := make([]Trade, 0, len(trades))
+	for _, t := range trades {
+		if t.Id != id {
+			kept = append(kept, t)
+		}
+	}
+	if err = checkTrades(kept); err != nil {
+		return fmt.Errorf("cannot delete trade %d: %w", id, err)
+	}
+
+	if err = store.trades.Delete(id); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Deleted trade %d\n", id)
+	return err
+}
+
+func showPortfolio(w io.Writer, store *storage, _ []string) error {
+	trades, err := store.trades.List()
+	if err != nil {
+		return err
+	}
+	if len(trades) == 0 {
+		_, err = fmt.Fprintln(w, "No trades")
+		return err
+	}
+
+	stocks, err := store.history.Latest()
+	if err != nil {
+		return err
+	}
+
+	day := tradingDay(time.Now())
+	prev, err := store.portfolio.Before(day)
+	if err != nil {
+		return err
+	}
+
+	val, err := valuePortfolio(trades, stocks, day, prev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, val)
+	return err
+}
@@ -0,0 +1,147 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+)
+
+var portfolioTrades = []Trade{
+	{Id: 1, Code: "A", Date: date("2020-01-02"), Side: sideBuy, Lots: 10, Price: 100, Fees: 100},
+	{Id: 2, Code: "A", Date: date("2020-01-03"), Side: sideBuy, Lots: 10, Price: 200, Fees: 100},
+	{Id: 3, Code: "A", Date: date("2020-01-06"), Side: sideSell, Lots: 5, Price: 300, Fees: 50},
+	{Id: 4, Code: "B", Date: date("2020-01-06"), Side: sideBuy, Lots: 1, Price: 1000},
+	{Id: 5, Code: "C", Date: date("2020-01-06"), Side: sideBuy, Lots: 1, Price: 50},
+	{Id: 6, Code: "B", Date: date("2020-02-04"), Side: sideBuy, Lots: 1, Price: 1000},
+}
+
+func TestBuildPositionsShouldUseAverageCostIncludingFees(t *testing.T) {
+	positions, err := buildPositions(portfolioTrades, date("2020-02-03"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A costs 300200 for 2000 shares, 150.1 each, of which 500 are sold at 300 less 50 fees
+	expected := []position{
+		{code: "A", shares: 1500, cost: 225150, realized: 150000 - 50 - 75050},
+		{code: "B", shares: 100, cost: 100000},
+		{code: "C", shares: 100, cost: 5000},
+	}
+	if !reflect.DeepEqual(positions, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, positions)
+	}
+}
+
+func TestBuildPositionsGivenSellOfMoreThanHeldShouldReturnError(t *testing.T) {
+	trades := []Trade{
+		{Id: 1, Code: "A", Date: date("2020-01-02"), Side: sideBuy, Lots: 1, Price: 100},
+		{Id: 2, Code: "A", Date: date("2020-01-03"), Side: sideSell, Lots: 2, Price: 100},
+	}
+
+	if _, err := buildPositions(trades, date("2020-01-03")); err == nil {
+		t.Error("Expect error, got nil")
+	}
+}
+
+func TestValuePortfolioShouldMarkPositionsToMarket(t *testing.T) {
+	day := date("2020-02-03")
+	stocks := []Stock{
+		{Code: "A", SectorName: "Finance", Last: 200, PrevClosingPrice: 190},
+		{Code: "B", SectorName: "Energy", Last: 1100, PrevClosingPrice: 1000},
+	}
+
+	val, err := valuePortfolio(portfolioTrades, stocks, day, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	realized := 150000 - 50 - 75050.0
+	expected := PortfolioSnapshot{
+		Date:        day,
+		MarketValue: 300000 + 110000 + 5000,
+		Cost:        225150 + 100000 + 5000,
+		Unrealized:  74850 + 10000,
+		Realized:    realized,
+		DailyPnl:    1500*10 + 100*100,
+	}
+	if val.snapshot != expected {
+		t.Errorf("Expect %+v, got %+v", expected, val.snapshot)
+	}
+
+	var names []string
+	for _, a := range val.allocation {
+		names = append(names, a.name)
+	}
+	if !reflect.DeepEqual(names, []string{"Finance", "Energy", ""}) || !almostEqual(val.allocation[0].weight, 300000.0/415000) {
+		t.Errorf("Expect allocation to Finance, Energy and the unknown sector of C, got %+v", val.allocation)
+	}
+
+	prev := &PortfolioSnapshot{Unrealized: 80000, Realized: realized}
+	if val, _ = valuePortfolio(portfolioTrades, stocks, day, prev); val.snapshot.DailyPnl != 4850 {
+		t.Errorf("Expect the daily P&L since the previous snapshot to be 4850, got %v", val.snapshot.DailyPnl)
+	}
+}
+
+func TestUpdatePortfolioShouldStoreTheSnapshotOfTheDay(t *testing.T) {
+	trades := &MemTradeRepository{}
+	for _, trade := range portfolioTrades[:2] {
+		trades.Add(&trade)
+	}
+	snapshots := &MemPortfolioSnapshotRepository{}
+	stocks := []Stock{{Code: "A", Name: "Alpha", SectorName: "Finance", Last: 200, PrevClosingPrice: 190, LastUpdate: "2020-02-03T16:00:00"}}
+
+	val, err := updatePortfolio(stocks, trades, snapshots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored, _ := snapshots.Before(date("2020-02-04")); stored == nil || *stored != val.snapshot {
+		t.Errorf("Expect %+v stored, got %+v", val.snapshot, stored)
+	}
+	expected := "Code Lots Avg Last  Value    P&L       %\n" +
+		"A      20 150  200 400.0K +99.8K +33.24%\n" +
+		"Value: 400.0K, Cost: 300.2K, Unrealized: +99.8K, Realized: 0, Daily: +20.0K\n" +
+		"Sector   Value  Weight\n" +
+		"Finance 400.0K 100.00%"
+	if actual := val.String(); actual != expected {
+		t.Errorf("Expect\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func TestTradeCommandsShouldRejectInvalidTradesAndOverselling(t *testing.T) {
+	store := memStorage()
+
+	// in order, the sell being checked against the buy
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"bbca", "BUY", "10", "8000", "0", "2020-01-02"}, "Added trade 1: 2020-01-02 buy 10 lots of BBCA at 8000\n"},
+		{[]string{"BBCA", "hold", "10", "8000"}, `invalid trade side "hold", expect buy or sell`},
+		{[]string{"BBCA", "buy", "0", "8000"}, `invalid lots "0"`},
+		{[]string{"BBCA", "sell", "11", "9000", "0", "2020-01-03"}, "the new trade sells 11 lots of BBCA on 2020-01-03, more than the 10 held"},
+		// a sell of the same day as the buy comes after it
+		{[]string{"BBCA", "sell", "4", "9000", "0", "2020-01-02"}, "Added trade 2: 2020-01-02 sell 4 lots of BBCA at 9000\n"},
+		{[]string{"BBCA", "sell", "5", "9000", "0", "2020-01-06"}, "Added trade 3: 2020-01-06 sell 5 lots of BBCA at 9000\n"},
+		// a back-dated sell that leaves too little for the later one
+		{[]string{"BBCA", "sell", "2", "9000", "0", "2020-01-03"}, "trade 3 sells 5 lots of BBCA on 2020-01-06, more than the 4 held"},
+	}
+	for _, test := range tests {
+		if out := commandOutput(store, "trade-add", test.args...); out != test.expected {
+			t.Errorf("%v: expect %q, got %q", test.args, test.expected, out)
+		}
+	}
+
+	// the buy is needed by the sells, while the last sell is not needed by any
+	deletes := []struct {
+		id       string
+		expected string
+	}{
+		{"1", "cannot delete trade 1: trade 2 sells 4 lots of BBCA on 2020-01-02, more than the 0 held"},
+		{"3", "Deleted trade 3\n"},
+	}
+	for _, test := range deletes {
+		if out := commandOutput(store, "trade-delete", test.id); out != test.expected {
+			t.Errorf("%s: expect %q, got %q", test.id, test.expected, out)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package ingest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chrishadi/instock/indicators"
+	"github.com/chrishadi/instock/toplist"
+)
+
+// metrics are the numeric stock fields and derived ratios that stocks can be ranked by.
+var metrics = map[string]func(Stock) float64{
+	"last":        func(s Stock) float64 { return float64(s.Last) },
+	"volume":      func(s Stock) float64 { return s.Volume },
+	"value":       func(s Stock) float64 { return s.Value },
+	"frequency":   func(s Stock) float64 { return s.Frequency },
+	"one_day":     func(s Stock) float64 { return s.OneDay },
+	"one_week":    func(s Stock) float64 { return s.OneWeek },
+	"one_month":   func(s Stock) float64 { return s.OneMonth },
+	"three_month": func(s Stock) float64 { return s.ThreeMonth },
+	"six_month":   func(s Stock) float64 { return s.SixMonth },
+	"one_year":    func(s Stock) float64 { return s.OneYear },
+	"mtd":         func(s Stock) float64 { return s.Mtd },
+	"ytd":         func(s Stock) float64 { return s.Ytd },
+	"range":       func(s Stock) float64 { return ratio(s.AdjustedHighPrice-s.AdjustedLowPrice, s.PrevClosingPrice) },
+	"gap":         func(s Stock) float64 { return ratio(s.AdjustedOpenPrice-s.PrevClosingPrice, s.PrevClosingPrice) },
+	"from_open":   func(s Stock) float64 { return ratio(s.Last-s.AdjustedOpenPrice, s.AdjustedOpenPrice) },
+	"per":         func(s Stock) float64 { return s.Per },
+	"pbr":         func(s Stock) float64 { return s.Pbr },
+	"roe":         func(s Stock) float64 { return s.Roe },
+	"market_cap":  func(s Stock) float64 { return s.Capitalization },
+}
+
+// indicatorMetrics are the technical indicators that stocks can be ranked by,
+// with the number of bars each needs to be available.
+var indicatorMetrics = map[string]struct {
+	bars  int
+	value func(indicators.Values) float64
+}{
+	"sma20":           {indicators.SmaShortPeriod, func(v indicators.Values) float64 { return v.Sma20 }},
+	"sma50":           {indicators.SmaLongPeriod, func(v indicators.Values) float64 { return v.Sma50 }},
+	"sma200":          {indicators.SmaTrendPeriod, func(v indicators.Values) float64 { return v.Sma200 }},
+	"ema12":           {indicators.EmaFastPeriod, func(v indicators.Values) float64 { return v.Ema12 }},
+	"ema26":           {indicators.EmaSlowPeriod, func(v indicators.Values) float64 { return v.Ema26 }},
+	"macd":            {indicators.EmaSlowPeriod, func(v indicators.Values) float64 { return v.Macd }},
+	"macd_signal":     {indicators.EmaSlowPeriod, func(v indicators.Values) float64 { return v.MacdSignal }},
+	"macd_hist":       {indicators.EmaSlowPeriod, func(v indicators.Values) float64 { return v.MacdHist }},
+	"rsi14":           {indicators.RsiPeriod + 1, func(v indicators.Values) float64 { return v.Rsi14 }},
+	"bollinger_upper": {indicators.BollingerPeriod, func(v indicators.Values) float64 { return v.BollingerUpper }},
+	"bollinger_lower": {indicators.BollingerPeriod, func(v indicators.Values) float64 { return v.BollingerLower }},
+	"atr14":           {indicators.AtrPeriod + 1, func(v indicators.Values) float64 { return v.Atr14 }},
+}
+
+func init() {
+	for name, m := range indicatorMetrics {
+		value := m.value
+		metrics[name] = func(s Stock) float64 { return value(s.Indicators) }
+	}
+}
+
+// hasMetric reports whether the metric of s is available, i.e. not an indicator still warming up.
+func hasMetric(s Stock, metric string) bool {
+	m, isIndicator := indicatorMetrics[metric]
+	return !isIndicator || s.Indicators.Bars >= m.bars
+}
+
+func ratio(a, b float32) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a / b)
+}
+
+// Ranking lists the Size stocks with the highest, or lowest if not Desc, Metric.
+type Ranking struct {
+	Metric string
+	Desc   bool
+	Size   int
+}
+
+type rankingResult struct {
+	ranking Ranking
+	stocks  []Stock
+}
+
+func (r Ranking) title() string {
+	if r.Desc {
+		return "Top " + r.Metric
+	}
+	return "Bottom " + r.Metric
+}
+
+// parseRankings parses a comma separated list of metric[:asc|desc[:size]],
+// e.g. "value:desc:10,one_week". Direction defaults to desc and size to defaultSize.
+func parseRankings(spec string, defaultSize int) ([]Ranking, error) {
+	var rankings []Ranking
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid ranking %q", item)
+		}
+
+		ranking := Ranking{Metric: parts[0], Desc: true, Size: defaultSize}
+		if _, exist := metrics[ranking.Metric]; !exist {
+			return nil, fmt.Errorf("unknown ranking metric %q, expect one of %s", ranking.Metric, metricNames())
+		}
+		if len(parts) > 1 {
+			switch parts[1] {
+			case "desc":
+			case "asc":
+				ranking.Desc = false
+			default:
+				return nil, fmt.Errorf("invalid ranking direction %q", parts[1])
+			}
+		}
+		if len(parts) > 2 {
+			size, err := strconv.Atoi(parts[2])
+			if err != nil || size <= 0 {
+				return nil, fmt.Errorf("invalid ranking size %q", parts[2])
+			}
+			ranking.Size = size
+		}
+
+		rankings = append(rankings, ranking)
+	}
+
+	return rankings, nil
+}
+
+func metricNames() string {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func rankStocks(stocks []Stock, ranking Ranking, rank RankConfig) ([]Stock, error) {
+	tieBreak, err := stockTieBreak(rank.TieBreak)
+	if err != nil {
+		return nil, err
+	}
+
+	metric := metrics[ranking.Metric]
+	more := func(a, b Stock) bool { return metric(a) > metric(b) }
+	if !ranking.Desc {
+		more = func(a, b Stock) bool { return metric(a) < metric(b) }
+	}
+
+	list := toplist.New(ranking.Size, more).BreakTiesBy(tieBreak)
+	if rank.IncludeTies {
+		list.IncludeTies()
+	}
+	for _, stock := range stocks {
+		if hasMetric(stock, ranking.Metric) {
+			list.Add(stock)
+		}
+	}
+
+	return list.Values(), nil
+}
+
+func getRankings(stocks []Stock, defaultSize int, rank RankConfig) ([]rankingResult, error) {
+	rankings, err := parseRankings(rank.Metrics, defaultSize)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]rankingResult, 0, len(rankings))
+	for _, ranking := range rankings {
+		ranked, err := rankStocks(stocks, ranking, rank)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rankingResult{ranking, ranked})
+	}
+
+	return results, nil
+}
+
+// stockTieBreak ranks equal stocks by the given key, then by code so that rankings are stable.
+func stockTieBreak(key string) (func(a, b Stock) bool, error) {
+	byCode := func(a, b Stock) bool { return a.Code < b.Code }
+
+	switch key {
+	case "", tieBreakCode:
+		return byCode, nil
+	case tieBreakValue:
+		return func(a, b Stock) bool {
+			if a.Value != b.Value {
+				return a.Value > b.Value
+			}
+			return byCode(a, b)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown rank tie break %q", key)
+	}
+}
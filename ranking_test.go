@@ -0,0 +1,97 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chrishadi/instock/indicators"
+)
+
+func TestParseRankingsShouldApplyDefaults(t *testing.T) {
+	expected := []Ranking{
+		{Metric: "value", Desc: true, Size: 10},
+		{Metric: "one_week", Desc: false, Size: 5},
+		{Metric: "frequency", Desc: true, Size: 5},
+	}
+
+	actual, err := parseRankings("value:desc:10, one_week:asc,frequency", 5)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func TestParseRankingsGivenEmptySpecShouldReturnNoRanking(t *testing.T) {
+	actual, err := parseRankings("", 5)
+
+	if err != nil || len(actual) != 0 {
+		t.Errorf("Expect no ranking and nil error, got %+v and %v", actual, err)
+	}
+}
+
+func TestParseRankingsGivenInvalidSpecShouldReturnError(t *testing.T) {
+	for _, spec := range []string{"name", "value:up", "value:desc:0", "value:desc:5:x"} {
+		if _, err := parseRankings(spec, 5); err == nil {
+			t.Errorf("Expect error for %q not to be nil", spec)
+		}
+	}
+}
+
+func TestGetRankingsShouldRankEachMetricWithItsOwnSizeAndDirection(t *testing.T) {
+	stocks := []Stock{
+		{Code: "A", Value: 300, Frequency: 1, OneWeek: 0.1},
+		{Code: "B", Value: 100, Frequency: 3, OneWeek: -0.2},
+		{Code: "C", Value: 200, Frequency: 2, OneWeek: 0.3},
+	}
+	rank := RankConfig{TieBreak: tieBreakCode, Metrics: "value:desc:2,frequency:asc:1,one_week"}
+
+	expected := map[Ranking][]string{
+		{"value", true, 2}:      {"A", "C"},
+		{"frequency", false, 1}: {"A"},
+		{"one_week", true, 3}:   {"C", "A", "B"},
+	}
+	actual, err := getRankings(stocks, 3, rank)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Expect %d rankings, got %d", len(expected), len(actual))
+	}
+	for _, res := range actual {
+		if codes := extractCodes(res.stocks); !reflect.DeepEqual(codes, expected[res.ranking]) {
+			t.Errorf("%+v: expect %v, got %v", res.ranking, expected[res.ranking], codes)
+		}
+	}
+}
+
+func TestMetricsShouldDeriveRangeGapAndChangeFromOpen(t *testing.T) {
+	s := Stock{PrevClosingPrice: 100, AdjustedOpenPrice: 110, AdjustedHighPrice: 120, AdjustedLowPrice: 95, Last: 99}
+
+	tests := map[string]float64{"range": 0.25, "gap": 0.1, "from_open": -0.1}
+	for name, expected := range tests {
+		if actual := metrics[name](s); !almostEqual(actual, expected) {
+			t.Errorf("%s: expect %g, got %g", name, expected, actual)
+		}
+	}
+}
+
+func TestRankStocksByIndicatorShouldSkipStocksStillWarmingUp(t *testing.T) {
+	stocks := []Stock{
+		{Code: "A", Indicators: indicators.Values{Bars: 30, Rsi14: 70}},
+		{Code: "B", Indicators: indicators.Values{Bars: 10}},
+		{Code: "C", Indicators: indicators.Values{Bars: 15, Rsi14: 20}},
+	}
+
+	actual, err := rankStocks(stocks, Ranking{Metric: "rsi14", Desc: false, Size: 3}, RankConfig{TieBreak: tieBreakCode})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes, expected := extractCodes(actual), []string{"C", "A"}; !reflect.DeepEqual(codes, expected) {
+		t.Errorf("Expect %v, got %v", expected, codes)
+	}
+}
@@ -1,11 +1,169 @@
 package ingest
 
-import "github.com/go-pg/pg/v10"
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
 
 type StockRepository interface {
 	Insert([]Stock) (int, error)
 }
 
+type StockHistoryRepository interface {
+	// History returns the snapshots of a code updated between from and to, inclusive, oldest first.
+	History(code string, from, to time.Time) ([]Stock, error)
+	// Latest returns the most recent snapshot of every code, ordered by code.
+	Latest() ([]Stock, error)
+	// AsOf returns the most recent snapshot of every code updated at or before t, ordered by code.
+	AsOf(t time.Time) ([]Stock, error)
+}
+
+type StockRetentionRepository interface {
+	// Downsample deletes all but the latest snapshot per code per resolution
+	// (day or hour) of snapshots updated before the given time, returning the number deleted.
+	// The last updates are refreshed and passed to verify in the same transaction,
+	// which is rolled back if verify returns an error.
+	Downsample(before time.Time, resolution string, verify func([]StockLastUpdate) error) (int, error)
+}
+
+type DailyBarRepository interface {
+	// Upsert stores bars, merging each into the stored bar of the same code and day.
+	Upsert([]Bar) error
+	// Daily returns the daily bars of a code between from and to, inclusive, oldest first.
+	Daily(code string, from, to time.Time) ([]Bar, error)
+	// Since returns the daily bars of every code from the given day, ordered by code then date.
+	Since(from time.Time) ([]Bar, error)
+	// AdjustedDaily is Daily with prices and volume adjusted for the corporate actions going ex after each bar
+	// up to to, so that they compare with the prices of that day whatever actions are known beyond it.
+	AdjustedDaily(code string, from, to time.Time) ([]Bar, error)
+	// AdjustedBetween is AdjustedDaily of every code, ordered by code then date.
+	AdjustedBetween(from, to time.Time) ([]Bar, error)
+	// Extremes returns the price extremes of the bars of every code before the given day, adjusted up to that day,
+	// ordered by code. The yearly ones are of the bars since the given day.
+	Extremes(since, before time.Time) ([]PriceExtremes, error)
+}
+
+type CorporateActionRepository interface {
+	// Upsert stores actions, replacing the stored action of the same code, type and ex-date.
+	Upsert([]CorporateAction) error
+	// Get returns the actions of a code, oldest ex-date first.
+	Get(code string) ([]CorporateAction, error)
+	// Since returns the actions of every code going ex from the given day, ordered by code then ex-date.
+	Since(from time.Time) ([]CorporateAction, error)
+}
+
+type SectorPerformanceRepository interface {
+	// Upsert stores performances, replacing the stored ones of the same day, level and id.
+	Upsert([]SectorPerformance) error
+	// Get returns the performances between from and to, inclusive, oldest first.
+	Get(from, to time.Time) ([]SectorPerformance, error)
+}
+
+type MarketBreadthRepository interface {
+	// Upsert stores the breadth, replacing the stored one of the same day.
+	Upsert(MarketBreadth) error
+	// Get returns the breadths between from and to, inclusive, oldest first.
+	Get(from, to time.Time) ([]MarketBreadth, error)
+	// Before returns the latest breadth before the given day, or nil if there is none.
+	Before(day time.Time) (*MarketBreadth, error)
+}
+
+type IndicatorRepository interface {
+	// Upsert stores the indicators, replacing the stored ones of the same code and day.
+	Upsert([]Indicator) error
+	// Before returns the latest indicators of every code before the given day.
+	Before(day time.Time) ([]Indicator, error)
+}
+
+type EventRepository interface {
+	// Upsert stores the events, replacing the stored ones of the same code, day and type.
+	Upsert([]Event) error
+	// Get returns the events of a code, or of every code if it is empty, between from and to,
+	// inclusive, ordered by date then code.
+	Get(code string, from, to time.Time) ([]Event, error)
+}
+
+type AlertRepository interface {
+	// Add stores a new rule and sets its Id.
+	Add(*AlertRule) error
+	// Delete deletes the rule of the given id.
+	Delete(id int64) error
+	// List returns all rules, ordered by id.
+	List() ([]AlertRule, error)
+	// SetTriggered stores the Triggered state of the rules.
+	SetTriggered([]AlertRule) error
+}
+
+type WatchlistRepository interface {
+	// Get returns the watchlist of the given name, or nil if there is none.
+	Get(name string) (*Watchlist, error)
+	// List returns all watchlists, ordered by name.
+	List() ([]Watchlist, error)
+	// Save stores the watchlist, replacing the stored one of the same name.
+	Save(Watchlist) error
+	// Delete deletes the watchlist of the given name.
+	Delete(name string) error
+}
+
+type TradeRepository interface {
+	// Add stores a new trade and sets its Id.
+	Add(*Trade) error
+	// Delete deletes the trade of the given id.
+	Delete(id int64) error
+	// List returns all trades, ordered by date then id.
+	List() ([]Trade, error)
+}
+
+type PortfolioSnapshotRepository interface {
+	// Upsert stores the snapshot, replacing the stored one of the same day.
+	Upsert(PortfolioSnapshot) error
+	// Before returns the latest snapshot before the given day, or nil if there is none.
+	Before(day time.Time) (*PortfolioSnapshot, error)
+}
+
+type CustomIndexRepository interface {
+	// Get returns the index of the given name, or nil if there is none.
+	Get(name string) (*CustomIndex, error)
+	// List returns all indices, ordered by name.
+	List() ([]CustomIndex, error)
+	// Save stores the index, replacing the stored one of the same name.
+	Save(CustomIndex) error
+	// Delete deletes the index of the given name.
+	Delete(name string) error
+}
+
+type IndexValueRepository interface {
+	// Upsert stores the values, replacing the stored ones of the same index and day.
+	Upsert([]IndexValue) error
+	// Before returns the latest value of every index before the given day.
+	Before(day time.Time) ([]IndexValue, error)
+	// Get returns the values of an index since the given day, inclusive, oldest first.
+	Get(name string, from time.Time) ([]IndexValue, error)
+	// Delete deletes the values of an index.
+	Delete(name string) error
+}
+
+type StockRatiosRepository interface {
+	// Upsert stores the ratios, replacing the stored ones of the same code.
+	Upsert([]StockRatios) error
+	// Get returns the ratios of every code, ordered by code.
+	Get() ([]StockRatios, error)
+}
+
+type ScreenRepository interface {
+	// Get returns the screen of the given name, or nil if there is none.
+	Get(name string) (*Screen, error)
+	// List returns all screens, ordered by name.
+	List() ([]Screen, error)
+	// Save stores the screen, replacing the stored one of the same name.
+	Save(Screen) error
+	// Delete deletes the screen of the given name.
+	Delete(name string) error
+}
+
 type StockLastUpdateRepository interface {
 	Get() ([]StockLastUpdate, error)
 	Refresh() error
@@ -24,6 +182,63 @@ func (repo PGStockRepository) Insert(stocks []Stock) (int, error) {
 	return ormResult.RowsAffected(), nil
 }
 
+func (repo PGStockRepository) History(code string, from, to time.Time) (stocks []Stock, err error) {
+	err = repo.db.Model(&stocks).
+		Where("code = ?", code).
+		Where("last_update BETWEEN ? AND ?", from, to).
+		Order("last_update").
+		Select()
+	return stocks, err
+}
+
+func (repo PGStockRepository) Latest() (stocks []Stock, err error) {
+	err = repo.db.Model(&stocks).
+		DistinctOn("code").
+		Order("code", "last_update DESC").
+		Select()
+	return stocks, err
+}
+
+func (repo PGStockRepository) AsOf(t time.Time) (stocks []Stock, err error) {
+	err = repo.db.Model(&stocks).
+		DistinctOn("code").
+		Where("last_update <= ?", t).
+		Order("code", "last_update DESC").
+		Select()
+	return stocks, err
+}
+
+func (repo PGStockRepository) Downsample(before time.Time, resolution string, verify func([]StockLastUpdate) error) (deleted int, err error) {
+	err = repo.db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		res, err := tx.Exec(`DELETE FROM stocks s USING (
+			SELECT ctid, row_number() OVER (
+				PARTITION BY code, date_trunc(?, last_update) ORDER BY last_update DESC
+			) AS rn
+			FROM stocks WHERE last_update < ?
+		) d WHERE s.ctid = d.ctid AND d.rn > 1`, resolution, before)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Model((*StockLastUpdate)(nil)).Exec("REFRESH MATERIALIZED VIEW ?TableName"); err != nil {
+			return err
+		}
+
+		var updates []StockLastUpdate
+		if err = tx.Model(&updates).Select(); err != nil {
+			return err
+		}
+
+		deleted = res.RowsAffected()
+		return verify(updates)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
 type PGStockLastUpdateRepository struct {
 	db *pg.DB
 }
@@ -37,3 +252,523 @@ func (repo PGStockLastUpdateRepository) Refresh() error {
 	_, err := repo.db.Model((*StockLastUpdate)(nil)).Exec("REFRESH MATERIALIZED VIEW ?TableName")
 	return err
 }
+
+type PGDailyBarRepository struct {
+	db *pg.DB
+}
+
+func (repo PGDailyBarRepository) Upsert(bars []Bar) error {
+	if len(bars) == 0 {
+		return nil
+	}
+
+	_, err := repo.db.Model(&bars).
+		OnConflict("(code, date) DO UPDATE").
+		Set("open = CASE WHEN COALESCE(?TableAlias.open, 0) = 0 THEN EXCLUDED.open ELSE ?TableAlias.open END").
+		Set("high = GREATEST(?TableAlias.high, EXCLUDED.high)").
+		Set("low = LEAST(?TableAlias.low, EXCLUDED.low)").
+		Set("close = EXCLUDED.close").
+		Set("volume = EXCLUDED.volume").
+		Set("value = EXCLUDED.value").
+		Set("frequency = EXCLUDED.frequency").
+		Insert()
+	return err
+}
+
+func (repo PGDailyBarRepository) Daily(code string, from, to time.Time) (bars []Bar, err error) {
+	err = repo.db.Model(&bars).
+		Where("code = ?", code).
+		Where("date BETWEEN ? AND ?", from, to).
+		Order("date").
+		Select()
+	return bars, err
+}
+
+func (repo PGDailyBarRepository) Since(from time.Time) (bars []Bar, err error) {
+	err = repo.db.Model(&bars).
+		Where("date >= ?", from).
+		Order("code", "date").
+		Select()
+	return bars, err
+}
+
+// pgAdjustedDailyBarsAsOf is the adjusted_daily_bars view only adjusted for the actions going ex
+// up to the day of its ?0 parameter.
+const pgAdjustedDailyBarsAsOf = `(SELECT b.code,
+		b.date,
+		b.open * f.after AS open,
+		b.high * f.after AS high,
+		b.low * f.after AS low,
+		b.close * f.after AS close,
+		b.volume / f.shares AS volume,
+		b.value,
+		b.frequency
+	FROM daily_bars b,
+		LATERAL (SELECT COALESCE(exp(sum(ln(a.factor))), 1) AS after,
+				COALESCE(exp(sum(ln(a.factor)) FILTER (WHERE a.type IN ('split', 'reverse_split', 'bonus'))), 1) AS shares
+			FROM corporate_actions a
+			WHERE a.code = b.code AND a.ex_date > b.date AND a.ex_date <= ?0) f) AS adjusted`
+
+func (repo PGDailyBarRepository) AdjustedDaily(code string, from, to time.Time) (bars []Bar, err error) {
+	_, err = repo.db.Query(&bars, `SELECT * FROM `+pgAdjustedDailyBarsAsOf+`
+		WHERE code = ?1 AND date BETWEEN ?2 AND ?0
+		ORDER BY date`, to, code, from)
+	return bars, err
+}
+
+func (repo PGDailyBarRepository) AdjustedBetween(from, to time.Time) (bars []Bar, err error) {
+	_, err = repo.db.Query(&bars, `SELECT * FROM `+pgAdjustedDailyBarsAsOf+`
+		WHERE date BETWEEN ?1 AND ?0
+		ORDER BY code, date`, to, from)
+	return bars, err
+}
+
+func (repo PGDailyBarRepository) Extremes(since, before time.Time) (extremes []PriceExtremes, err error) {
+	_, err = repo.db.Query(&extremes, `SELECT code,
+			max(high) FILTER (WHERE date >= ?1) AS year_high,
+			min(low) FILTER (WHERE date >= ?1 AND low > 0) AS year_low,
+			max(high) AS all_time_high
+		FROM `+pgAdjustedDailyBarsAsOf+`
+		WHERE date < ?0
+		GROUP BY code
+		ORDER BY code`, before, since)
+	return extremes, err
+}
+
+type PGCorporateActionRepository struct {
+	db *pg.DB
+}
+
+func (repo PGCorporateActionRepository) Upsert(actions []CorporateAction) error {
+	if len(actions) == 0 {
+		return nil
+	}
+
+	_, err := repo.db.Model(&actions).
+		OnConflict("(code, type, ex_date) DO UPDATE").
+		Set("old = EXCLUDED.old").
+		Set("new = EXCLUDED.new").
+		Set("price = EXCLUDED.price").
+		Set("amount = EXCLUDED.amount").
+		Set("factor = EXCLUDED.factor").
+		Insert()
+	return err
+}
+
+func (repo PGCorporateActionRepository) Get(code string) (actions []CorporateAction, err error) {
+	err = repo.db.Model(&actions).Where("code = ?", code).Order("ex_date").Select()
+	return actions, err
+}
+
+func (repo PGCorporateActionRepository) Since(from time.Time) (actions []CorporateAction, err error) {
+	err = repo.db.Model(&actions).Where("ex_date >= ?", from).Order("code", "ex_date").Select()
+	return actions, err
+}
+
+type PGSectorPerformanceRepository struct {
+	db *pg.DB
+}
+
+func (repo PGSectorPerformanceRepository) Upsert(perfs []SectorPerformance) error {
+	if len(perfs) == 0 {
+		return nil
+	}
+
+	_, err := repo.db.Model(&perfs).
+		OnConflict("(date, level, id) DO UPDATE").
+		Set("name = EXCLUDED.name").
+		Set("count = EXCLUDED.count").
+		Set("advancers = EXCLUDED.advancers").
+		Set("decliners = EXCLUDED.decliners").
+		Set("unchanged = EXCLUDED.unchanged").
+		Set("avg_change = EXCLUDED.avg_change").
+		Set("weighted_change = EXCLUDED.weighted_change").
+		Set("value = EXCLUDED.value").
+		Insert()
+	return err
+}
+
+func (repo PGSectorPerformanceRepository) Get(from, to time.Time) (perfs []SectorPerformance, err error) {
+	err = repo.db.Model(&perfs).
+		Where("date BETWEEN ? AND ?", from, to).
+		Order("date", "level", "id").
+		Select()
+	return perfs, err
+}
+
+type PGMarketBreadthRepository struct {
+	db *pg.DB
+}
+
+func (repo PGMarketBreadthRepository) Upsert(b MarketBreadth) error {
+	_, err := repo.db.Model(&b).
+		OnConflict("(date) DO UPDATE").
+		Set("advancers = EXCLUDED.advancers").
+		Set("decliners = EXCLUDED.decliners").
+		Set("unchanged = EXCLUDED.unchanged").
+		Set("ad_ratio = EXCLUDED.ad_ratio").
+		Set("ad_line = EXCLUDED.ad_line").
+		Set("new_highs = EXCLUDED.new_highs").
+		Set("new_lows = EXCLUDED.new_lows").
+		Set("above_ma20 = EXCLUDED.above_ma20").
+		Set("above_ma50 = EXCLUDED.above_ma50").
+		Set("above_ma200 = EXCLUDED.above_ma200").
+		Insert()
+	return err
+}
+
+func (repo PGMarketBreadthRepository) Get(from, to time.Time) (breadths []MarketBreadth, err error) {
+	err = repo.db.Model(&breadths).
+		Where("date BETWEEN ? AND ?", from, to).
+		Order("date").
+		Select()
+	return breadths, err
+}
+
+func (repo PGMarketBreadthRepository) Before(day time.Time) (*MarketBreadth, error) {
+	var b MarketBreadth
+	err := repo.db.Model(&b).
+		Where("date < ?", day).
+		Order("date DESC").
+		Limit(1).
+		Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+type PGIndicatorRepository struct {
+	db *pg.DB
+}
+
+func (repo PGIndicatorRepository) Upsert(values []Indicator) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	_, err := repo.db.Model(&values).
+		OnConflict("(code, date) DO UPDATE").
+		Set("bars = EXCLUDED.bars").
+		Set("sma20 = EXCLUDED.sma20").
+		Set("sma50 = EXCLUDED.sma50").
+		Set("sma200 = EXCLUDED.sma200").
+		Set("ema12 = EXCLUDED.ema12").
+		Set("ema26 = EXCLUDED.ema26").
+		Set("macd = EXCLUDED.macd").
+		Set("macd_signal = EXCLUDED.macd_signal").
+		Set("macd_hist = EXCLUDED.macd_hist").
+		Set("rsi14 = EXCLUDED.rsi14").
+		Set("bollinger_upper = EXCLUDED.bollinger_upper").
+		Set("bollinger_lower = EXCLUDED.bollinger_lower").
+		Set("atr14 = EXCLUDED.atr14").
+		Set("avg_gain = EXCLUDED.avg_gain").
+		Set("avg_loss = EXCLUDED.avg_loss").
+		Insert()
+	return err
+}
+
+func (repo PGIndicatorRepository) Before(day time.Time) (values []Indicator, err error) {
+	err = repo.db.Model(&values).
+		DistinctOn("code").
+		Where("date < ?", day).
+		Order("code", "date DESC").
+		Select()
+	return values, err
+}
+
+type PGEventRepository struct {
+	db *pg.DB
+}
+
+func (repo PGEventRepository) Upsert(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	_, err := repo.db.Model(&events).
+		OnConflict("(code, date, type) DO UPDATE").
+		Set("value = EXCLUDED.value").
+		Set("reference = EXCLUDED.reference").
+		Insert()
+	return err
+}
+
+func (repo PGEventRepository) Get(code string, from, to time.Time) (events []Event, err error) {
+	q := repo.db.Model(&events).
+		Where("date BETWEEN ? AND ?", from, to).
+		Order("date", "code", "type")
+	if code != "" {
+		q = q.Where("code = ?", code)
+	}
+	err = q.Select()
+	return events, err
+}
+
+type PGAlertRepository struct {
+	db *pg.DB
+}
+
+func (repo PGAlertRepository) Add(rule *AlertRule) error {
+	_, err := repo.db.Model(rule).Returning("id").Insert()
+	return err
+}
+
+func (repo PGAlertRepository) Delete(id int64) error {
+	res, err := repo.db.Model((*AlertRule)(nil)).Where("id = ?", id).Delete()
+	if err == nil && res.RowsAffected() == 0 {
+		err = fmt.Errorf("alert %d not found", id)
+	}
+	return err
+}
+
+func (repo PGAlertRepository) List() (rules []AlertRule, err error) {
+	err = repo.db.Model(&rules).Order("id").Select()
+	return rules, err
+}
+
+func (repo PGAlertRepository) SetTriggered(rules []AlertRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	_, err := repo.db.Model(&rules).Column("triggered").WherePK().Update()
+	return err
+}
+
+type PGWatchlistRepository struct {
+	db *pg.DB
+}
+
+func (repo PGWatchlistRepository) Get(name string) (*Watchlist, error) {
+	wl := Watchlist{Name: name}
+	err := repo.db.Model(&wl).WherePK().Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wl, nil
+}
+
+func (repo PGWatchlistRepository) List() (watchlists []Watchlist, err error) {
+	err = repo.db.Model(&watchlists).Order("name").Select()
+	return watchlists, err
+}
+
+func (repo PGWatchlistRepository) Save(wl Watchlist) error {
+	_, err := repo.db.Model(&wl).
+		OnConflict("(name) DO UPDATE").
+		Set("codes = EXCLUDED.codes").
+		Set("chat_id = EXCLUDED.chat_id").
+		Insert()
+	return err
+}
+
+func (repo PGWatchlistRepository) Delete(name string) error {
+	_, err := repo.db.Model(&Watchlist{Name: name}).WherePK().Delete()
+	return err
+}
+
+type PGTradeRepository struct {
+	db *pg.DB
+}
+
+func (repo PGTradeRepository) Add(trade *Trade) error {
+	_, err := repo.db.Model(trade).Returning("id").Insert()
+	return err
+}
+
+func (repo PGTradeRepository) Delete(id int64) error {
+	res, err := repo.db.Model((*Trade)(nil)).Where("id = ?", id).Delete()
+	if err == nil && res.RowsAffected() == 0 {
+		err = fmt.Errorf("trade %d not found", id)
+	}
+	return err
+}
+
+func (repo PGTradeRepository) List() (trades []Trade, err error) {
+	err = repo.db.Model(&trades).Order("date", "id").Select()
+	return trades, err
+}
+
+type PGPortfolioSnapshotRepository struct {
+	db *pg.DB
+}
+
+func (repo PGPortfolioSnapshotRepository) Upsert(snap PortfolioSnapshot) error {
+	_, err := repo.db.Model(&snap).
+		OnConflict("(date) DO UPDATE").
+		Set("market_value = EXCLUDED.market_value").
+		Set("cost = EXCLUDED.cost").
+		Set("unrealized = EXCLUDED.unrealized").
+		Set("realized = EXCLUDED.realized").
+		Set("daily_pnl = EXCLUDED.daily_pnl").
+		Insert()
+	return err
+}
+
+func (repo PGPortfolioSnapshotRepository) Before(day time.Time) (*PortfolioSnapshot, error) {
+	var snap PortfolioSnapshot
+	err := repo.db.Model(&snap).
+		Where("date < ?", day).
+		Order("date DESC").
+		Limit(1).
+		Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+type PGCustomIndexRepository struct {
+	db *pg.DB
+}
+
+func (repo PGCustomIndexRepository) Get(name string) (*CustomIndex, error) {
+	ix := CustomIndex{Name: name}
+	err := repo.db.Model(&ix).WherePK().Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ix, nil
+}
+
+func (repo PGCustomIndexRepository) List() (indices []CustomIndex, err error) {
+	err = repo.db.Model(&indices).Order("name").Select()
+	return indices, err
+}
+
+func (repo PGCustomIndexRepository) Save(ix CustomIndex) error {
+	_, err := repo.db.Model(&ix).
+		OnConflict("(name) DO UPDATE").
+		Set("weighting = EXCLUDED.weighting").
+		Set("codes = EXCLUDED.codes").
+		Set("sector_id = EXCLUDED.sector_id").
+		Set("base_date = EXCLUDED.base_date").
+		Set("base_value = EXCLUDED.base_value").
+		Insert()
+	return err
+}
+
+func (repo PGCustomIndexRepository) Delete(name string) error {
+	_, err := repo.db.Model(&CustomIndex{Name: name}).WherePK().Delete()
+	return err
+}
+
+type PGIndexValueRepository struct {
+	db *pg.DB
+}
+
+func (repo PGIndexValueRepository) Upsert(values []IndexValue) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	_, err := repo.db.Model(&values).
+		OnConflict("(name, date) DO UPDATE").
+		Set("value = EXCLUDED.value").
+		Set("change = EXCLUDED.change").
+		Set("divisor = EXCLUDED.divisor").
+		Set("members = EXCLUDED.members").
+		Insert()
+	return err
+}
+
+func (repo PGIndexValueRepository) Before(day time.Time) (values []IndexValue, err error) {
+	err = repo.db.Model(&values).
+		DistinctOn("name").
+		Where("date < ?", day).
+		Order("name", "date DESC").
+		Select()
+	return values, err
+}
+
+func (repo PGIndexValueRepository) Get(name string, from time.Time) (values []IndexValue, err error) {
+	err = repo.db.Model(&values).
+		Where("name = ?", name).
+		Where("date >= ?", from).
+		Order("date").
+		Select()
+	return values, err
+}
+
+func (repo PGIndexValueRepository) Delete(name string) error {
+	_, err := repo.db.Model((*IndexValue)(nil)).Where("name = ?", name).Delete()
+	return err
+}
+
+type PGStockRatiosRepository struct {
+	db *pg.DB
+}
+
+func (repo PGStockRatiosRepository) Upsert(ratios []StockRatios) error {
+	if len(ratios) == 0 {
+		return nil
+	}
+
+	_, err := repo.db.Model(&ratios).
+		OnConflict("(code) DO UPDATE").
+		Set("one_week = EXCLUDED.one_week").
+		Set("one_month = EXCLUDED.one_month").
+		Set("three_month = EXCLUDED.three_month").
+		Set("six_month = EXCLUDED.six_month").
+		Set("one_year = EXCLUDED.one_year").
+		Set("mtd = EXCLUDED.mtd").
+		Set("ytd = EXCLUDED.ytd").
+		Set("per = EXCLUDED.per").
+		Set("pbr = EXCLUDED.pbr").
+		Set("roe = EXCLUDED.roe").
+		Set("capitalization = EXCLUDED.capitalization").
+		Insert()
+	return err
+}
+
+func (repo PGStockRatiosRepository) Get() (ratios []StockRatios, err error) {
+	err = repo.db.Model(&ratios).Order("code").Select()
+	return ratios, err
+}
+
+type PGScreenRepository struct {
+	db *pg.DB
+}
+
+func (repo PGScreenRepository) Get(name string) (*Screen, error) {
+	sc := Screen{Name: name}
+	err := repo.db.Model(&sc).WherePK().Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+func (repo PGScreenRepository) List() (screens []Screen, err error) {
+	err = repo.db.Model(&screens).Order("name").Select()
+	return screens, err
+}
+
+func (repo PGScreenRepository) Save(sc Screen) error {
+	_, err := repo.db.Model(&sc).
+		OnConflict("(name) DO UPDATE").
+		Set("expression = EXCLUDED.expression").
+		Insert()
+	return err
+}
+
+func (repo PGScreenRepository) Delete(name string) error {
+	_, err := repo.db.Model(&Screen{Name: name}).WherePK().Delete()
+	return err
+}
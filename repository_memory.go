@@ -0,0 +1,760 @@
+package ingest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MemStockRepository keeps inserted stocks in memory, for tests and dry runs.
+type MemStockRepository struct {
+	stocks []Stock
+}
+
+// Insert stores copies of stocks with LastUpdate formatted as the database would return it.
+func (repo *MemStockRepository) Insert(stocks []Stock) (int, error) {
+	rows := make([]Stock, len(stocks))
+	for i, s := range stocks {
+		t, err := parseLastUpdate(s.LastUpdate)
+		if err != nil {
+			return 0, err
+		}
+		s.LastUpdate = t.Format(dbTimeLayout)
+		rows[i] = s
+	}
+
+	repo.stocks = append(repo.stocks, rows...)
+	return len(rows), nil
+}
+
+func (repo *MemStockRepository) History(code string, from, to time.Time) ([]Stock, error) {
+	var res []Stock
+	for _, s := range repo.stocks {
+		if s.Code != code {
+			continue
+		}
+		t, _ := parseLastUpdate(s.LastUpdate)
+		if !t.Before(from) && !t.After(to) {
+			res = append(res, s)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		ti, _ := parseLastUpdate(res[i].LastUpdate)
+		tj, _ := parseLastUpdate(res[j].LastUpdate)
+		return ti.Before(tj)
+	})
+	return res, nil
+}
+
+func (repo *MemStockRepository) Latest() ([]Stock, error) {
+	return repo.latest(func(time.Time) bool { return true }), nil
+}
+
+func (repo *MemStockRepository) AsOf(t time.Time) ([]Stock, error) {
+	return repo.latest(func(u time.Time) bool { return !u.After(t) }), nil
+}
+
+func (repo *MemStockRepository) latest(include func(time.Time) bool) []Stock {
+	latest := make(map[string]Stock)
+	latestAt := make(map[string]time.Time)
+	for _, s := range repo.stocks {
+		t, _ := parseLastUpdate(s.LastUpdate)
+		if !include(t) {
+			continue
+		}
+		if at, exist := latestAt[s.Code]; !exist || t.After(at) {
+			latest[s.Code] = s
+			latestAt[s.Code] = t
+		}
+	}
+
+	res := make([]Stock, 0, len(latest))
+	for _, s := range latest {
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Code < res[j].Code })
+	return res
+}
+
+// Downsample restores the deleted snapshots if verify returns an error, as if rolled back.
+func (repo *MemStockRepository) Downsample(before time.Time, resolution string, verify func([]StockLastUpdate) error) (int, error) {
+	truncate := tradingDay
+	if resolution == resolutionHour {
+		truncate = func(t time.Time) time.Time { return t.Truncate(time.Hour) }
+	}
+
+	latest := make(map[string]int)
+	for i, s := range repo.stocks {
+		t, _ := parseLastUpdate(s.LastUpdate)
+		if !t.Before(before) {
+			continue
+		}
+		key := s.Code + truncate(t).String()
+		if j, exist := latest[key]; !exist || s.LastUpdate >= repo.stocks[j].LastUpdate {
+			latest[key] = i
+		}
+	}
+
+	keep := make(map[int]bool, len(latest))
+	for _, i := range latest {
+		keep[i] = true
+	}
+
+	var stocks []Stock
+	deleted := 0
+	for i, s := range repo.stocks {
+		t, _ := parseLastUpdate(s.LastUpdate)
+		if t.Before(before) && !keep[i] {
+			deleted++
+			continue
+		}
+		stocks = append(stocks, s)
+	}
+
+	all := repo.stocks
+	repo.stocks = stocks
+	if err := verify(lastUpdatesOf(repo)); err != nil {
+		repo.stocks = all
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// MemStockLastUpdateRepository derives the last updates from a MemStockRepository on refresh.
+type MemStockLastUpdateRepository struct {
+	stocks  *MemStockRepository
+	updates []StockLastUpdate
+}
+
+func (repo *MemStockLastUpdateRepository) Get() ([]StockLastUpdate, error) {
+	return repo.updates, nil
+}
+
+func (repo *MemStockLastUpdateRepository) Refresh() error {
+	repo.updates = lastUpdatesOf(repo.stocks)
+	return nil
+}
+
+func lastUpdatesOf(stocks *MemStockRepository) []StockLastUpdate {
+	latest, _ := stocks.Latest()
+
+	updates := make([]StockLastUpdate, len(latest))
+	for i, s := range latest {
+		updates[i] = StockLastUpdate{s.Code, s.LastUpdate}
+	}
+	return updates
+}
+
+// MemDailyBarRepository keeps daily bars in memory, for tests and dry runs.
+// Bars are adjusted for the corporate actions of actions, if any.
+type MemDailyBarRepository struct {
+	bars    []Bar
+	actions *MemCorporateActionRepository
+}
+
+func (repo *MemDailyBarRepository) Upsert(bars []Bar) error {
+	for _, bar := range bars {
+		merged := false
+		for i := range repo.bars {
+			if repo.bars[i].Code == bar.Code && repo.bars[i].Date.Equal(bar.Date) {
+				repo.bars[i].update(bar)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			repo.bars = append(repo.bars, bar)
+		}
+	}
+	return nil
+}
+
+func (repo *MemDailyBarRepository) Daily(code string, from, to time.Time) ([]Bar, error) {
+	var res []Bar
+	for _, bar := range repo.bars {
+		if bar.Code == code && !bar.Date.Before(from) && !bar.Date.After(to) {
+			res = append(res, bar)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Date.Before(res[j].Date) })
+	return res, nil
+}
+
+func (repo *MemDailyBarRepository) Since(from time.Time) ([]Bar, error) {
+	var res []Bar
+	for _, bar := range repo.bars {
+		if !bar.Date.Before(from) {
+			res = append(res, bar)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Code != res[j].Code {
+			return res[i].Code < res[j].Code
+		}
+		return res[i].Date.Before(res[j].Date)
+	})
+	return res, nil
+}
+
+func (repo *MemDailyBarRepository) AdjustedDaily(code string, from, to time.Time) ([]Bar, error) {
+	bars, _ := repo.Daily(code, from, to)
+	return repo.adjust(bars, to), nil
+}
+
+func (repo *MemDailyBarRepository) AdjustedBetween(from, to time.Time) ([]Bar, error) {
+	var bars []Bar
+	since, _ := repo.Since(from)
+	for _, bar := range since {
+		if !bar.Date.After(to) {
+			bars = append(bars, bar)
+		}
+	}
+	return repo.adjust(bars, to), nil
+}
+
+func (repo *MemDailyBarRepository) adjust(bars []Bar, asOf time.Time) []Bar {
+	if repo.actions == nil {
+		return bars
+	}
+	return adjustBars(bars, repo.actions.actions, asOf)
+}
+
+func (repo *MemDailyBarRepository) Extremes(since, before time.Time) ([]PriceExtremes, error) {
+	var res []PriceExtremes
+	bars, _ := repo.AdjustedBetween(time.Time{}, before)
+	for _, bar := range bars {
+		if !bar.Date.Before(before) {
+			continue
+		}
+
+		if len(res) == 0 || res[len(res)-1].Code != bar.Code {
+			res = append(res, PriceExtremes{Code: bar.Code})
+		}
+		e := &res[len(res)-1]
+		if bar.High > e.AllTimeHigh {
+			e.AllTimeHigh = bar.High
+		}
+		if bar.Date.Before(since) {
+			continue
+		}
+		if bar.High > e.YearHigh {
+			e.YearHigh = bar.High
+		}
+		if bar.Low > 0 && (e.YearLow == 0 || bar.Low < e.YearLow) {
+			e.YearLow = bar.Low
+		}
+	}
+
+	return res, nil
+}
+
+// MemCorporateActionRepository keeps corporate actions in memory, for tests and dry runs.
+type MemCorporateActionRepository struct {
+	actions []CorporateAction
+}
+
+func (repo *MemCorporateActionRepository) Upsert(actions []CorporateAction) error {
+	for _, action := range actions {
+		replaced := false
+		for i, a := range repo.actions {
+			if a.Code == action.Code && a.Type == action.Type && a.ExDate.Equal(action.ExDate) {
+				repo.actions[i] = action
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			repo.actions = append(repo.actions, action)
+		}
+	}
+	return nil
+}
+
+func (repo *MemCorporateActionRepository) Get(code string) ([]CorporateAction, error) {
+	var res []CorporateAction
+	for _, a := range repo.actions {
+		if a.Code == code {
+			res = append(res, a)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].ExDate.Before(res[j].ExDate) })
+	return res, nil
+}
+
+func (repo *MemCorporateActionRepository) Since(from time.Time) ([]CorporateAction, error) {
+	var res []CorporateAction
+	for _, a := range repo.actions {
+		if !a.ExDate.Before(from) {
+			res = append(res, a)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Code != res[j].Code {
+			return res[i].Code < res[j].Code
+		}
+		return res[i].ExDate.Before(res[j].ExDate)
+	})
+	return res, nil
+}
+
+// MemSectorPerformanceRepository keeps sector performances in memory, for tests and dry runs.
+type MemSectorPerformanceRepository struct {
+	perfs []SectorPerformance
+}
+
+func (repo *MemSectorPerformanceRepository) Upsert(perfs []SectorPerformance) error {
+	for _, perf := range perfs {
+		replaced := false
+		for i, p := range repo.perfs {
+			if p.Date.Equal(perf.Date) && p.Level == perf.Level && p.Id == perf.Id {
+				repo.perfs[i] = perf
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			repo.perfs = append(repo.perfs, perf)
+		}
+	}
+	return nil
+}
+
+func (repo *MemSectorPerformanceRepository) Get(from, to time.Time) ([]SectorPerformance, error) {
+	var res []SectorPerformance
+	for _, p := range repo.perfs {
+		if !p.Date.Before(from) && !p.Date.After(to) {
+			res = append(res, p)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if !res[i].Date.Equal(res[j].Date) {
+			return res[i].Date.Before(res[j].Date)
+		}
+		if res[i].Level != res[j].Level {
+			return res[i].Level < res[j].Level
+		}
+		return res[i].Id < res[j].Id
+	})
+	return res, nil
+}
+
+// MemMarketBreadthRepository keeps market breadths in memory, for tests and dry runs.
+type MemMarketBreadthRepository struct {
+	breadths []MarketBreadth
+}
+
+func (repo *MemMarketBreadthRepository) Upsert(b MarketBreadth) error {
+	for i, stored := range repo.breadths {
+		if stored.Date.Equal(b.Date) {
+			repo.breadths[i] = b
+			return nil
+		}
+	}
+	repo.breadths = append(repo.breadths, b)
+	sort.SliceStable(repo.breadths, func(i, j int) bool { return repo.breadths[i].Date.Before(repo.breadths[j].Date) })
+	return nil
+}
+
+func (repo *MemMarketBreadthRepository) Get(from, to time.Time) ([]MarketBreadth, error) {
+	var res []MarketBreadth
+	for _, b := range repo.breadths {
+		if !b.Date.Before(from) && !b.Date.After(to) {
+			res = append(res, b)
+		}
+	}
+	return res, nil
+}
+
+func (repo *MemMarketBreadthRepository) Before(day time.Time) (*MarketBreadth, error) {
+	for i := len(repo.breadths) - 1; i >= 0; i-- {
+		if repo.breadths[i].Date.Before(day) {
+			b := repo.breadths[i]
+			return &b, nil
+		}
+	}
+	return nil, nil
+}
+
+// MemIndicatorRepository keeps indicators in memory, for tests and dry runs.
+type MemIndicatorRepository struct {
+	values []Indicator
+}
+
+func (repo *MemIndicatorRepository) Upsert(values []Indicator) error {
+	for _, v := range values {
+		replaced := false
+		for i, stored := range repo.values {
+			if stored.Code == v.Code && stored.Date.Equal(v.Date) {
+				repo.values[i] = v
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			repo.values = append(repo.values, v)
+		}
+	}
+	return nil
+}
+
+func (repo *MemIndicatorRepository) Before(day time.Time) ([]Indicator, error) {
+	latest := make(map[string]Indicator)
+	for _, v := range repo.values {
+		if l, exist := latest[v.Code]; v.Date.Before(day) && (!exist || v.Date.After(l.Date)) {
+			latest[v.Code] = v
+		}
+	}
+
+	res := make([]Indicator, 0, len(latest))
+	for _, v := range latest {
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Code < res[j].Code })
+	return res, nil
+}
+
+// MemEventRepository keeps events in memory, for tests and dry runs.
+type MemEventRepository struct {
+	events []Event
+}
+
+func (repo *MemEventRepository) Upsert(events []Event) error {
+	for _, e := range events {
+		replaced := false
+		for i, stored := range repo.events {
+			if stored.Code == e.Code && stored.Date.Equal(e.Date) && stored.Type == e.Type {
+				repo.events[i] = e
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			repo.events = append(repo.events, e)
+		}
+	}
+	return nil
+}
+
+func (repo *MemEventRepository) Get(code string, from, to time.Time) ([]Event, error) {
+	var res []Event
+	for _, e := range repo.events {
+		if (code == "" || e.Code == code) && !e.Date.Before(from) && !e.Date.After(to) {
+			res = append(res, e)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if !res[i].Date.Equal(res[j].Date) {
+			return res[i].Date.Before(res[j].Date)
+		}
+		if res[i].Code != res[j].Code {
+			return res[i].Code < res[j].Code
+		}
+		return res[i].Type < res[j].Type
+	})
+	return res, nil
+}
+
+// MemAlertRepository keeps alert rules in memory, for tests and dry runs.
+type MemAlertRepository struct {
+	rules  []AlertRule
+	lastId int64
+}
+
+func (repo *MemAlertRepository) Add(rule *AlertRule) error {
+	repo.lastId++
+	rule.Id = repo.lastId
+	repo.rules = append(repo.rules, *rule)
+	return nil
+}
+
+func (repo *MemAlertRepository) Delete(id int64) error {
+	for i, r := range repo.rules {
+		if r.Id == id {
+			repo.rules = append(repo.rules[:i], repo.rules[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("alert %d not found", id)
+}
+
+func (repo *MemAlertRepository) List() ([]AlertRule, error) {
+	return append([]AlertRule(nil), repo.rules...), nil
+}
+
+func (repo *MemAlertRepository) SetTriggered(rules []AlertRule) error {
+	for _, changed := range rules {
+		for i := range repo.rules {
+			if repo.rules[i].Id == changed.Id {
+				repo.rules[i].Triggered = changed.Triggered
+			}
+		}
+	}
+	return nil
+}
+
+// MemWatchlistRepository keeps watchlists in memory, for tests and dry runs.
+type MemWatchlistRepository struct {
+	watchlists map[string]Watchlist
+}
+
+func (repo *MemWatchlistRepository) Get(name string) (*Watchlist, error) {
+	wl, exist := repo.watchlists[name]
+	if !exist {
+		return nil, nil
+	}
+	wl.Codes = append([]string(nil), wl.Codes...)
+	return &wl, nil
+}
+
+func (repo *MemWatchlistRepository) List() ([]Watchlist, error) {
+	res := make([]Watchlist, 0, len(repo.watchlists))
+	for _, wl := range repo.watchlists {
+		res = append(res, wl)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (repo *MemWatchlistRepository) Save(wl Watchlist) error {
+	if repo.watchlists == nil {
+		repo.watchlists = make(map[string]Watchlist)
+	}
+	wl.Codes = append([]string(nil), wl.Codes...)
+	repo.watchlists[wl.Name] = wl
+	return nil
+}
+
+func (repo *MemWatchlistRepository) Delete(name string) error {
+	delete(repo.watchlists, name)
+	return nil
+}
+
+// MemTradeRepository keeps trades in memory, for tests and dry runs.
+type MemTradeRepository struct {
+	trades []Trade
+	lastId int64
+}
+
+func (repo *MemTradeRepository) Add(trade *Trade) error {
+	repo.lastId++
+	trade.Id = repo.lastId
+	repo.trades = append(repo.trades, *trade)
+	return nil
+}
+
+func (repo *MemTradeRepository) Delete(id int64) error {
+	for i, t := range repo.trades {
+		if t.Id == id {
+			repo.trades = append(repo.trades[:i], repo.trades[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("trade %d not found", id)
+}
+
+func (repo *MemTradeRepository) List() ([]Trade, error) {
+	res := append([]Trade(nil), repo.trades...)
+	sort.SliceStable(res, func(i, j int) bool {
+		if !res[i].Date.Equal(res[j].Date) {
+			return res[i].Date.Before(res[j].Date)
+		}
+		return res[i].Id < res[j].Id
+	})
+	return res, nil
+}
+
+// MemPortfolioSnapshotRepository keeps portfolio snapshots in memory, for tests and dry runs.
+type MemPortfolioSnapshotRepository struct {
+	snapshots []PortfolioSnapshot
+}
+
+func (repo *MemPortfolioSnapshotRepository) Upsert(snap PortfolioSnapshot) error {
+	for i, stored := range repo.snapshots {
+		if stored.Date.Equal(snap.Date) {
+			repo.snapshots[i] = snap
+			return nil
+		}
+	}
+	repo.snapshots = append(repo.snapshots, snap)
+	sort.SliceStable(repo.snapshots, func(i, j int) bool { return repo.snapshots[i].Date.Before(repo.snapshots[j].Date) })
+	return nil
+}
+
+func (repo *MemPortfolioSnapshotRepository) Before(day time.Time) (*PortfolioSnapshot, error) {
+	for i := len(repo.snapshots) - 1; i >= 0; i-- {
+		if repo.snapshots[i].Date.Before(day) {
+			snap := repo.snapshots[i]
+			return &snap, nil
+		}
+	}
+	return nil, nil
+}
+
+// MemCustomIndexRepository keeps custom indices in memory, for tests and dry runs.
+type MemCustomIndexRepository struct {
+	indices map[string]CustomIndex
+}
+
+func (repo *MemCustomIndexRepository) Get(name string) (*CustomIndex, error) {
+	ix, exist := repo.indices[name]
+	if !exist {
+		return nil, nil
+	}
+	ix.Codes = append([]string(nil), ix.Codes...)
+	return &ix, nil
+}
+
+func (repo *MemCustomIndexRepository) List() ([]CustomIndex, error) {
+	res := make([]CustomIndex, 0, len(repo.indices))
+	for _, ix := range repo.indices {
+		res = append(res, ix)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (repo *MemCustomIndexRepository) Save(ix CustomIndex) error {
+	if repo.indices == nil {
+		repo.indices = make(map[string]CustomIndex)
+	}
+	ix.Codes = append([]string(nil), ix.Codes...)
+	repo.indices[ix.Name] = ix
+	return nil
+}
+
+func (repo *MemCustomIndexRepository) Delete(name string) error {
+	delete(repo.indices, name)
+	return nil
+}
+
+// MemIndexValueRepository keeps index values in memory, ordered by name then date, for tests and dry runs.
+type MemIndexValueRepository struct {
+	values []IndexValue
+}
+
+func (repo *MemIndexValueRepository) Upsert(values []IndexValue) error {
+	for _, v := range values {
+		replaced := false
+		for i, stored := range repo.values {
+			if stored.Name == v.Name && stored.Date.Equal(v.Date) {
+				repo.values[i] = v
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			repo.values = append(repo.values, v)
+		}
+	}
+
+	sort.SliceStable(repo.values, func(i, j int) bool {
+		if repo.values[i].Name != repo.values[j].Name {
+			return repo.values[i].Name < repo.values[j].Name
+		}
+		return repo.values[i].Date.Before(repo.values[j].Date)
+	})
+	return nil
+}
+
+func (repo *MemIndexValueRepository) Before(day time.Time) ([]IndexValue, error) {
+	var res []IndexValue
+	for _, v := range repo.values {
+		if !v.Date.Before(day) {
+			continue
+		}
+		if n := len(res); n > 0 && res[n-1].Name == v.Name {
+			res[n-1] = v
+		} else {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+func (repo *MemIndexValueRepository) Get(name string, from time.Time) ([]IndexValue, error) {
+	var res []IndexValue
+	for _, v := range repo.values {
+		if v.Name == name && !v.Date.Before(from) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+func (repo *MemIndexValueRepository) Delete(name string) error {
+	values := repo.values[:0]
+	for _, v := range repo.values {
+		if v.Name != name {
+			values = append(values, v)
+		}
+	}
+	repo.values = values
+	return nil
+}
+
+// MemStockRatiosRepository keeps the ratios of every code in memory, for tests and dry runs.
+type MemStockRatiosRepository struct {
+	ratios map[string]StockRatios
+}
+
+func (repo *MemStockRatiosRepository) Upsert(ratios []StockRatios) error {
+	if repo.ratios == nil {
+		repo.ratios = make(map[string]StockRatios)
+	}
+	for _, r := range ratios {
+		repo.ratios[r.Code] = r
+	}
+	return nil
+}
+
+func (repo *MemStockRatiosRepository) Get() ([]StockRatios, error) {
+	res := make([]StockRatios, 0, len(repo.ratios))
+	for _, r := range repo.ratios {
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Code < res[j].Code })
+	return res, nil
+}
+
+// MemScreenRepository keeps screens in memory, for tests and dry runs.
+type MemScreenRepository struct {
+	screens map[string]Screen
+}
+
+func (repo *MemScreenRepository) Get(name string) (*Screen, error) {
+	sc, exist := repo.screens[name]
+	if !exist {
+		return nil, nil
+	}
+	return &sc, nil
+}
+
+func (repo *MemScreenRepository) List() ([]Screen, error) {
+	res := make([]Screen, 0, len(repo.screens))
+	for _, sc := range repo.screens {
+		res = append(res, sc)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (repo *MemScreenRepository) Save(sc Screen) error {
+	if repo.screens == nil {
+		repo.screens = make(map[string]Screen)
+	}
+	repo.screens[sc.Name] = sc
+	return nil
+}
+
+func (repo *MemScreenRepository) Delete(name string) error {
+	delete(repo.screens, name)
+	return nil
+}
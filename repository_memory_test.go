@@ -0,0 +1,145 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	a1 = Stock{Code: "A", LastUpdate: "2020-02-01T00:00:00", Last: 100}
+	a2 = Stock{Code: "A", LastUpdate: "2020-02-02T00:00:00", Last: 110}
+	a3 = Stock{Code: "A", LastUpdate: "2020-02-03T00:00:00", Last: 120}
+	b1 = Stock{Code: "B", LastUpdate: "2020-02-01T00:00:00", Last: 50}
+	b2 = Stock{Code: "B", LastUpdate: "2020-02-03T00:00:00", Last: 55}
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func codesAndLasts(stocks []Stock) []Stock {
+	res := make([]Stock, len(stocks))
+	for i, s := range stocks {
+		res[i] = Stock{Code: s.Code, Last: s.Last}
+	}
+	return res
+}
+
+func testStockHistoryRepository(t *testing.T, repo interface {
+	StockRepository
+	StockHistoryRepository
+}) {
+	if _, err := repo.Insert([]Stock{a3, b1, a1, b2, a2}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := repo.History("A", date("2020-02-02"), date("2020-02-03"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Stock{{Code: "A", Last: 110}, {Code: "A", Last: 120}}
+	if actual := codesAndLasts(history); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("History: expect %+v, got %+v", expected, actual)
+	}
+
+	latest, err := repo.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []Stock{{Code: "A", Last: 120}, {Code: "B", Last: 55}}
+	if actual := codesAndLasts(latest); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Latest: expect %+v, got %+v", expected, actual)
+	}
+
+	asOf, err := repo.AsOf(date("2020-02-02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []Stock{{Code: "A", Last: 110}, {Code: "B", Last: 50}}
+	if actual := codesAndLasts(asOf); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("AsOf: expect %+v, got %+v", expected, actual)
+	}
+	if asOf[0].LastUpdate != "2020-02-02 00:00:00" {
+		t.Errorf("AsOf: expect last update 2020-02-02 00:00:00, got %s", asOf[0].LastUpdate)
+	}
+}
+
+func TestMemStockRepositoryShouldQueryHistory(t *testing.T) {
+	testStockHistoryRepository(t, &MemStockRepository{})
+}
+
+func TestMemStockRepositoryInsertShouldReturnNumberOfInsertedStocks(t *testing.T) {
+	testStockRepositoryInsert(t, &MemStockRepository{})
+}
+
+func TestMemStockLastUpdateRepositoryRefreshShouldKeepLatestUpdatePerCode(t *testing.T) {
+	stocks := &MemStockRepository{}
+	testStockLastUpdateRepository(t, stocks, &MemStockLastUpdateRepository{stocks: stocks})
+}
+
+func TestMemDailyBarRepositoryExtremesShouldAggregateAdjustedBarsBeforeTheGivenDay(t *testing.T) {
+	actions := &MemCorporateActionRepository{}
+	testDailyBarRepositoryExtremes(t, &MemDailyBarRepository{actions: actions}, actions)
+}
+
+func TestMemDailyBarRepositoryAdjustedDailyShouldApplyTheFactorsOfLaterActions(t *testing.T) {
+	actions := &MemCorporateActionRepository{}
+	testDailyBarRepositoryAdjusted(t, &MemDailyBarRepository{actions: actions}, actions)
+}
+
+func TestMemCorporateActionRepositoryUpsertShouldReplaceTheSameAction(t *testing.T) {
+	testCorporateActionRepository(t, &MemCorporateActionRepository{})
+}
+
+func TestMemSectorPerformanceRepositoryUpsertShouldReplaceTheSameDayLevelAndId(t *testing.T) {
+	testSectorPerformanceRepository(t, &MemSectorPerformanceRepository{})
+}
+
+func TestMemMarketBreadthRepositoryShouldUpsertAndQueryByDay(t *testing.T) {
+	testMarketBreadthRepository(t, &MemMarketBreadthRepository{})
+}
+
+func TestMemIndicatorRepositoryBeforeShouldReturnLatestIndicatorsPerCode(t *testing.T) {
+	testIndicatorRepository(t, &MemIndicatorRepository{})
+}
+
+func TestMemEventRepositoryGetShouldFilterByCodeAndDate(t *testing.T) {
+	testEventRepository(t, &MemEventRepository{})
+}
+
+func TestMemAlertRepositoryShouldAddListUpdateAndDeleteRules(t *testing.T) {
+	testAlertRepository(t, &MemAlertRepository{})
+}
+
+func TestMemWatchlistRepositoryShouldSaveGetListAndDelete(t *testing.T) {
+	testWatchlistRepository(t, &MemWatchlistRepository{})
+}
+
+func TestMemTradeRepositoryShouldAddListAndDeleteTrades(t *testing.T) {
+	testTradeRepository(t, &MemTradeRepository{})
+}
+
+func TestMemPortfolioSnapshotRepositoryBeforeShouldReturnTheLatestEarlierSnapshot(t *testing.T) {
+	testPortfolioSnapshotRepository(t, &MemPortfolioSnapshotRepository{})
+}
+
+func TestMemCustomIndexRepositoryShouldSaveAndListIndices(t *testing.T) {
+	testCustomIndexRepository(t, &MemCustomIndexRepository{})
+}
+
+func TestMemIndexValueRepositoryBeforeShouldReturnTheLatestValueOfEveryIndex(t *testing.T) {
+	testIndexValueRepository(t, &MemIndexValueRepository{})
+}
+
+func TestMemStockRatiosRepositoryShouldKeepTheLatestRatiosOfEveryCode(t *testing.T) {
+	testStockRatiosRepository(t, &MemStockRatiosRepository{})
+}
+
+func TestMemScreenRepositoryShouldSaveReplaceAndDeleteScreens(t *testing.T) {
+	testScreenRepository(t, &MemScreenRepository{})
+}
@@ -0,0 +1,1200 @@
+package ingest
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+//go:embed instock_sqlite.sql
+var sqliteSchema string
+
+const insertStockSQL = `INSERT INTO stocks (
+	name, code, sub_sector_id, sub_sector_name, sector_id, sector_name,
+	last, prev_closing_price, adjusted_open_price, adjusted_high_price, adjusted_low_price,
+	volume, frequency, value, one_day, last_update
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+const selectStockSQL = `SELECT
+	name, code, sub_sector_id, sub_sector_name, sector_id, sector_name,
+	last, prev_closing_price, adjusted_open_price, adjusted_high_price, adjusted_low_price,
+	volume, frequency, value, one_day, last_update
+FROM stocks`
+
+// sqliteTimeLayout is how the driver stores time.Time values.
+const sqliteTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+// sqliteTime scans a timestamp column, which the driver returns as time.Time when
+// the declared column type is known and as text otherwise, e.g. from an aggregate.
+type sqliteTime struct {
+	time.Time
+}
+
+func (t *sqliteTime) Scan(v interface{}) (err error) {
+	switch v := v.(type) {
+	case time.Time:
+		t.Time = v
+	case string:
+		t.Time, err = time.Parse(sqliteTimeLayout, v)
+	case []byte:
+		t.Time, err = time.Parse(sqliteTimeLayout, string(v))
+	default:
+		err = fmt.Errorf("cannot scan %T into time", v)
+	}
+	return err
+}
+
+// sqliteDriver is the sqlite3 driver with the math functions that the adjusted views use,
+// which the bundled SQLite is not compiled with.
+const sqliteDriver = "sqlite3_instock"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("exp", sqliteMath(math.Exp), true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("ln", sqliteMath(math.Log), true)
+		},
+	})
+}
+
+// sqliteMath adapts a math function to numeric arguments, which SQLite passes as integers if they are whole.
+// NULL is passed through.
+func sqliteMath(f func(float64) float64) func(interface{}) (interface{}, error) {
+	return func(v interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case int64:
+			return f(float64(v)), nil
+		case float64:
+			return f(v), nil
+		case []byte:
+			if v == nil {
+				return nil, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot apply a math function to %T", v)
+	}
+}
+
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+type SQLiteStockRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteStockRepository) Insert(stocks []Stock) (int, error) {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(insertStockSQL)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	inserted := 0
+	for _, s := range stocks {
+		lastUpdate, err := parseLastUpdate(s.LastUpdate)
+		if err != nil {
+			return 0, err
+		}
+
+		res, err := stmt.Exec(s.Name, s.Code, s.SubSectorId, s.SubSectorName, s.SectorId, s.SectorName,
+			s.Last, s.PrevClosingPrice, s.AdjustedOpenPrice, s.AdjustedHighPrice, s.AdjustedLowPrice,
+			s.Volume, s.Frequency, s.Value, s.OneDay, lastUpdate)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		inserted += int(n)
+	}
+
+	return inserted, tx.Commit()
+}
+
+func (repo SQLiteStockRepository) History(code string, from, to time.Time) ([]Stock, error) {
+	return repo.query(selectStockSQL+" WHERE code = ? AND last_update BETWEEN ? AND ? ORDER BY last_update",
+		code, from.UTC(), to.UTC())
+}
+
+func (repo SQLiteStockRepository) Latest() ([]Stock, error) {
+	return repo.query(latestStockSQL(""))
+}
+
+func (repo SQLiteStockRepository) AsOf(t time.Time) ([]Stock, error) {
+	return repo.query(latestStockSQL("WHERE last_update <= ?"), t.UTC())
+}
+
+// latestStockSQL selects the most recent row of every code, optionally filtered.
+func latestStockSQL(where string) string {
+	return selectStockSQL + ` WHERE rowid IN (
+		SELECT rowid FROM (SELECT rowid, max(last_update) FROM stocks ` + where + ` GROUP BY code)
+	) ORDER BY code`
+}
+
+func (repo SQLiteStockRepository) query(query string, args ...interface{}) ([]Stock, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stocks []Stock
+	for rows.Next() {
+		var s Stock
+		var lastUpdate sqliteTime
+		err = rows.Scan(&s.Name, &s.Code, &s.SubSectorId, &s.SubSectorName, &s.SectorId, &s.SectorName,
+			&s.Last, &s.PrevClosingPrice, &s.AdjustedOpenPrice, &s.AdjustedHighPrice, &s.AdjustedLowPrice,
+			&s.Volume, &s.Frequency, &s.Value, &s.OneDay, &lastUpdate)
+		if err != nil {
+			return nil, err
+		}
+		s.LastUpdate = lastUpdate.Format(dbTimeLayout)
+		stocks = append(stocks, s)
+	}
+
+	return stocks, rows.Err()
+}
+
+func (repo SQLiteStockRepository) Downsample(before time.Time, resolution string, verify func([]StockLastUpdate) error) (int, error) {
+	// Timestamps are stored as text, their prefix is the truncated day or hour.
+	prefix := len("2006-01-02")
+	if resolution == resolutionHour {
+		prefix = len("2006-01-02 15")
+	}
+
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM stocks WHERE last_update < ?1 AND rowid NOT IN (
+		SELECT rowid FROM (
+			SELECT rowid, max(last_update) FROM stocks
+			WHERE last_update < ?1 GROUP BY code, substr(last_update, 1, ?2)
+		)
+	)`, before.UTC(), prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err = refreshLastUpdates(tx); err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(selectLastUpdates)
+	if err != nil {
+		return 0, err
+	}
+	updates, err := scanLastUpdates(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = verify(updates); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(deleted), nil
+}
+
+type SQLiteStockLastUpdateRepository struct {
+	db *sql.DB
+}
+
+const selectLastUpdates = "SELECT code, last_update FROM stock_last_updates ORDER BY code"
+
+func (repo SQLiteStockLastUpdateRepository) Get() ([]StockLastUpdate, error) {
+	rows, err := repo.db.Query(selectLastUpdates)
+	if err != nil {
+		return nil, err
+	}
+	return scanLastUpdates(rows)
+}
+
+func scanLastUpdates(rows *sql.Rows) ([]StockLastUpdate, error) {
+	defer rows.Close()
+
+	var updates []StockLastUpdate
+	for rows.Next() {
+		var code string
+		var lastUpdate sqliteTime
+		if err := rows.Scan(&code, &lastUpdate); err != nil {
+			return nil, err
+		}
+		updates = append(updates, StockLastUpdate{code, lastUpdate.Format(dbTimeLayout)})
+	}
+
+	return updates, rows.Err()
+}
+
+func (repo SQLiteStockLastUpdateRepository) Refresh() error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = refreshLastUpdates(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// refreshLastUpdates rebuilds the stock_last_updates table, standing in for the materialized view of PostgreSQL.
+func refreshLastUpdates(tx *sql.Tx) error {
+	if _, err := tx.Exec("DELETE FROM stock_last_updates"); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`INSERT INTO stock_last_updates (code, last_update)
+		SELECT code, max(last_update) FROM stocks GROUP BY code`)
+	return err
+}
+
+type SQLiteDailyBarRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteDailyBarRepository) Upsert(bars []Bar) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO daily_bars (code, date, open, high, low, close, volume, value, frequency)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (code, date) DO UPDATE SET
+			open = CASE WHEN open = 0 THEN excluded.open ELSE open END,
+			high = max(high, excluded.high),
+			low = min(low, excluded.low),
+			close = excluded.close,
+			volume = excluded.volume,
+			value = excluded.value,
+			frequency = excluded.frequency`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, b := range bars {
+		_, err = stmt.Exec(b.Code, b.Date.Format("2006-01-02"), b.Open, b.High, b.Low, b.Close, b.Volume, b.Value, b.Frequency)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo SQLiteDailyBarRepository) Daily(code string, from, to time.Time) ([]Bar, error) {
+	return repo.query(`SELECT code, date, open, high, low, close, volume, value, frequency
+		FROM daily_bars WHERE code = ? AND date BETWEEN ? AND ? ORDER BY date`,
+		code, from.Format("2006-01-02"), to.Format("2006-01-02"))
+}
+
+func (repo SQLiteDailyBarRepository) Since(from time.Time) ([]Bar, error) {
+	return repo.query(`SELECT code, date, open, high, low, close, volume, value, frequency
+		FROM daily_bars WHERE date >= ? ORDER BY code, date`, from.Format("2006-01-02"))
+}
+
+// sqliteAdjustedDailyBarsAsOf is the adjusted_daily_bars view only adjusted for the actions going ex
+// up to the day of its ?1 parameter.
+const sqliteAdjustedDailyBarsAsOf = `(
+	SELECT code, date,
+		open * after AS open,
+		high * after AS high,
+		low * after AS low,
+		close * after AS close,
+		volume / shares AS volume,
+		value,
+		frequency
+	FROM (
+		SELECT b.*,
+			COALESCE(exp(sum(ln(a.factor))), 1) AS after,
+			COALESCE(exp(sum(ln(a.factor)) FILTER (WHERE a.type IN ('split', 'reverse_split', 'bonus'))), 1) AS shares
+		FROM daily_bars b
+		LEFT JOIN corporate_actions a ON a.code = b.code AND a.ex_date > b.date AND a.ex_date <= ?1
+		GROUP BY b.code, b.date
+	)
+)`
+
+func (repo SQLiteDailyBarRepository) AdjustedDaily(code string, from, to time.Time) ([]Bar, error) {
+	return repo.query(`SELECT code, date, open, high, low, close, volume, value, frequency
+		FROM `+sqliteAdjustedDailyBarsAsOf+` WHERE code = ?2 AND date BETWEEN ?3 AND ?1 ORDER BY date`,
+		to.Format("2006-01-02"), code, from.Format("2006-01-02"))
+}
+
+func (repo SQLiteDailyBarRepository) AdjustedBetween(from, to time.Time) ([]Bar, error) {
+	return repo.query(`SELECT code, date, open, high, low, close, volume, value, frequency
+		FROM `+sqliteAdjustedDailyBarsAsOf+` WHERE date BETWEEN ?2 AND ?1 ORDER BY code, date`,
+		to.Format("2006-01-02"), from.Format("2006-01-02"))
+}
+
+func (repo SQLiteDailyBarRepository) Extremes(since, before time.Time) ([]PriceExtremes, error) {
+	rows, err := repo.db.Query(`SELECT code,
+			COALESCE(max(CASE WHEN date >= ?2 THEN high END), 0),
+			COALESCE(min(CASE WHEN date >= ?2 AND low > 0 THEN low END), 0),
+			COALESCE(max(high), 0)
+		FROM `+sqliteAdjustedDailyBarsAsOf+`
+		WHERE date < ?1
+		GROUP BY code
+		ORDER BY code`, before.Format("2006-01-02"), since.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var extremes []PriceExtremes
+	for rows.Next() {
+		var e PriceExtremes
+		if err = rows.Scan(&e.Code, &e.YearHigh, &e.YearLow, &e.AllTimeHigh); err != nil {
+			return nil, err
+		}
+		extremes = append(extremes, e)
+	}
+
+	return extremes, rows.Err()
+}
+
+func (repo SQLiteDailyBarRepository) query(query string, args ...interface{}) ([]Bar, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bars []Bar
+	for rows.Next() {
+		var b Bar
+		var date string
+		err = rows.Scan(&b.Code, &date, &b.Open, &b.High, &b.Low, &b.Close, &b.Volume, &b.Value, &b.Frequency)
+		if err != nil {
+			return nil, err
+		}
+		if b.Date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, err
+		}
+		bars = append(bars, b)
+	}
+
+	return bars, rows.Err()
+}
+
+type SQLiteCorporateActionRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteCorporateActionRepository) Upsert(actions []CorporateAction) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO corporate_actions (code, type, ex_date, old, new, price, amount, factor)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (code, type, ex_date) DO UPDATE SET
+			old = excluded.old,
+			new = excluded.new,
+			price = excluded.price,
+			amount = excluded.amount,
+			factor = excluded.factor`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, a := range actions {
+		_, err = stmt.Exec(a.Code, a.Type, a.ExDate.Format("2006-01-02"), a.Old, a.New, a.Price, a.Amount, a.Factor)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo SQLiteCorporateActionRepository) Get(code string) ([]CorporateAction, error) {
+	return repo.query(`SELECT code, type, ex_date, old, new, price, amount, factor
+		FROM corporate_actions WHERE code = ? ORDER BY ex_date`, code)
+}
+
+func (repo SQLiteCorporateActionRepository) Since(from time.Time) ([]CorporateAction, error) {
+	return repo.query(`SELECT code, type, ex_date, old, new, price, amount, factor
+		FROM corporate_actions WHERE ex_date >= ? ORDER BY code, ex_date`, from.Format("2006-01-02"))
+}
+
+func (repo SQLiteCorporateActionRepository) query(query string, args ...interface{}) ([]CorporateAction, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []CorporateAction
+	for rows.Next() {
+		var a CorporateAction
+		var exDate string
+		if err = rows.Scan(&a.Code, &a.Type, &exDate, &a.Old, &a.New, &a.Price, &a.Amount, &a.Factor); err != nil {
+			return nil, err
+		}
+		if a.ExDate, err = time.Parse("2006-01-02", exDate); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+
+	return actions, rows.Err()
+}
+
+type SQLiteSectorPerformanceRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteSectorPerformanceRepository) Upsert(perfs []SectorPerformance) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO sector_performances (date, level, id, name, count,
+			advancers, decliners, unchanged, avg_change, weighted_change, value)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (date, level, id) DO UPDATE SET
+			name = excluded.name,
+			count = excluded.count,
+			advancers = excluded.advancers,
+			decliners = excluded.decliners,
+			unchanged = excluded.unchanged,
+			avg_change = excluded.avg_change,
+			weighted_change = excluded.weighted_change,
+			value = excluded.value`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range perfs {
+		_, err = stmt.Exec(p.Date.Format("2006-01-02"), p.Level, p.Id, p.Name, p.Count,
+			p.Advancers, p.Decliners, p.Unchanged, p.AvgChange, p.WeightedChange, p.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo SQLiteSectorPerformanceRepository) Get(from, to time.Time) ([]SectorPerformance, error) {
+	rows, err := repo.db.Query(`SELECT date, level, id, name, count,
+			advancers, decliners, unchanged, avg_change, weighted_change, value
+		FROM sector_performances WHERE date BETWEEN ? AND ? ORDER BY date, level, id`,
+		from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var perfs []SectorPerformance
+	for rows.Next() {
+		var p SectorPerformance
+		var date string
+		err = rows.Scan(&date, &p.Level, &p.Id, &p.Name, &p.Count,
+			&p.Advancers, &p.Decliners, &p.Unchanged, &p.AvgChange, &p.WeightedChange, &p.Value)
+		if err != nil {
+			return nil, err
+		}
+		if p.Date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, err
+		}
+		perfs = append(perfs, p)
+	}
+
+	return perfs, rows.Err()
+}
+
+type SQLiteMarketBreadthRepository struct {
+	db *sql.DB
+}
+
+const selectMarketBreadthSQL = `SELECT date, advancers, decliners, unchanged, ad_ratio, ad_line,
+	new_highs, new_lows, above_ma20, above_ma50, above_ma200
+FROM market_breadths`
+
+func (repo SQLiteMarketBreadthRepository) Upsert(b MarketBreadth) error {
+	_, err := repo.db.Exec(`INSERT INTO market_breadths (date, advancers, decliners, unchanged, ad_ratio, ad_line,
+			new_highs, new_lows, above_ma20, above_ma50, above_ma200)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (date) DO UPDATE SET
+			advancers = excluded.advancers,
+			decliners = excluded.decliners,
+			unchanged = excluded.unchanged,
+			ad_ratio = excluded.ad_ratio,
+			ad_line = excluded.ad_line,
+			new_highs = excluded.new_highs,
+			new_lows = excluded.new_lows,
+			above_ma20 = excluded.above_ma20,
+			above_ma50 = excluded.above_ma50,
+			above_ma200 = excluded.above_ma200`,
+		b.Date.Format("2006-01-02"), b.Advancers, b.Decliners, b.Unchanged, b.AdRatio, b.AdLine,
+		b.NewHighs, b.NewLows, b.AboveMa20, b.AboveMa50, b.AboveMa200)
+	return err
+}
+
+func (repo SQLiteMarketBreadthRepository) Get(from, to time.Time) ([]MarketBreadth, error) {
+	return repo.query(selectMarketBreadthSQL+" WHERE date BETWEEN ? AND ? ORDER BY date",
+		from.Format("2006-01-02"), to.Format("2006-01-02"))
+}
+
+func (repo SQLiteMarketBreadthRepository) Before(day time.Time) (*MarketBreadth, error) {
+	breadths, err := repo.query(selectMarketBreadthSQL+" WHERE date < ? ORDER BY date DESC LIMIT 1",
+		day.Format("2006-01-02"))
+	if err != nil || len(breadths) == 0 {
+		return nil, err
+	}
+	return &breadths[0], nil
+}
+
+func (repo SQLiteMarketBreadthRepository) query(query string, args ...interface{}) ([]MarketBreadth, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var breadths []MarketBreadth
+	for rows.Next() {
+		var b MarketBreadth
+		var date string
+		err = rows.Scan(&date, &b.Advancers, &b.Decliners, &b.Unchanged, &b.AdRatio, &b.AdLine,
+			&b.NewHighs, &b.NewLows, &b.AboveMa20, &b.AboveMa50, &b.AboveMa200)
+		if err != nil {
+			return nil, err
+		}
+		if b.Date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, err
+		}
+		breadths = append(breadths, b)
+	}
+
+	return breadths, rows.Err()
+}
+
+type SQLiteIndicatorRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteIndicatorRepository) Upsert(values []Indicator) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO indicators (code, date, bars, sma20, sma50, sma200, ema12, ema26, macd, macd_signal, macd_hist, rsi14, bollinger_upper, bollinger_lower, atr14, avg_gain, avg_loss)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (code, date) DO UPDATE SET
+			bars = excluded.bars,
+			sma20 = excluded.sma20,
+			sma50 = excluded.sma50,
+			sma200 = excluded.sma200,
+			ema12 = excluded.ema12,
+			ema26 = excluded.ema26,
+			macd = excluded.macd,
+			macd_signal = excluded.macd_signal,
+			macd_hist = excluded.macd_hist,
+			rsi14 = excluded.rsi14,
+			bollinger_upper = excluded.bollinger_upper,
+			bollinger_lower = excluded.bollinger_lower,
+			atr14 = excluded.atr14,
+			avg_gain = excluded.avg_gain,
+			avg_loss = excluded.avg_loss`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, v := range values {
+		_, err = stmt.Exec(v.Code, v.Date.Format("2006-01-02"), v.Bars, v.Sma20, v.Sma50, v.Sma200, v.Ema12, v.Ema26,
+			v.Macd, v.MacdSignal, v.MacdHist, v.Rsi14, v.BollingerUpper, v.BollingerLower, v.Atr14, v.AvgGain, v.AvgLoss)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo SQLiteIndicatorRepository) Before(day time.Time) ([]Indicator, error) {
+	rows, err := repo.db.Query(`SELECT code, date, bars, sma20, sma50, sma200, ema12, ema26, macd, macd_signal, macd_hist, rsi14, bollinger_upper, bollinger_lower, atr14, avg_gain, avg_loss
+		FROM indicators
+		WHERE (code, date) IN (SELECT code, max(date) FROM indicators WHERE date < ? GROUP BY code)
+		ORDER BY code`, day.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []Indicator
+	for rows.Next() {
+		var v Indicator
+		var date string
+		err = rows.Scan(&v.Code, &date, &v.Bars, &v.Sma20, &v.Sma50, &v.Sma200, &v.Ema12, &v.Ema26,
+			&v.Macd, &v.MacdSignal, &v.MacdHist, &v.Rsi14, &v.BollingerUpper, &v.BollingerLower, &v.Atr14, &v.AvgGain, &v.AvgLoss)
+		if err != nil {
+			return nil, err
+		}
+		if v.Date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
+
+type SQLiteEventRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteEventRepository) Upsert(events []Event) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO events (code, date, type, value, reference)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (code, date, type) DO UPDATE SET
+			value = excluded.value,
+			reference = excluded.reference`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range events {
+		if _, err = stmt.Exec(e.Code, e.Date.Format("2006-01-02"), e.Type, e.Value, e.Reference); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo SQLiteEventRepository) Get(code string, from, to time.Time) ([]Event, error) {
+	rows, err := repo.db.Query(`SELECT code, date, type, value, reference
+		FROM events
+		WHERE date BETWEEN ? AND ? AND (? = '' OR code = ?)
+		ORDER BY date, code, type`,
+		from.Format("2006-01-02"), to.Format("2006-01-02"), code, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var date string
+		if err = rows.Scan(&e.Code, &date, &e.Type, &e.Value, &e.Reference); err != nil {
+			return nil, err
+		}
+		if e.Date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+type SQLiteAlertRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteAlertRepository) Add(rule *AlertRule) error {
+	res, err := repo.db.Exec(`INSERT INTO alert_rules (code, metric, op, threshold, triggered, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		rule.Code, rule.Metric, rule.Op, rule.Threshold, rule.Triggered, rule.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	rule.Id, err = res.LastInsertId()
+	return err
+}
+
+func (repo SQLiteAlertRepository) Delete(id int64) error {
+	res, err := repo.db.Exec("DELETE FROM alert_rules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("alert %d not found", id)
+	}
+	return nil
+}
+
+func (repo SQLiteAlertRepository) List() ([]AlertRule, error) {
+	rows, err := repo.db.Query(`SELECT id, code, metric, op, threshold, triggered, created_at
+		FROM alert_rules ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []AlertRule
+	for rows.Next() {
+		var r AlertRule
+		var createdAt sqliteTime
+		if err = rows.Scan(&r.Id, &r.Code, &r.Metric, &r.Op, &r.Threshold, &r.Triggered, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = createdAt.Time
+		rules = append(rules, r)
+	}
+
+	return rules, rows.Err()
+}
+
+func (repo SQLiteAlertRepository) SetTriggered(rules []AlertRule) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range rules {
+		if _, err = tx.Exec("UPDATE alert_rules SET triggered = ? WHERE id = ?", r.Triggered, r.Id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type SQLiteWatchlistRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteWatchlistRepository) Get(name string) (*Watchlist, error) {
+	watchlists, err := repo.query("SELECT name, codes, chat_id FROM watchlists WHERE name = ?", name)
+	if err != nil || len(watchlists) == 0 {
+		return nil, err
+	}
+	return &watchlists[0], nil
+}
+
+func (repo SQLiteWatchlistRepository) List() ([]Watchlist, error) {
+	return repo.query("SELECT name, codes, chat_id FROM watchlists ORDER BY name")
+}
+
+// Save stores the codes as a comma separated list.
+func (repo SQLiteWatchlistRepository) Save(wl Watchlist) error {
+	_, err := repo.db.Exec(`INSERT INTO watchlists (name, codes, chat_id) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET codes = excluded.codes, chat_id = excluded.chat_id`,
+		wl.Name, strings.Join(wl.Codes, ","), wl.ChatId)
+	return err
+}
+
+func (repo SQLiteWatchlistRepository) Delete(name string) error {
+	_, err := repo.db.Exec("DELETE FROM watchlists WHERE name = ?", name)
+	return err
+}
+
+func (repo SQLiteWatchlistRepository) query(query string, args ...interface{}) ([]Watchlist, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var watchlists []Watchlist
+	for rows.Next() {
+		var wl Watchlist
+		var codes string
+		if err = rows.Scan(&wl.Name, &codes, &wl.ChatId); err != nil {
+			return nil, err
+		}
+		if len(codes) > 0 {
+			wl.Codes = strings.Split(codes, ",")
+		}
+		watchlists = append(watchlists, wl)
+	}
+
+	return watchlists, rows.Err()
+}
+
+type SQLiteTradeRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteTradeRepository) Add(trade *Trade) error {
+	res, err := repo.db.Exec(`INSERT INTO trades (code, date, side, lots, price, fees) VALUES (?, ?, ?, ?, ?, ?)`,
+		trade.Code, trade.Date.Format("2006-01-02"), trade.Side, trade.Lots, trade.Price, trade.Fees)
+	if err != nil {
+		return err
+	}
+
+	trade.Id, err = res.LastInsertId()
+	return err
+}
+
+func (repo SQLiteTradeRepository) Delete(id int64) error {
+	res, err := repo.db.Exec("DELETE FROM trades WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("trade %d not found", id)
+	}
+	return nil
+}
+
+func (repo SQLiteTradeRepository) List() ([]Trade, error) {
+	rows, err := repo.db.Query("SELECT id, code, date, side, lots, price, fees FROM trades ORDER BY date, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trades []Trade
+	for rows.Next() {
+		var t Trade
+		var date string
+		if err = rows.Scan(&t.Id, &t.Code, &date, &t.Side, &t.Lots, &t.Price, &t.Fees); err != nil {
+			return nil, err
+		}
+		if t.Date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+
+	return trades, rows.Err()
+}
+
+type SQLitePortfolioSnapshotRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLitePortfolioSnapshotRepository) Upsert(snap PortfolioSnapshot) error {
+	_, err := repo.db.Exec(`INSERT INTO portfolio_snapshots (date, market_value, cost, unrealized, realized, daily_pnl)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (date) DO UPDATE SET
+			market_value = excluded.market_value,
+			cost = excluded.cost,
+			unrealized = excluded.unrealized,
+			realized = excluded.realized,
+			daily_pnl = excluded.daily_pnl`,
+		snap.Date.Format("2006-01-02"), snap.MarketValue, snap.Cost, snap.Unrealized, snap.Realized, snap.DailyPnl)
+	return err
+}
+
+func (repo SQLitePortfolioSnapshotRepository) Before(day time.Time) (*PortfolioSnapshot, error) {
+	var snap PortfolioSnapshot
+	var date string
+	err := repo.db.QueryRow(`SELECT date, market_value, cost, unrealized, realized, daily_pnl
+		FROM portfolio_snapshots WHERE date < ? ORDER BY date DESC LIMIT 1`, day.Format("2006-01-02")).
+		Scan(&date, &snap.MarketValue, &snap.Cost, &snap.Unrealized, &snap.Realized, &snap.DailyPnl)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snap.Date, err = time.Parse("2006-01-02", date)
+	return &snap, err
+}
+
+type SQLiteCustomIndexRepository struct {
+	db *sql.DB
+}
+
+const customIndexColumns = "name, weighting, codes, sector_id, base_date, base_value"
+
+func (repo SQLiteCustomIndexRepository) Get(name string) (*CustomIndex, error) {
+	indices, err := repo.query("SELECT "+customIndexColumns+" FROM custom_indices WHERE name = ?", name)
+	if err != nil || len(indices) == 0 {
+		return nil, err
+	}
+	return &indices[0], nil
+}
+
+func (repo SQLiteCustomIndexRepository) List() ([]CustomIndex, error) {
+	return repo.query("SELECT " + customIndexColumns + " FROM custom_indices ORDER BY name")
+}
+
+// Save stores the codes as a comma separated list, and an empty base date until the index is computed.
+func (repo SQLiteCustomIndexRepository) Save(ix CustomIndex) error {
+	var baseDate string
+	if !ix.BaseDate.IsZero() {
+		baseDate = ix.BaseDate.Format("2006-01-02")
+	}
+
+	_, err := repo.db.Exec(`INSERT INTO custom_indices (`+customIndexColumns+`) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			weighting = excluded.weighting,
+			codes = excluded.codes,
+			sector_id = excluded.sector_id,
+			base_date = excluded.base_date,
+			base_value = excluded.base_value`,
+		ix.Name, ix.Weighting, strings.Join(ix.Codes, ","), ix.SectorId, baseDate, ix.BaseValue)
+	return err
+}
+
+func (repo SQLiteCustomIndexRepository) Delete(name string) error {
+	_, err := repo.db.Exec("DELETE FROM custom_indices WHERE name = ?", name)
+	return err
+}
+
+func (repo SQLiteCustomIndexRepository) query(query string, args ...interface{}) ([]CustomIndex, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indices []CustomIndex
+	for rows.Next() {
+		var ix CustomIndex
+		var codes, baseDate string
+		if err = rows.Scan(&ix.Name, &ix.Weighting, &codes, &ix.SectorId, &baseDate, &ix.BaseValue); err != nil {
+			return nil, err
+		}
+		if len(codes) > 0 {
+			ix.Codes = strings.Split(codes, ",")
+		}
+		if len(baseDate) > 0 {
+			if ix.BaseDate, err = time.Parse("2006-01-02", baseDate); err != nil {
+				return nil, err
+			}
+		}
+		indices = append(indices, ix)
+	}
+
+	return indices, rows.Err()
+}
+
+type SQLiteIndexValueRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteIndexValueRepository) Upsert(values []IndexValue) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO index_values (name, date, value, change, divisor, members)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name, date) DO UPDATE SET
+			value = excluded.value,
+			change = excluded.change,
+			divisor = excluded.divisor,
+			members = excluded.members`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, v := range values {
+		if _, err = stmt.Exec(v.Name, v.Date.Format("2006-01-02"), v.Value, v.Change, v.Divisor, v.Members); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo SQLiteIndexValueRepository) Before(day time.Time) ([]IndexValue, error) {
+	return repo.query(`SELECT name, date, value, change, divisor, members
+		FROM index_values
+		WHERE (name, date) IN (SELECT name, max(date) FROM index_values WHERE date < ? GROUP BY name)
+		ORDER BY name`, day.Format("2006-01-02"))
+}
+
+func (repo SQLiteIndexValueRepository) Get(name string, from time.Time) ([]IndexValue, error) {
+	return repo.query(`SELECT name, date, value, change, divisor, members
+		FROM index_values WHERE name = ? AND date >= ? ORDER BY date`, name, from.Format("2006-01-02"))
+}
+
+func (repo SQLiteIndexValueRepository) Delete(name string) error {
+	_, err := repo.db.Exec("DELETE FROM index_values WHERE name = ?", name)
+	return err
+}
+
+func (repo SQLiteIndexValueRepository) query(query string, args ...interface{}) ([]IndexValue, error) {
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []IndexValue
+	for rows.Next() {
+		var v IndexValue
+		var date string
+		if err = rows.Scan(&v.Name, &date, &v.Value, &v.Change, &v.Divisor, &v.Members); err != nil {
+			return nil, err
+		}
+		if v.Date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
+
+type SQLiteStockRatiosRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteStockRatiosRepository) Upsert(ratios []StockRatios) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO stock_ratios (code, one_week, one_month, three_month, six_month, one_year, mtd, ytd, per, pbr, roe, capitalization)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (code) DO UPDATE SET
+			one_week = excluded.one_week,
+			one_month = excluded.one_month,
+			three_month = excluded.three_month,
+			six_month = excluded.six_month,
+			one_year = excluded.one_year,
+			mtd = excluded.mtd,
+			ytd = excluded.ytd,
+			per = excluded.per,
+			pbr = excluded.pbr,
+			roe = excluded.roe,
+			capitalization = excluded.capitalization`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range ratios {
+		_, err = stmt.Exec(r.Code, r.OneWeek, r.OneMonth, r.ThreeMonth, r.SixMonth, r.OneYear, r.Mtd, r.Ytd,
+			r.Per, r.Pbr, r.Roe, r.Capitalization)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repo SQLiteStockRatiosRepository) Get() ([]StockRatios, error) {
+	rows, err := repo.db.Query(`SELECT code, one_week, one_month, three_month, six_month, one_year, mtd, ytd, per, pbr, roe, capitalization
+		FROM stock_ratios ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ratios []StockRatios
+	for rows.Next() {
+		var r StockRatios
+		err = rows.Scan(&r.Code, &r.OneWeek, &r.OneMonth, &r.ThreeMonth, &r.SixMonth, &r.OneYear, &r.Mtd, &r.Ytd,
+			&r.Per, &r.Pbr, &r.Roe, &r.Capitalization)
+		if err != nil {
+			return nil, err
+		}
+		ratios = append(ratios, r)
+	}
+
+	return ratios, rows.Err()
+}
+
+type SQLiteScreenRepository struct {
+	db *sql.DB
+}
+
+func (repo SQLiteScreenRepository) Get(name string) (*Screen, error) {
+	var sc Screen
+	err := repo.db.QueryRow("SELECT name, expression FROM screens WHERE name = ?", name).Scan(&sc.Name, &sc.Expression)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+func (repo SQLiteScreenRepository) List() ([]Screen, error) {
+	rows, err := repo.db.Query("SELECT name, expression FROM screens ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var screens []Screen
+	for rows.Next() {
+		var sc Screen
+		if err = rows.Scan(&sc.Name, &sc.Expression); err != nil {
+			return nil, err
+		}
+		screens = append(screens, sc)
+	}
+
+	return screens, rows.Err()
+}
+
+func (repo SQLiteScreenRepository) Save(sc Screen) error {
+	_, err := repo.db.Exec(`INSERT INTO screens (name, expression) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET expression = excluded.expression`, sc.Name, sc.Expression)
+	return err
+}
+
+func (repo SQLiteScreenRepository) Delete(name string) error {
+	_, err := repo.db.Exec("DELETE FROM screens WHERE name = ?", name)
+	return err
+}
@@ -0,0 +1,190 @@
+package ingest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func openTestSQLite(t *testing.T) *sql.DB {
+	db, err := openSQLite(filepath.Join(t.TempDir(), "instock.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestOpenSQLiteShouldReplaceTheViewsOfAnExistingDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instock.db")
+	db, err := openSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a view as left by an older schema
+	_, err = db.Exec("DROP VIEW adjusted_daily_bars; CREATE VIEW adjusted_daily_bars AS SELECT 'stale' AS code")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = openSQLite(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var code string
+	if err = db.QueryRow("SELECT code FROM adjusted_daily_bars").Scan(&code); err != sql.ErrNoRows {
+		t.Errorf("Expect the view to be replaced, got %q, %v", code, err)
+	}
+}
+
+func TestSQLiteStockRepositoryInsertShouldReturnNumberOfInsertedStocks(t *testing.T) {
+	testStockRepositoryInsert(t, SQLiteStockRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteStockRepositoryInsertGivenInvalidLastUpdateShouldReturnError(t *testing.T) {
+	db := openTestSQLite(t)
+	repo := SQLiteStockRepository{db: db}
+
+	_, err := repo.Insert([]Stock{{Code: "X", LastUpdate: "invalid"}})
+
+	if err == nil {
+		t.Error("Expect error not to be nil")
+	}
+}
+
+func TestSQLiteStockLastUpdateRepositoryRefreshShouldKeepLatestUpdatePerCode(t *testing.T) {
+	db := openTestSQLite(t)
+	testStockLastUpdateRepository(t, SQLiteStockRepository{db: db}, SQLiteStockLastUpdateRepository{db: db})
+}
+
+func TestOpenStorageGivenUnknownStorageShouldReturnError(t *testing.T) {
+	cfg := Config{Storage: "mysql"}
+
+	_, err := openStorage(&cfg)
+
+	if err == nil {
+		t.Error("Expect error not to be nil")
+	}
+}
+
+func TestOpenStorageGivenSQLiteWithoutPathShouldReturnError(t *testing.T) {
+	cfg := Config{Storage: storageSQLite}
+
+	_, err := openStorage(&cfg)
+
+	if err == nil {
+		t.Error("Expect error not to be nil")
+	}
+}
+
+func TestSQLiteStockRepositoryShouldQueryHistory(t *testing.T) {
+	testStockHistoryRepository(t, SQLiteStockRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteDailyBarRepositoryUpsertShouldMergeBarsOfTheSameDay(t *testing.T) {
+	testDailyBarRepository(t, SQLiteDailyBarRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteCorporateActionRepositoryUpsertShouldReplaceTheSameAction(t *testing.T) {
+	testCorporateActionRepository(t, SQLiteCorporateActionRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteStockRepositoryDownsamplePerDayShouldKeepLatestSnapshotOfTheDay(t *testing.T) {
+	expected := []Stock{{Code: "A", Last: 102}, {Code: "A", Last: 103}}
+	testStockRetentionRepository(t, SQLiteStockRepository{db: openTestSQLite(t)}, resolutionDay, 2, expected)
+}
+
+func TestSQLiteStockRepositoryDownsamplePerHourShouldKeepLatestSnapshotOfTheHour(t *testing.T) {
+	expected := []Stock{{Code: "A", Last: 101}, {Code: "A", Last: 102}, {Code: "A", Last: 103}}
+	testStockRetentionRepository(t, SQLiteStockRepository{db: openTestSQLite(t)}, resolutionHour, 1, expected)
+}
+
+func TestSQLiteStockRepositoryDownsampleGivenFailedVerifyShouldKeepAllSnapshots(t *testing.T) {
+	testStockRetentionRepositoryRollback(t, SQLiteStockRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteSectorPerformanceRepositoryUpsertShouldReplaceTheSameDayLevelAndId(t *testing.T) {
+	testSectorPerformanceRepository(t, SQLiteSectorPerformanceRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteMarketBreadthRepositoryShouldUpsertAndQueryByDay(t *testing.T) {
+	testMarketBreadthRepository(t, SQLiteMarketBreadthRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteIndicatorRepositoryBeforeShouldReturnLatestIndicatorsPerCode(t *testing.T) {
+	testIndicatorRepository(t, SQLiteIndicatorRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteDailyBarRepositoryExtremesShouldAggregateAdjustedBarsBeforeTheGivenDay(t *testing.T) {
+	db := openTestSQLite(t)
+	testDailyBarRepositoryExtremes(t, SQLiteDailyBarRepository{db: db}, SQLiteCorporateActionRepository{db: db})
+}
+
+func TestSQLiteDailyBarRepositoryAdjustedDailyShouldApplyTheFactorsOfLaterActions(t *testing.T) {
+	db := openTestSQLite(t)
+	testDailyBarRepositoryAdjusted(t, SQLiteDailyBarRepository{db: db}, SQLiteCorporateActionRepository{db: db})
+}
+
+func TestSQLiteAdjustedStocksShouldApplyTheFactorsOfLaterActions(t *testing.T) {
+	db := openTestSQLite(t)
+	if _, err := (SQLiteStockRepository{db: db}).Insert([]Stock{
+		{Code: "A", LastUpdate: "2020-01-31T16:00:00", Last: 1000, PrevClosingPrice: 1000, Volume: 100},
+		{Code: "A", LastUpdate: "2020-02-03T16:00:00", Last: 210, PrevClosingPrice: 1000, Volume: 500},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	actions := []CorporateAction{
+		{Code: "A", Type: actionSplit, ExDate: date("2020-02-03"), Old: 1, New: 5, Factor: 0.2},
+		{Code: "A", Type: actionDividend, ExDate: date("2020-02-04"), Amount: 21, Factor: 0.9},
+	}
+	if err := (SQLiteCorporateActionRepository{db: db}).Upsert(actions); err != nil {
+		t.Fatal(err)
+	}
+
+	var last, prevClose, oneDay float64
+	err := db.QueryRow(`SELECT last, prev_closing_price, one_day FROM adjusted_stocks
+		WHERE last_update >= '2020-02-03' ORDER BY last_update LIMIT 1`).Scan(&last, &prevClose, &oneDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !almostEqual(last, 189) || !almostEqual(prevClose, 180) || !almostEqual(oneDay, 0.05) {
+		t.Errorf("Expect last 189, previous close 180 and one day 0.05 on the ex-date, got %g, %g and %g", last, prevClose, oneDay)
+	}
+}
+
+func TestSQLiteEventRepositoryGetShouldFilterByCodeAndDate(t *testing.T) {
+	testEventRepository(t, SQLiteEventRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteAlertRepositoryShouldAddListUpdateAndDeleteRules(t *testing.T) {
+	testAlertRepository(t, SQLiteAlertRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteWatchlistRepositoryShouldSaveGetListAndDelete(t *testing.T) {
+	testWatchlistRepository(t, SQLiteWatchlistRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteTradeRepositoryShouldAddListAndDeleteTrades(t *testing.T) {
+	testTradeRepository(t, SQLiteTradeRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLitePortfolioSnapshotRepositoryBeforeShouldReturnTheLatestEarlierSnapshot(t *testing.T) {
+	testPortfolioSnapshotRepository(t, SQLitePortfolioSnapshotRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteCustomIndexRepositoryShouldSaveAndListIndices(t *testing.T) {
+	testCustomIndexRepository(t, SQLiteCustomIndexRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteIndexValueRepositoryBeforeShouldReturnTheLatestValueOfEveryIndex(t *testing.T) {
+	testIndexValueRepository(t, SQLiteIndexValueRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteStockRatiosRepositoryShouldKeepTheLatestRatiosOfEveryCode(t *testing.T) {
+	testStockRatiosRepository(t, SQLiteStockRatiosRepository{db: openTestSQLite(t)})
+}
+
+func TestSQLiteScreenRepositoryShouldSaveReplaceAndDeleteScreens(t *testing.T) {
+	testScreenRepository(t, SQLiteScreenRepository{db: openTestSQLite(t)})
+}
@@ -0,0 +1,568 @@
+package ingest
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/chrishadi/instock/indicators"
+	"github.com/go-pg/pg/v10"
+)
+
+// The test*Repository helpers check the behavior every storage shares; they are run against
+// the memory and SQLite repositories, and against the PostgreSQL ones when PG_TEST_DATABASE is set.
+
+func testStockRepositoryInsert(t *testing.T, repo StockRepository) {
+	inserted, err := repo.Insert([]Stock{a, b, c})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted != 3 {
+		t.Errorf("Expect 3 inserted, got %d", inserted)
+	}
+}
+
+func testStockLastUpdateRepository(t *testing.T, stocks StockRepository, repo StockLastUpdateRepository) {
+	older := Stock{Code: "A", LastUpdate: "2020-02-01T00:00:00"}
+	if _, err := stocks.Insert([]Stock{older, a, b}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	updates, err := repo.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []StockLastUpdate{
+		{Code: "A", LastUpdate: "2020-02-03 00:00:00"},
+		{Code: "B", LastUpdate: "2020-02-02 00:00:00"},
+	}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, updates)
+	}
+}
+
+func testCorporateActionRepository(t *testing.T, repo CorporateActionRepository) {
+	split := CorporateAction{Code: "A", Type: actionSplit, ExDate: date("2020-02-03"), Old: 1, New: 2, Factor: 0.5}
+	corrected := CorporateAction{Code: "A", Type: actionSplit, ExDate: date("2020-02-03"), Old: 1, New: 5, Factor: 0.2}
+
+	if err := repo.Upsert([]CorporateAction{split}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert([]CorporateAction{corrected}); err != nil {
+		t.Fatal(err)
+	}
+	actions, err := repo.Get("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []CorporateAction{corrected}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actions)
+	}
+}
+
+func testDailyBarRepositoryExtremes(t *testing.T, repo DailyBarRepository, actions CorporateActionRepository) {
+	err := repo.Upsert([]Bar{
+		{Code: "A", Date: date("2018-12-31"), High: 200, Low: 10},
+		{Code: "A", Date: date("2019-06-03"), High: 100, Low: 90},
+		{Code: "A", Date: date("2019-06-04"), High: 120, Low: 0},
+		{Code: "A", Date: date("2020-02-03"), High: 150, Low: 80},
+		{Code: "B", Date: date("2018-12-31"), High: 100, Low: 80},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	split := CorporateAction{Code: "B", Type: actionSplit, ExDate: date("2019-01-02"), Old: 1, New: 2, Factor: 0.5}
+	// going ex after the given day, so not yet in its prices
+	future := CorporateAction{Code: "A", Type: actionSplit, ExDate: date("2020-03-02"), Old: 1, New: 2, Factor: 0.5}
+	if err = actions.Upsert([]CorporateAction{split, future}); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := repo.Extremes(date("2019-02-03"), date("2020-02-03"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []PriceExtremes{{Code: "A", YearHigh: 120, YearLow: 90, AllTimeHigh: 200}, {Code: "B", AllTimeHigh: 50}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func testDailyBarRepositoryAdjusted(t *testing.T, repo DailyBarRepository, actions CorporateActionRepository) {
+	err := repo.Upsert([]Bar{
+		{Code: "A", Date: date("2020-01-31"), Open: 990, High: 1010, Low: 980, Close: 1000, Volume: 100, Value: 100000},
+		{Code: "A", Date: date("2020-02-03"), Open: 200, High: 212, Low: 198, Close: 210, Volume: 500, Value: 105000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = actions.Upsert([]CorporateAction{
+		{Code: "A", Type: actionSplit, ExDate: date("2020-02-03"), Old: 1, New: 5, Factor: 0.2},
+		{Code: "A", Type: actionDividend, ExDate: date("2020-02-04"), Amount: 21, Factor: 0.9},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := repo.AdjustedDaily("A", date("2020-01-01"), date("2020-02-04"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Bar{
+		{Code: "A", Date: date("2020-01-31"), Open: 178.2, High: 181.8, Low: 176.4, Close: 180, Volume: 500, Value: 100000},
+		{Code: "A", Date: date("2020-02-03"), Open: 180, High: 190.8, Low: 178.2, Close: 189, Volume: 500, Value: 105000},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+
+	// up to the day before the dividend goes ex, only the split applies
+	actual, err = repo.AdjustedBetween(date("2020-01-01"), date("2020-02-03"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []Bar{
+		{Code: "A", Date: date("2020-01-31"), Open: 198, High: 202, Low: 196, Close: 200, Volume: 500, Value: 100000},
+		{Code: "A", Date: date("2020-02-03"), Open: 200, High: 212, Low: 198, Close: 210, Volume: 500, Value: 105000},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func testSectorPerformanceRepository(t *testing.T, repo SectorPerformanceRepository) {
+	first := SectorPerformance{Date: date("2020-02-03"), Level: levelSector, Id: 1, Name: "Finance", Count: 1, Value: 100}
+	later := SectorPerformance{Date: date("2020-02-03"), Level: levelSector, Id: 1, Name: "Finance", Count: 2, Advancers: 2, AvgChange: 0.1, WeightedChange: 0.2, Value: 300}
+
+	if err := repo.Upsert([]SectorPerformance{first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert([]SectorPerformance{later}); err != nil {
+		t.Fatal(err)
+	}
+	perfs, err := repo.Get(date("2020-02-01"), date("2020-02-05"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []SectorPerformance{later}; !reflect.DeepEqual(perfs, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, perfs)
+	}
+}
+
+func testMarketBreadthRepository(t *testing.T, repo MarketBreadthRepository) {
+	first := MarketBreadth{Date: date("2020-01-31"), Advancers: 1, AdLine: 1}
+	second := MarketBreadth{Date: date("2020-02-03"), Advancers: 1, AdLine: 2}
+	corrected := MarketBreadth{Date: date("2020-02-03"), Advancers: 2, Decliners: 1, AdRatio: 2, AdLine: 2, NewHighs: 1, AboveMa20: 0.5, AboveMa200: 0.25}
+
+	for _, b := range []MarketBreadth{first, second, corrected} {
+		if err := repo.Upsert(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	breadths, err := repo.Get(date("2020-01-01"), date("2020-02-03"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []MarketBreadth{first, corrected}; !reflect.DeepEqual(breadths, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, breadths)
+	}
+
+	prev, err := repo.Before(date("2020-02-03"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev == nil || !reflect.DeepEqual(*prev, first) {
+		t.Errorf("Expect %+v, got %+v", first, prev)
+	}
+	if prev, _ = repo.Before(date("2020-01-31")); prev != nil {
+		t.Errorf("Expect nil, got %+v", prev)
+	}
+}
+
+func testIndicatorRepository(t *testing.T, repo IndicatorRepository) {
+	a1 := Indicator{Code: "A", Date: date("2020-01-30"), Values: indicators.Values{Bars: 1}}
+	a2 := Indicator{Code: "A", Date: date("2020-01-31"), Values: indicators.Values{Bars: 2, Sma20: 1.5, Sma200: 1.25, Rsi14: 60}}
+	a3 := Indicator{Code: "A", Date: date("2020-02-03"), Values: indicators.Values{Bars: 3}}
+	b1 := Indicator{Code: "B", Date: date("2020-01-30"), Values: indicators.Values{Bars: 1, Atr14: 2}}
+	corrected := Indicator{Code: "B", Date: date("2020-01-30"), Values: indicators.Values{Bars: 1, Atr14: 3}}
+
+	if err := repo.Upsert([]Indicator{a1, a2, a3, b1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert([]Indicator{corrected}); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := repo.Before(date("2020-02-03"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []Indicator{a2, corrected}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func testEventRepository(t *testing.T, repo EventRepository) {
+	a1 := Event{"A", date("2020-01-31"), eventYearHigh, 110, 100}
+	a2 := Event{"A", date("2020-02-03"), eventYearHigh, 120, 110}
+	b2 := Event{"B", date("2020-02-03"), eventYearLow, 40, 50}
+	corrected := Event{"A", date("2020-02-03"), eventYearHigh, 125, 110}
+
+	if err := repo.Upsert([]Event{a1, a2, b2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert([]Event{corrected}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]Event{"A": {a1, corrected}, "": {a1, corrected, b2}}
+	for code, expected := range tests {
+		actual, err := repo.Get(code, date("2020-01-01"), date("2020-02-03"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expect %+v, got %+v", code, expected, actual)
+		}
+	}
+}
+
+func testAlertRepository(t *testing.T, repo AlertRepository) {
+	first := AlertRule{Code: "A", Metric: "last", Op: ">", Threshold: 100, CreatedAt: date("2020-02-03")}
+	second := AlertRule{Code: "B", Metric: "rsi14", Op: "<", Threshold: 30, CreatedAt: date("2020-02-03")}
+
+	if err := repo.Add(&first); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(&second); err != nil {
+		t.Fatal(err)
+	}
+	first.Triggered = true
+	if err := repo.SetTriggered([]AlertRule{first}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(second.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(second.Id); err == nil {
+		t.Error("Expect error deleting a missing rule, got nil")
+	}
+
+	rules, err := repo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Id != first.Id || !rules[0].Triggered || !rules[0].CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("Expect %+v, got %+v", first, rules)
+	}
+}
+
+func testWatchlistRepository(t *testing.T, repo WatchlistRepository) {
+	core := Watchlist{Name: "core", Codes: []string{"BBCA", "BBRI"}}
+	banks := Watchlist{Name: "banks", Codes: []string{"BMRI"}, ChatId: 456}
+
+	for _, wl := range []Watchlist{core, banks, {Name: "core", Codes: []string{"BBCA"}}} {
+		if err := repo.Save(wl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	core.Codes = []string{"BBCA"}
+
+	watchlists, err := repo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []Watchlist{banks, core}; !reflect.DeepEqual(watchlists, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, watchlists)
+	}
+
+	if err = repo.Delete("core"); err != nil {
+		t.Fatal(err)
+	}
+	if wl, err := repo.Get("core"); err != nil || wl != nil {
+		t.Errorf("Expect nil, got %+v, %v", wl, err)
+	}
+}
+
+func testTradeRepository(t *testing.T, repo TradeRepository) {
+	later := Trade{Code: "A", Date: date("2020-01-03"), Side: sideSell, Lots: 1, Price: 110, Fees: 5}
+	earlier := Trade{Code: "A", Date: date("2020-01-02"), Side: sideBuy, Lots: 2, Price: 100}
+	other := Trade{Code: "B", Date: date("2020-01-02"), Side: sideBuy, Lots: 1, Price: 50}
+
+	for _, trade := range []*Trade{&later, &earlier, &other} {
+		if err := repo.Add(trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Delete(other.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	trades, err := repo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []Trade{earlier, later}; !reflect.DeepEqual(trades, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, trades)
+	}
+}
+
+func testPortfolioSnapshotRepository(t *testing.T, repo PortfolioSnapshotRepository) {
+	first := PortfolioSnapshot{Date: date("2020-01-31"), MarketValue: 100, Cost: 90, Unrealized: 10}
+	second := PortfolioSnapshot{Date: date("2020-02-03"), MarketValue: 110, Cost: 90, Unrealized: 20, DailyPnl: 10}
+
+	for _, snap := range []PortfolioSnapshot{first, {Date: date("2020-02-03")}, second} {
+		if err := repo.Upsert(snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for day, expected := range map[string]*PortfolioSnapshot{"2020-01-31": nil, "2020-02-03": &first, "2020-02-04": &second} {
+		actual, err := repo.Before(date(day))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: expect %+v, got %+v", day, expected, actual)
+		}
+	}
+}
+
+func testCustomIndexRepository(t *testing.T, repo CustomIndexRepository) {
+	sector := CustomIndex{Name: "fin", Weighting: weightCap, SectorId: 3, BaseValue: 100}
+	codes := CustomIndex{Name: "big", Weighting: weightPrice, Codes: []string{"A", "B"}, BaseDate: date("2020-01-02"), BaseValue: 1000}
+
+	for _, ix := range []CustomIndex{sector, codes, {Name: "gone", Weighting: weightEqual, Codes: []string{"C"}}} {
+		if err := repo.Save(ix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Delete("gone"); err != nil {
+		t.Fatal(err)
+	}
+
+	indices, err := repo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []CustomIndex{codes, sector}; !reflect.DeepEqual(indices, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, indices)
+	}
+}
+
+func testIndexValueRepository(t *testing.T, repo IndexValueRepository) {
+	values := []IndexValue{
+		{Name: "a", Date: date("2020-01-30"), Value: 100, Divisor: 2, Members: 2},
+		{Name: "a", Date: date("2020-01-31"), Value: 110, Change: 0.1, Divisor: 2, Members: 2},
+		{Name: "a", Date: date("2020-02-03"), Value: 99, Change: -0.1, Divisor: 2, Members: 2},
+		{Name: "b", Date: date("2020-01-30"), Value: 1000, Divisor: 0.5, Members: 1},
+	}
+
+	if err := repo.Upsert(values); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := repo.Before(date("2020-02-03"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []IndexValue{values[1], values[3]}; !reflect.DeepEqual(latest, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, latest)
+	}
+
+	if err = repo.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := repo.Get("a", date("2020-01-01")); len(rest) != 0 {
+		t.Errorf("Expect no values, got %+v", rest)
+	}
+}
+
+func testStockRatiosRepository(t *testing.T, repo StockRatiosRepository) {
+	latest := StockRatios{Code: "A", OneWeek: 0.01, Ytd: -0.2, Per: 8, Pbr: 1.2, Roe: 0.15, Capitalization: 1e12}
+	other := StockRatios{Code: "B", Per: 20}
+
+	for _, ratios := range [][]StockRatios{{{Code: "A", Per: 10}, other}, {latest}} {
+		if err := repo.Upsert(ratios); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ratios, err := repo.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []StockRatios{latest, other}; !reflect.DeepEqual(ratios, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, ratios)
+	}
+}
+
+func testScreenRepository(t *testing.T, repo ScreenRepository) {
+	for _, sc := range []Screen{{"cheap", "per < 10"}, {"big", "value > 1e12"}, {"cheap", "per < 8"}} {
+		if err := repo.Save(sc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Delete("big"); err != nil {
+		t.Fatal(err)
+	}
+
+	screens, err := repo.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []Screen{{"cheap", "per < 8"}}; !reflect.DeepEqual(screens, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, screens)
+	}
+	if sc, err := repo.Get("big"); sc != nil || err != nil {
+		t.Errorf("Expect nil, got %+v, %v", sc, err)
+	}
+}
+
+const pgTestTables = `stocks, daily_bars, corporate_actions, sector_performances, market_breadths, indicators,
+	events, alert_rules, watchlists, trades, portfolio_snapshots, custom_indices, index_values, stock_ratios, screens`
+
+var pgTestSchema struct {
+	once sync.Once
+	err  error
+}
+
+// openTestPG connects to the PG_TEST_DATABASE database with empty tables, skipping the test if it is not set.
+func openTestPG(t *testing.T) *pg.DB {
+	testDBName := os.Getenv("PG_TEST_DATABASE")
+	if len(testDBName) == 0 {
+		t.Skip("this test requires PG_TEST_DATABASE env var to be specified")
+	}
+
+	db, err := connectTestDB(testDBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pgTestSchema.once.Do(func() { pgTestSchema.err = setUpDB(db) })
+	if pgTestSchema.err != nil {
+		db.Close()
+		t.Fatal(pgTestSchema.err)
+	}
+
+	truncate := func() error {
+		if _, err := db.Exec("TRUNCATE " + pgTestTables + " RESTART IDENTITY"); err != nil {
+			return err
+		}
+		_, err := db.Exec("REFRESH MATERIALIZED VIEW stock_last_updates")
+		return err
+	}
+	if err = truncate(); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		truncate()
+		db.Close()
+	})
+	return db
+}
+
+func TestPGStockRepositoryInsertShouldReturnNumberOfInsertedStocks(t *testing.T) {
+	testStockRepositoryInsert(t, PGStockRepository{db: openTestPG(t)})
+}
+
+func TestPGStockLastUpdateRepositoryRefreshShouldKeepLatestUpdatePerCode(t *testing.T) {
+	db := openTestPG(t)
+	testStockLastUpdateRepository(t, PGStockRepository{db: db}, PGStockLastUpdateRepository{db: db})
+}
+
+func TestPGStockRepositoryShouldQueryHistory(t *testing.T) {
+	testStockHistoryRepository(t, PGStockRepository{db: openTestPG(t)})
+}
+
+func TestPGStockRepositoryDownsamplePerDayShouldKeepLatestSnapshotOfTheDay(t *testing.T) {
+	expected := []Stock{{Code: "A", Last: 102}, {Code: "A", Last: 103}}
+	testStockRetentionRepository(t, PGStockRepository{db: openTestPG(t)}, resolutionDay, 2, expected)
+}
+
+func TestPGStockRepositoryDownsamplePerHourShouldKeepLatestSnapshotOfTheHour(t *testing.T) {
+	expected := []Stock{{Code: "A", Last: 101}, {Code: "A", Last: 102}, {Code: "A", Last: 103}}
+	testStockRetentionRepository(t, PGStockRepository{db: openTestPG(t)}, resolutionHour, 1, expected)
+}
+
+func TestPGStockRepositoryDownsampleGivenFailedVerifyShouldKeepAllSnapshots(t *testing.T) {
+	testStockRetentionRepositoryRollback(t, PGStockRepository{db: openTestPG(t)})
+}
+
+func TestPGDailyBarRepositoryUpsertShouldMergeBarsOfTheSameDay(t *testing.T) {
+	testDailyBarRepository(t, PGDailyBarRepository{db: openTestPG(t)})
+}
+
+func TestPGDailyBarRepositoryExtremesShouldAggregateAdjustedBarsBeforeTheGivenDay(t *testing.T) {
+	db := openTestPG(t)
+	testDailyBarRepositoryExtremes(t, PGDailyBarRepository{db: db}, PGCorporateActionRepository{db: db})
+}
+
+func TestPGDailyBarRepositoryAdjustedDailyShouldApplyTheFactorsOfLaterActions(t *testing.T) {
+	db := openTestPG(t)
+	testDailyBarRepositoryAdjusted(t, PGDailyBarRepository{db: db}, PGCorporateActionRepository{db: db})
+}
+
+func TestPGCorporateActionRepositoryUpsertShouldReplaceTheSameAction(t *testing.T) {
+	testCorporateActionRepository(t, PGCorporateActionRepository{db: openTestPG(t)})
+}
+
+func TestPGSectorPerformanceRepositoryUpsertShouldReplaceTheSameDayLevelAndId(t *testing.T) {
+	testSectorPerformanceRepository(t, PGSectorPerformanceRepository{db: openTestPG(t)})
+}
+
+func TestPGMarketBreadthRepositoryShouldUpsertAndQueryByDay(t *testing.T) {
+	testMarketBreadthRepository(t, PGMarketBreadthRepository{db: openTestPG(t)})
+}
+
+func TestPGIndicatorRepositoryBeforeShouldReturnLatestIndicatorsPerCode(t *testing.T) {
+	testIndicatorRepository(t, PGIndicatorRepository{db: openTestPG(t)})
+}
+
+func TestPGEventRepositoryGetShouldFilterByCodeAndDate(t *testing.T) {
+	testEventRepository(t, PGEventRepository{db: openTestPG(t)})
+}
+
+func TestPGAlertRepositoryShouldAddListUpdateAndDeleteRules(t *testing.T) {
+	testAlertRepository(t, PGAlertRepository{db: openTestPG(t)})
+}
+
+func TestPGWatchlistRepositoryShouldSaveGetListAndDelete(t *testing.T) {
+	testWatchlistRepository(t, PGWatchlistRepository{db: openTestPG(t)})
+}
+
+func TestPGTradeRepositoryShouldAddListAndDeleteTrades(t *testing.T) {
+	testTradeRepository(t, PGTradeRepository{db: openTestPG(t)})
+}
+
+func TestPGPortfolioSnapshotRepositoryBeforeShouldReturnTheLatestEarlierSnapshot(t *testing.T) {
+	testPortfolioSnapshotRepository(t, PGPortfolioSnapshotRepository{db: openTestPG(t)})
+}
+
+func TestPGCustomIndexRepositoryShouldSaveAndListIndices(t *testing.T) {
+	testCustomIndexRepository(t, PGCustomIndexRepository{db: openTestPG(t)})
+}
+
+func TestPGIndexValueRepositoryBeforeShouldReturnTheLatestValueOfEveryIndex(t *testing.T) {
+	testIndexValueRepository(t, PGIndexValueRepository{db: openTestPG(t)})
+}
+
+func TestPGStockRatiosRepositoryShouldKeepTheLatestRatiosOfEveryCode(t *testing.T) {
+	testStockRatiosRepository(t, PGStockRatiosRepository{db: openTestPG(t)})
+}
+
+func TestPGScreenRepositoryShouldSaveReplaceAndDeleteScreens(t *testing.T) {
+	testScreenRepository(t, PGScreenRepository{db: openTestPG(t)})
+}
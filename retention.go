@@ -0,0 +1,76 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	resolutionDay  = "day"
+	resolutionHour = "hour"
+)
+
+// Downsample keeps only the latest snapshot per code per day, or per hour, of stocks
+// updated more than RETENTION_DAYS ago. Snapshots carry the running daily values,
+// so the latest one of a period summarizes it. It is meant to be scheduled like Ingest.
+func Downsample(ctx context.Context, m PubSubMessage) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Retention.Days <= 0 {
+		return fmt.Errorf("retention days must be positive, got %d", cfg.Retention.Days)
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	before := time.Now().UTC().AddDate(0, 0, -cfg.Retention.Days)
+	deleted, err := downsampleStocks(before, cfg.Retention.Resolution, store.retention, store.lastUpdates)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Downsampled stocks before %s per %s, deleted: %d", before.Format(dbTimeLayout), cfg.Retention.Resolution, deleted)
+	return nil
+}
+
+func downsampleStocks(before time.Time, resolution string, repo StockRetentionRepository, mv StockLastUpdateRepository) (int, error) {
+	if resolution != resolutionDay && resolution != resolutionHour {
+		return 0, fmt.Errorf("unknown resolution %q", resolution)
+	}
+
+	lastUpdates, err := mv.Get()
+	if err != nil {
+		return 0, err
+	}
+
+	// The check runs before the deletion is committed, so a mismatch deletes nothing.
+	return repo.Downsample(before, resolution, func(refreshed []StockLastUpdate) error {
+		return compareLastUpdates(lastUpdates, refreshed)
+	})
+}
+
+func compareLastUpdates(expected, actual []StockLastUpdate) error {
+	if len(expected) != len(actual) {
+		return fmt.Errorf("number of last updates changed from %d to %d", len(expected), len(actual))
+	}
+
+	lastUpdateMap := make(map[string]string, len(expected))
+	for _, u := range expected {
+		lastUpdateMap[u.Code] = u.LastUpdate
+	}
+
+	for _, u := range actual {
+		if lastUpdateMap[u.Code] != u.LastUpdate {
+			return fmt.Errorf("last update of %s changed from %q to %q", u.Code, lastUpdateMap[u.Code], u.LastUpdate)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package ingest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var intraday = []Stock{
+	{Code: "A", LastUpdate: "2020-02-03T09:00:00", Last: 100},
+	{Code: "A", LastUpdate: "2020-02-03T09:30:00", Last: 101},
+	{Code: "A", LastUpdate: "2020-02-03T10:00:00", Last: 102},
+	{Code: "A", LastUpdate: "2020-02-04T09:00:00", Last: 103},
+	{Code: "B", LastUpdate: "2020-02-03T09:00:00", Last: 50},
+}
+
+func testStockRetentionRepository(t *testing.T, repo interface {
+	StockRepository
+	StockHistoryRepository
+	StockRetentionRepository
+}, resolution string, deleted int, expected []Stock) {
+	if _, err := repo.Insert(intraday); err != nil {
+		t.Fatal(err)
+	}
+
+	var updates []StockLastUpdate
+	actual, err := repo.Downsample(date("2020-02-04"), resolution, func(refreshed []StockLastUpdate) error {
+		updates = refreshed
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != deleted {
+		t.Errorf("Expect %d deleted, got %d", deleted, actual)
+	}
+
+	history, err := repo.History("A", date("2020-02-01"), date("2020-02-05"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lasts := codesAndLasts(history); !reflect.DeepEqual(lasts, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, lasts)
+	}
+	if len(updates) != 2 || updates[0].Code != "A" || updates[1].Code != "B" {
+		t.Errorf("Expect the refreshed last updates of A and B, got %+v", updates)
+	}
+}
+
+func testStockRetentionRepositoryRollback(t *testing.T, repo interface {
+	StockRepository
+	StockHistoryRepository
+	StockRetentionRepository
+}) {
+	if _, err := repo.Insert(intraday); err != nil {
+		t.Fatal(err)
+	}
+
+	mismatch := errors.New("mismatch")
+	deleted, err := repo.Downsample(date("2020-02-04"), resolutionDay, func([]StockLastUpdate) error { return mismatch })
+	if err != mismatch || deleted != 0 {
+		t.Errorf("Expect 0 deleted and the verify error, got %d, %v", deleted, err)
+	}
+
+	history, err := repo.History("A", date("2020-02-01"), date("2020-02-05"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 4 {
+		t.Errorf("Expect all 4 snapshots of A to be kept, got %d", len(history))
+	}
+}
+
+func TestMemStockRepositoryDownsamplePerDayShouldKeepLatestSnapshotOfTheDay(t *testing.T) {
+	expected := []Stock{{Code: "A", Last: 102}, {Code: "A", Last: 103}}
+	testStockRetentionRepository(t, &MemStockRepository{}, resolutionDay, 2, expected)
+}
+
+func TestMemStockRepositoryDownsamplePerHourShouldKeepLatestSnapshotOfTheHour(t *testing.T) {
+	expected := []Stock{{Code: "A", Last: 101}, {Code: "A", Last: 102}, {Code: "A", Last: 103}}
+	testStockRetentionRepository(t, &MemStockRepository{}, resolutionHour, 1, expected)
+}
+
+func TestMemStockRepositoryDownsampleGivenFailedVerifyShouldKeepAllSnapshots(t *testing.T) {
+	testStockRetentionRepositoryRollback(t, &MemStockRepository{})
+}
+
+func TestDownsampleStocksShouldKeepLastUpdatesConsistent(t *testing.T) {
+	stocks := &MemStockRepository{}
+	mv := &MemStockLastUpdateRepository{stocks: stocks}
+	stocks.Insert(intraday)
+	mv.Refresh()
+
+	deleted, err := downsampleStocks(date("2020-02-05"), resolutionDay, stocks, mv)
+
+	if err != nil {
+		t.Error("Expect error to be nil, got", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expect 2 deleted, got %d", deleted)
+	}
+}
+
+func TestDownsampleStocksGivenChangedLastUpdatesShouldDeleteNothing(t *testing.T) {
+	stocks := &MemStockRepository{}
+	mv := &MemStockLastUpdateRepository{stocks: stocks}
+	stocks.Insert(intraday[:4])
+	mv.Refresh()
+	// B was inserted after the last refresh, so the refreshed last updates differ
+	stocks.Insert(intraday[4:])
+
+	deleted, err := downsampleStocks(date("2020-02-05"), resolutionDay, stocks, mv)
+
+	if err == nil || deleted != 0 {
+		t.Errorf("Expect 0 deleted and an error, got %d, %v", deleted, err)
+	}
+	if len(stocks.stocks) != len(intraday) {
+		t.Errorf("Expect all %d snapshots to be kept, got %d", len(intraday), len(stocks.stocks))
+	}
+}
+
+func TestDownsampleStocksGivenUnknownResolutionShouldReturnError(t *testing.T) {
+	stocks := &MemStockRepository{}
+	mv := &MemStockLastUpdateRepository{stocks: stocks}
+
+	_, err := downsampleStocks(date("2020-02-05"), "minute", stocks, mv)
+
+	if err == nil {
+		t.Error("Expect error not to be nil")
+	}
+}
+
+func TestCompareLastUpdatesGivenChangedLastUpdateShouldReturnError(t *testing.T) {
+	expected := []StockLastUpdate{{Code: "A", LastUpdate: "2020-02-03 10:00:00"}}
+	actual := []StockLastUpdate{{Code: "A", LastUpdate: "2020-02-03 09:00:00"}}
+
+	err := compareLastUpdates(expected, actual)
+
+	if err == nil {
+		t.Error("Expect error not to be nil")
+	}
+}
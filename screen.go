@@ -0,0 +1,532 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// screenMaxRows is the most matches a screen lists, the bot having to send them all.
+const screenMaxRows = 50
+
+// screenMaxLength and screenMaxDepth bound the expressions parsed, which may come from anyone over http,
+// in bytes and in nested parentheses and negations.
+const (
+	screenMaxLength = 1000
+	screenMaxDepth  = 20
+)
+
+// Screen is a named filter expression over the metrics and text fields of stocks,
+// e.g. `sector == "FINANCE" && per < 10 && one_day > 0.02 && value > 1e9`.
+type Screen struct {
+	Name       string `pg:",pk"`
+	Expression string
+}
+
+// screenFields are the text fields of stocks that screens can compare, besides the metrics.
+var screenFields = map[string]func(Stock) string{
+	"code":       func(s Stock) string { return s.Code },
+	"name":       func(s Stock) string { return s.Name },
+	"sector":     func(s Stock) string { return s.SectorName },
+	"sub_sector": func(s Stock) string { return s.SubSectorName },
+}
+
+// screenOps are the comparisons of screen expressions. Text is only compared with == and !=.
+var screenOps = map[string]func(a, b float64) bool{
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+}
+
+// screenSymbols are the operators and parentheses of screen expressions, longest first.
+var screenSymbols = []string{"&&", "||", "==", "!=", ">=", "<=", ">", "<", "!", "(", ")", "-"}
+
+const (
+	tokenEnd = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenSymbol
+)
+
+type screenToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// screenFilter is a parsed screen expression, with the metrics it uses in order of appearance.
+type screenFilter struct {
+	match   func(Stock) bool
+	metrics []string
+}
+
+// screenOperand is either a number or a text, of a stock or constant. A number is not available
+// while its indicator is warming up.
+type screenOperand struct {
+	number func(Stock) (float64, bool)
+	text   func(Stock) string
+}
+
+// lexScreen splits a screen expression into tokens, ending with a tokenEnd.
+// Strings are quoted with double or single quotes.
+func lexScreen(expr string) ([]screenToken, error) {
+	var tokens []screenToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case isLetter(c):
+			j := i + 1
+			for j < len(expr) && (isLetter(expr[j]) || isDigit(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, screenToken{tokenIdent, expr[i:j], i})
+			i = j
+		case isDigit(c) || c == '.':
+			j := i + 1
+			for j < len(expr) && (isDigit(expr[j]) || strings.IndexByte(".eE", expr[j]) >= 0 ||
+				strings.IndexByte("+-", expr[j]) >= 0 && strings.IndexByte("eE", expr[j-1]) >= 0) {
+				j++
+			}
+			tokens = append(tokens, screenToken{tokenNumber, expr[i:j], i})
+			i = j
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, screenToken{tokenString, expr[i+1 : i+1+end], i})
+			i += end + 2
+		default:
+			var symbol string
+			for _, sym := range screenSymbols {
+				if strings.HasPrefix(expr[i:], sym) {
+					symbol = sym
+					break
+				}
+			}
+			if len(symbol) == 0 {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, screenToken{tokenSymbol, symbol, i})
+			i += len(symbol)
+		}
+	}
+
+	return append(tokens, screenToken{kind: tokenEnd, pos: len(expr)}), nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// parseScreen parses a screen expression of comparisons of metrics, text fields, numbers and strings,
+// combined with &&, || and !, and grouped with parentheses. && binds tighter than ||.
+// Comparisons of unavailable indicators are false.
+func parseScreen(expr string) (*screenFilter, error) {
+	if len(expr) > screenMaxLength {
+		return nil, fmt.Errorf("screen expression longer than %d bytes", screenMaxLength)
+	}
+
+	tokens, err := lexScreen(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &screenParser{tokens: tokens}
+	match, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, p.unexpected(t)
+	}
+	return &screenFilter{match: match, metrics: p.metrics}, nil
+}
+
+type screenParser struct {
+	tokens  []screenToken
+	pos     int
+	depth   int
+	metrics []string
+}
+
+func (p *screenParser) peek() screenToken {
+	return p.tokens[p.pos]
+}
+
+func (p *screenParser) next() screenToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given symbol.
+func (p *screenParser) accept(symbol string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.text == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *screenParser) unexpected(t screenToken) error {
+	if t.kind == tokenEnd {
+		return errors.New("unexpected end of screen expression")
+	}
+	return fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *screenParser) or() (func(Stock) bool, error) {
+	left, err := p.and()
+	for err == nil && p.accept("||") {
+		var right func(Stock) bool
+		if right, err = p.and(); err == nil {
+			l := left
+			left = func(s Stock) bool { return l(s) || right(s) }
+		}
+	}
+	return left, err
+}
+
+func (p *screenParser) and() (func(Stock) bool, error) {
+	left, err := p.unary()
+	for err == nil && p.accept("&&") {
+		var right func(Stock) bool
+		if right, err = p.unary(); err == nil {
+			l := left
+			left = func(s Stock) bool { return l(s) && right(s) }
+		}
+	}
+	return left, err
+}
+
+func (p *screenParser) unary() (func(Stock) bool, error) {
+	if t := p.peek(); t.kind == tokenSymbol && (t.text == "!" || t.text == "(") {
+		if p.depth++; p.depth > screenMaxDepth {
+			return nil, fmt.Errorf("screen expression nested deeper than %d at %d", screenMaxDepth, t.pos)
+		}
+		defer func() { p.depth-- }()
+	}
+
+	if p.accept("!") {
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(s Stock) bool { return !inner(s) }, nil
+	}
+
+	if p.accept("(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.unexpected(p.peek())
+		}
+		return inner, nil
+	}
+
+	return p.comparison()
+}
+
+func (p *screenParser) comparison() (func(Stock) bool, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.next()
+	op, isOp := screenOps[t.text]
+	if t.kind != tokenSymbol || !isOp {
+		return nil, fmt.Errorf("%w, expect a comparison", p.unexpected(t))
+	}
+
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	if left.text != nil && right.text != nil {
+		if t.text != "==" && t.text != "!=" {
+			return nil, fmt.Errorf("text can only be compared with == or !=, got %q at %d", t.text, t.pos)
+		}
+		equal := t.text == "=="
+		return func(s Stock) bool { return strings.EqualFold(left.text(s), right.text(s)) == equal }, nil
+	}
+	if left.text != nil || right.text != nil {
+		return nil, fmt.Errorf("cannot compare text with a number at %d", t.pos)
+	}
+
+	return func(s Stock) bool {
+		a, okA := left.number(s)
+		b, okB := right.number(s)
+		return okA && okB && op(a, b)
+	}, nil
+}
+
+func (p *screenParser) operand() (screenOperand, error) {
+	t := p.next()
+	negative := t.kind == tokenSymbol && t.text == "-"
+	if negative {
+		t = p.next()
+	}
+
+	switch {
+	case t.kind == tokenNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return screenOperand{}, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		if negative {
+			v = -v
+		}
+		return screenOperand{number: func(Stock) (float64, bool) { return v, true }}, nil
+	case negative:
+		return screenOperand{}, fmt.Errorf("%w, expect a number", p.unexpected(t))
+	case t.kind == tokenString:
+		return screenOperand{text: func(Stock) string { return t.text }}, nil
+	case t.kind == tokenIdent:
+		name := strings.ToLower(t.text)
+		if metric, exist := metrics[name]; exist {
+			p.metrics = append(p.metrics, name)
+			return screenOperand{number: func(s Stock) (float64, bool) { return metric(s), hasMetric(s, name) }}, nil
+		}
+		if field, exist := screenFields[name]; exist {
+			return screenOperand{text: field}, nil
+		}
+		return screenOperand{}, fmt.Errorf("unknown field %q at %d, expect code, name, sector, sub_sector or one of %s", t.text, t.pos, metricNames())
+	}
+
+	return screenOperand{}, p.unexpected(t)
+}
+
+// apply returns the stocks that match the screen, by value, highest first, then by code.
+func (f *screenFilter) apply(stocks []Stock) []Stock {
+	var res []Stock
+	for _, s := range stocks {
+		if f.match(s) {
+			res = append(res, s)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Value != res[j].Value {
+			return res[i].Value > res[j].Value
+		}
+		return res[i].Code < res[j].Code
+	})
+	return res
+}
+
+// column returns the first metric of the screen that the stock table does not show, if any.
+func (f *screenFilter) column() string {
+	for _, m := range f.metrics {
+		if m != "last" && m != "one_day" && m != "value" {
+			return m
+		}
+	}
+	return ""
+}
+
+// latestStocks returns the latest snapshot of every code, with its ratios and latest indicators.
+func latestStocks(store *storage) ([]Stock, error) {
+	stocks, err := store.history.Latest()
+	if err != nil {
+		return nil, err
+	}
+
+	ratios, err := store.ratios.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := store.indicators.Before(tradingDay(time.Now()).AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	return withIndicators(withRatios(stocks, ratios), values), nil
+}
+
+func init() {
+	commands["screens"] = command{"screens: list the saved screens", listScreens}
+	commands["screen"] = command{"screen NAME: list the stocks matching a saved screen", runScreen}
+	commands["screen-expr"] = command{"screen-expr EXPRESSION: list the stocks matching an expression, e.g. per < 10 && value > 1e9", runScreenExpression}
+	commands["screen-add"] = command{"screen-add NAME EXPRESSION: save a screen, replacing the one of the same name", addScreen}
+	commands["screen-delete"] = command{"screen-delete NAME: delete a saved screen", deleteScreen}
+}
+
+func listScreens(w io.Writer, store *storage, _ []string) error {
+	screens, err := store.screens.List()
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"Name", "Expression"}}
+	for _, sc := range screens {
+		rows = append(rows, []string{sc.Name, sc.Expression})
+	}
+	_, err = fmt.Fprintln(w, alignColumns(rows, []bool{false, false}))
+	return err
+}
+
+func runScreen(w io.Writer, store *storage, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: screen NAME")
+	}
+
+	sc, err := store.screens.Get(args[0])
+	if err != nil {
+		return err
+	}
+	if sc == nil {
+		return fmt.Errorf("screen %q not found", args[0])
+	}
+	return printScreen(w, store, sc.Expression)
+}
+
+func runScreenExpression(w io.Writer, store *storage, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: screen-expr EXPRESSION")
+	}
+	return printScreen(w, store, strings.Join(args, " "))
+}
+
+// printScreen writes how many of the latest stocks match the expression, and the first matches.
+func printScreen(w io.Writer, store *storage, expr string) error {
+	filter, err := parseScreen(expr)
+	if err != nil {
+		return err
+	}
+
+	stocks, err := latestStocks(store)
+	if err != nil {
+		return err
+	}
+	matches := filter.apply(stocks)
+
+	out := fmt.Sprintf("%d of %d stocks match %s\n", len(matches), len(stocks), expr)
+	if len(matches) > 0 {
+		shown := matches
+		if len(shown) > screenMaxRows {
+			shown = shown[:screenMaxRows]
+		}
+		out += formatStockTable(shown, filter.column()) + "\n"
+		if more := len(matches) - len(shown); more > 0 {
+			out += fmt.Sprintf("and %d more\n", more)
+		}
+	}
+	_, err = io.WriteString(w, out)
+	return err
+}
+
+func addScreen(w io.Writer, store *storage, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: screen-add NAME EXPRESSION")
+	}
+
+	sc := Screen{Name: args[0], Expression: strings.Join(args[1:], " ")}
+	if _, err := parseScreen(sc.Expression); err != nil {
+		return err
+	}
+	if err := store.screens.Save(sc); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s: %s\n", sc.Name, sc.Expression)
+	return err
+}
+
+func deleteScreen(w io.Writer, store *storage, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: screen-delete NAME")
+	}
+
+	sc, err := store.screens.Get(args[0])
+	if err != nil {
+		return err
+	}
+	if sc == nil {
+		return fmt.Errorf("screen %q not found", args[0])
+	}
+	if err = store.screens.Delete(args[0]); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Deleted %s\n", args[0])
+	return err
+}
+
+// ScreenStocks is the http function that runs a screen, the saved one of the "name" query parameter
+// or else the expression of "q", and responds with the matching stocks as json, in the shape of the stock api.
+func ScreenStocks(w http.ResponseWriter, r *http.Request) {
+	name, expr := r.URL.Query().Get("name"), r.URL.Query().Get("q")
+	if len(name) == 0 && len(expr) == 0 {
+		http.Error(w, "expect a name or q query parameter", http.StatusBadRequest)
+		return
+	}
+
+	var matches []Stock
+	var badRequest error
+	err := withStorage(func(store *storage) error {
+		// only a name runs a saved screen, q being an expression even if it is a name
+		if len(name) > 0 {
+			sc, err := store.screens.Get(name)
+			if err != nil {
+				return err
+			}
+			if sc == nil {
+				badRequest = fmt.Errorf("screen %q not found", name)
+				return nil
+			}
+			expr = sc.Expression
+		}
+		filter, err := parseScreen(expr)
+		if err != nil {
+			badRequest = err
+			return nil
+		}
+
+		stocks, err := latestStocks(store)
+		if err != nil {
+			return err
+		}
+		matches = filter.apply(stocks)
+		return nil
+	})
+	if err != nil {
+		log.Print(err)
+		http.Error(w, "screen failed", http.StatusInternalServerError)
+		return
+	}
+	if badRequest != nil {
+		http.Error(w, badRequest.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if matches == nil {
+		matches = []Stock{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(matches); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,161 @@
+package ingest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chrishadi/instock/indicators"
+)
+
+var screenStocks = []Stock{
+	{Code: "BBCA", SectorName: "FINANCE", Last: 9000, OneDay: 0.03, Value: 2e12, Per: 25},
+	{Code: "BBRI", SectorName: "FINANCE", Last: 4500, OneDay: 0.025, Value: 1.5e12, Per: 9},
+	{Code: "BMRI", SectorName: "Finance", Last: 6000, OneDay: -0.01, Value: 1e12, Per: 8},
+	{Code: "TLKM", SectorName: "INFRASTRUCTURE", Last: 3500, OneDay: 0.05, Value: 5e11, Per: 12},
+	{Code: "SMOL", SectorName: "FINANCE", Last: 50, OneDay: 0.04, Value: 1e8, Per: 5},
+}
+
+func TestParseScreenShouldEvaluateExpressions(t *testing.T) {
+	tests := map[string][]string{
+		`sector == "FINANCE" && per < 10 && one_day > 0.02 && value > 1e9`: {"BBRI"},
+		`sector == 'finance' && per < 10`:                                  {"BBRI", "BMRI", "SMOL"},
+		`one_day > 0.04 || code == "BMRI"`:                                 {"BMRI", "TLKM"},
+		`!(sector != "FINANCE") && (per >= 25 || one_day <= -0.01)`:        {"BBCA", "BMRI"},
+		`sector == "FINANCE" && per < 10 || one_day > 0.04`:                {"BBRI", "BMRI", "TLKM", "SMOL"},
+		`one_day < -0.005 && last>=6e3`:                                    {"BMRI"},
+		`per > last`:                                                       {},
+	}
+
+	for expr, expected := range tests {
+		filter, err := parseScreen(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+
+		if actual := extractCodes(filter.apply(screenStocks)); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: expect %v, got %v", expr, expected, actual)
+		}
+	}
+}
+
+func TestParseScreenGivenInvalidExpressionShouldReturnError(t *testing.T) {
+	tests := map[string]string{
+		`per < `:               "unexpected end of screen expression",
+		`per 10`:               `unexpected "10" at 4, expect a comparison`,
+		`sector > "FINANCE"`:   `text can only be compared with == or !=, got ">" at 7`,
+		`sector == 1`:          "cannot compare text with a number at 7",
+		`eps < 1`:              `unknown field "eps" at 0`,
+		`(per < 10`:            "unexpected end of screen expression",
+		`per < 10 per`:         `unexpected "per" at 9`,
+		`code == "BBCA`:        "unterminated string at 8",
+		`per < 10 & value > 0`: `unexpected '&' at 9`,
+		`per < 1.2.3`:          `invalid number "1.2.3" at 6`,
+		`per < -value`:         `unexpected "value" at 7, expect a number`,
+		strings.Repeat("(", 21) + "per < 10" + strings.Repeat(")", 21): "screen expression nested deeper than 20 at 20",
+		strings.Repeat("!", 21) + "(per < 10)":                         "screen expression nested deeper than 20 at 20",
+		"per < 10" + strings.Repeat(" || per < 10", 90):                "screen expression longer than 1000 bytes",
+	}
+
+	for expr, expected := range tests {
+		if _, err := parseScreen(expr); err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("%s: expect error %q, got %v", expr, expected, err)
+		}
+	}
+}
+
+func TestScreenGivenUnavailableIndicatorShouldNotMatch(t *testing.T) {
+	stocks := []Stock{
+		{Code: "A", Indicators: indicators.Values{Bars: 20, Rsi14: 25}},
+		{Code: "B", Indicators: indicators.Values{Bars: 5, Rsi14: 0}},
+	}
+
+	filter, err := parseScreen("rsi14 < 30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := extractCodes(filter.apply(stocks)); !reflect.DeepEqual(actual, []string{"A"}) {
+		t.Errorf("Expect [A], got %v", actual)
+	}
+	if filter.column() != "rsi14" {
+		t.Errorf("Expect the rsi14 column, got %q", filter.column())
+	}
+}
+
+// seedScreenStocks stores two stocks of a day and their ratios.
+func seedScreenStocks(store *storage) {
+	store.stocks.Insert([]Stock{
+		{Code: "A", Name: "Alpha", SectorName: "FINANCE", Last: 100, OneDay: 0.05, Value: 2e9, LastUpdate: "2020-02-03T16:00:00"},
+		{Code: "B", Name: "Beta", SectorName: "FINANCE", Last: 200, OneDay: 0.01, Value: 3e9, LastUpdate: "2020-02-03T16:00:00"},
+	})
+	store.ratios.Upsert([]StockRatios{{Code: "A", Per: 8}, {Code: "B", Per: 20}})
+}
+
+func TestScreenCommandsShouldRunSavedScreensAgainstTheLatestStocks(t *testing.T) {
+	store := memStorage()
+	seedScreenStocks(store)
+
+	if out := commandOutput(store, "screen-add", "cheap", "per", "<", "10", "&&"); out != "unexpected end of screen expression" {
+		t.Errorf("Expect an invalid screen to be rejected, got %q", out)
+	}
+	if out := commandOutput(store, "screen-add", "cheap", `sector == "FINANCE"`, "&&", "per < 10"); out != "cheap: sector == \"FINANCE\" && per < 10\n" {
+		t.Errorf("Expect the screen to be saved, got %q", out)
+	}
+
+	expected := "1 of 2 stocks match sector == \"FINANCE\" && per < 10\n" +
+		"Code Name  Last    Chg Value  per\n" +
+		"A    Alpha  100 +5.00%  2.0B 8.00\n"
+	if out := commandOutput(store, "screen", "cheap"); out != expected {
+		t.Errorf("Expect\n%s\ngot\n%s", expected, out)
+	}
+	if out := commandOutput(store, "screen-expr", "value", ">", "1e9"); !strings.HasPrefix(out, "2 of 2 stocks match value > 1e9\n") {
+		t.Errorf("Expect an expression to be run, got %q", out)
+	}
+	// a name is not an expression, nor the other way round
+	if out := commandOutput(store, "screen-expr", "cheap"); !strings.HasPrefix(out, `unknown field "cheap"`) {
+		t.Errorf("Expect the name to be parsed as an expression, got %q", out)
+	}
+	if out := commandOutput(store, "screen", "value", ">", "1e9"); out != "usage: screen NAME" {
+		t.Errorf("Expect usage, got %q", out)
+	}
+	if out := commandOutput(store, "screen", "nope"); out != `screen "nope" not found` {
+		t.Errorf("Expect not found, got %q", out)
+	}
+	if out := commandOutput(store, "screen-delete", "nope"); out != `screen "nope" not found` {
+		t.Errorf("Expect not found, got %q", out)
+	}
+}
+
+func TestScreenStocksShouldRespondWithTheMatchesAsJson(t *testing.T) {
+	setUpWebhook(t)
+	withStorage(func(store *storage) error {
+		store.stocks.Insert([]Stock{{Code: "A", Last: 100, Value: 2e9, LastUpdate: "2020-02-03T16:00:00"}})
+		store.ratios.Upsert([]StockRatios{{Code: "A", Per: 8}})
+		return store.screens.Save(Screen{Name: "cheap", Expression: "per < 10"})
+	})
+
+	w := httptest.NewRecorder()
+	ScreenStocks(w, httptest.NewRequest(http.MethodGet, "/?name=cheap", nil))
+
+	var matches []Stock
+	if err := json.NewDecoder(w.Body).Decode(&matches); err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Code != "A" || matches[0].Per != 8 {
+		t.Errorf("Expect A with per 8, got %+v", matches)
+	}
+
+	// q is always an expression, even if it is the name of a saved screen
+	for _, query := range []string{"q=per+%3C", "q=cheap", "name=nope"} {
+		w = httptest.NewRecorder()
+		ScreenStocks(w, httptest.NewRequest(http.MethodGet, "/?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expect %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package ingest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	levelSector    = "sector"
+	levelSubSector = "sub_sector"
+)
+
+// SectorPerformance summarizes the stocks of a sector, or sub-sector, on a trading day.
+type SectorPerformance struct {
+	Date           time.Time `pg:",pk,type:date"`
+	Level          string    `pg:",pk"`
+	Id             uint      `pg:",pk,use_zero"`
+	Name           string
+	Count          int     `pg:",use_zero"`
+	Advancers      int     `pg:",use_zero"`
+	Decliners      int     `pg:",use_zero"`
+	Unchanged      int     `pg:",use_zero"`
+	AvgChange      float64 `pg:",use_zero"`
+	WeightedChange float64 `pg:",use_zero"`
+	Value          float64 `pg:",use_zero"`
+}
+
+// currentStocks returns the stocks updated on the latest trading day of the batch,
+// i.e. the market as of now, including those that did not change since the last run.
+func currentStocks(stocks []Stock) ([]Stock, time.Time, error) {
+	var latest time.Time
+	days := make([]time.Time, len(stocks))
+	for i, s := range stocks {
+		t, err := parseLastUpdate(s.LastUpdate)
+		if err != nil {
+			return nil, latest, err
+		}
+		days[i] = tradingDay(t)
+		if days[i].After(latest) {
+			latest = days[i]
+		}
+	}
+
+	res := make([]Stock, 0, len(stocks))
+	for i, s := range stocks {
+		if days[i].Equal(latest) {
+			res = append(res, s)
+		}
+	}
+	return res, latest, nil
+}
+
+// summarizeSectors computes the performance of every sector and sub-sector of stocks,
+// ordered by level, then by value-weighted change, best first.
+func summarizeSectors(stocks []Stock, day time.Time) []SectorPerformance {
+	type key struct {
+		level string
+		id    uint
+	}
+
+	index := make(map[key]int)
+	perfs := make([]SectorPerformance, 0)
+	weighted := make([]float64, 0)
+	add := func(k key, name string, s Stock) {
+		i, exist := index[k]
+		if !exist {
+			i = len(perfs)
+			index[k] = i
+			perfs = append(perfs, SectorPerformance{Date: day, Level: k.level, Id: k.id, Name: name})
+			weighted = append(weighted, 0)
+		}
+
+		p := &perfs[i]
+		p.Count++
+		switch {
+		case s.OneDay > 0:
+			p.Advancers++
+		case s.OneDay < 0:
+			p.Decliners++
+		default:
+			p.Unchanged++
+		}
+		p.AvgChange += s.OneDay
+		p.Value += s.Value
+		weighted[i] += s.OneDay * s.Value
+	}
+
+	for _, s := range stocks {
+		add(key{levelSector, s.SectorId}, s.SectorName, s)
+		add(key{levelSubSector, s.SubSectorId}, s.SubSectorName, s)
+	}
+
+	for i := range perfs {
+		p := &perfs[i]
+		p.AvgChange /= float64(p.Count)
+		if p.Value != 0 {
+			p.WeightedChange = weighted[i] / p.Value
+		}
+	}
+
+	sort.SliceStable(perfs, func(i, j int) bool {
+		if perfs[i].Level != perfs[j].Level {
+			return perfs[i].Level == levelSector
+		}
+		return perfs[i].WeightedChange > perfs[j].WeightedChange
+	})
+	return perfs
+}
+
+func updateSectorPerformances(stocks []Stock, repo SectorPerformanceRepository) ([]SectorPerformance, error) {
+	current, day, err := currentStocks(stocks)
+	if err != nil || len(current) == 0 {
+		return nil, err
+	}
+
+	perfs := summarizeSectors(current, day)
+	return perfs, repo.Upsert(perfs)
+}
+
+// formatSectorTable renders the performances of the given level as aligned columns.
+func formatSectorTable(perfs []SectorPerformance, level string) string {
+	rows := [][]string{{"Sector", "Avg", "W.Avg", "Adv/Dec", "Value"}}
+	for _, p := range perfs {
+		if p.Level != level {
+			continue
+		}
+		rows = append(rows, []string{
+			truncate(p.Name, maxNameLength),
+			formatPercent(p.AvgChange),
+			formatPercent(p.WeightedChange),
+			fmt.Sprintf("%d/%d", p.Advancers, p.Decliners),
+			formatAmount(p.Value),
+		})
+	}
+
+	return alignColumns(rows, []bool{false, true, true, true, true})
+}
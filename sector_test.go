@@ -0,0 +1,81 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+)
+
+var sectorStocks = []Stock{
+	{Code: "A", SectorId: 1, SectorName: "Finance", SubSectorId: 11, SubSectorName: "Bank", OneDay: 0.1, Value: 300, LastUpdate: "2020-02-03T10:00:00"},
+	{Code: "B", SectorId: 1, SectorName: "Finance", SubSectorId: 12, SubSectorName: "Insurance", OneDay: -0.2, Value: 100, LastUpdate: "2020-02-03T10:00:00"},
+	{Code: "C", SectorId: 2, SectorName: "Energy", SubSectorId: 21, SubSectorName: "Coal", OneDay: 0, Value: 100, LastUpdate: "2020-02-03T09:00:00"},
+	{Code: "D", SectorId: 2, SectorName: "Energy", SubSectorId: 21, SubSectorName: "Coal", OneDay: 0.3, Value: 0, LastUpdate: "2020-01-31T16:00:00"},
+}
+
+func TestCurrentStocksShouldKeepStocksOfTheLatestTradingDay(t *testing.T) {
+	current, day, err := currentStocks(sectorStocks)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"A", "B", "C"}; !reflect.DeepEqual(extractCodes(current), expected) {
+		t.Errorf("Expect %v, got %v", expected, extractCodes(current))
+	}
+	if !day.Equal(date("2020-02-03")) {
+		t.Errorf("Expect 2020-02-03, got %v", day)
+	}
+}
+
+func TestSummarizeSectorsShouldComputeStatisticsPerSectorAndSubSector(t *testing.T) {
+	day := date("2020-02-03")
+
+	actual := summarizeSectors(sectorStocks[:3], day)
+
+	expected := []SectorPerformance{
+		{Date: day, Level: levelSector, Id: 1, Name: "Finance", Count: 2, Advancers: 1, Decliners: 1, AvgChange: -0.05, WeightedChange: 0.025, Value: 400},
+		{Date: day, Level: levelSector, Id: 2, Name: "Energy", Count: 1, Unchanged: 1, Value: 100},
+		{Date: day, Level: levelSubSector, Id: 11, Name: "Bank", Count: 1, Advancers: 1, AvgChange: 0.1, WeightedChange: 0.1, Value: 300},
+		{Date: day, Level: levelSubSector, Id: 21, Name: "Coal", Count: 1, Unchanged: 1, Value: 100},
+		{Date: day, Level: levelSubSector, Id: 12, Name: "Insurance", Count: 1, Decliners: 1, AvgChange: -0.2, WeightedChange: -0.2, Value: 100},
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Expect %d performances, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		a, e := actual[i], expected[i]
+		if !almostEqual(a.AvgChange, e.AvgChange) || !almostEqual(a.WeightedChange, e.WeightedChange) {
+			t.Errorf("Expect %+v, got %+v", e, a)
+		}
+		a.AvgChange, a.WeightedChange, e.AvgChange, e.WeightedChange = 0, 0, 0, 0
+		if !reflect.DeepEqual(a, e) {
+			t.Errorf("Expect %+v, got %+v", e, a)
+		}
+	}
+}
+
+func TestUpdateSectorPerformancesShouldStoreThem(t *testing.T) {
+	repo := &MemSectorPerformanceRepository{}
+
+	perfs, err := updateSectorPerformances(sectorStocks, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := repo.Get(date("2020-02-03"), date("2020-02-03"))
+	if len(stored) != len(perfs) || len(stored) != 5 {
+		t.Errorf("Expect 5 performances stored, got %d of %d", len(stored), len(perfs))
+	}
+}
+
+func TestFormatSectorTableShouldRenderTheGivenLevel(t *testing.T) {
+	perfs := summarizeSectors(sectorStocks[:3], date("2020-02-03"))
+
+	expected := "" +
+		"Sector     Avg  W.Avg Adv/Dec Value\n" +
+		"Finance -5.00% +2.50%     1/1   400\n" +
+		"Energy  +0.00% +0.00%     0/0   100"
+
+	if actual := formatSectorTable(perfs, levelSector); actual != expected {
+		t.Errorf("Expect\n%s\ngot\n%s", expected, actual)
+	}
+}
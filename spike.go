@@ -0,0 +1,156 @@
+package ingest
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Spike event types
+const (
+	eventVolumeSpike    = "volume_spike"
+	eventValueSpike     = "value_spike"
+	eventFrequencySpike = "frequency_spike"
+)
+
+// SpikeConfig detects a spike when a stock's volume, value or frequency is at least Multiplier times
+// its average of the Days trading days before. Averages below the minimums are too thin to compare to.
+type SpikeConfig struct {
+	Days         int     `default:"20"`
+	Multiplier   float64 `default:"3"`
+	MinVolume    float64 `split_words:"true"`
+	MinValue     float64 `split_words:"true"`
+	MinFrequency float64 `split_words:"true"`
+}
+
+// spikeMetrics are the activities checked for spikes.
+var spikeMetrics = []struct {
+	eventType string
+	stock     func(Stock) float64
+	bar       func(Bar) float64
+}{
+	{eventVolumeSpike, func(s Stock) float64 { return s.Volume }, func(b Bar) float64 { return b.Volume }},
+	{eventValueSpike, func(s Stock) float64 { return s.Value }, func(b Bar) float64 { return b.Value }},
+	{eventFrequencySpike, func(s Stock) float64 { return s.Frequency }, func(b Bar) float64 { return b.Frequency }},
+}
+
+// minAverage returns the minimum average of the activity of the given spike type.
+func (cfg SpikeConfig) minAverage(eventType string) float64 {
+	switch eventType {
+	case eventVolumeSpike:
+		return cfg.MinVolume
+	case eventValueSpike:
+		return cfg.MinValue
+	default:
+		return cfg.MinFrequency
+	}
+}
+
+// unusualActivity is a stock with spikes, and the multiple of its average per spike type.
+type unusualActivity struct {
+	stock     Stock
+	multiples map[string]float64
+}
+
+// detectSpikes returns the spike events of stocks on day given the daily bars before it, ordered by code
+// then date. Stocks with fewer than cfg.Days bars have no average yet.
+func detectSpikes(stocks []Stock, day time.Time, bars []Bar, cfg SpikeConfig) []Event {
+	history := make(map[string][]Bar)
+	for _, bar := range bars {
+		if bar.Date.Before(day) {
+			history[bar.Code] = append(history[bar.Code], bar)
+		}
+	}
+
+	var events []Event
+	for _, s := range stocks {
+		past := history[s.Code]
+		if cfg.Days <= 0 || len(past) < cfg.Days {
+			continue
+		}
+		past = past[len(past)-cfg.Days:]
+
+		for _, m := range spikeMetrics {
+			var avg float64
+			for _, bar := range past {
+				avg += m.bar(bar) / float64(cfg.Days)
+			}
+			if avg > 0 && avg >= cfg.minAverage(m.eventType) && m.stock(s) >= cfg.Multiplier*avg {
+				events = append(events, Event{s.Code, day, m.eventType, m.stock(s), avg})
+			}
+		}
+	}
+
+	return events
+}
+
+// groupSpikes returns the stocks with spikes, the most unusual first.
+func groupSpikes(stocks []Stock, events []Event) []unusualActivity {
+	index := make(map[string]int)
+	var res []unusualActivity
+	for _, e := range events {
+		i, exist := index[e.Code]
+		if !exist {
+			i = len(res)
+			index[e.Code] = i
+			res = append(res, unusualActivity{multiples: make(map[string]float64)})
+		}
+		res[i].multiples[e.Type] = e.Value / e.Reference
+	}
+	for _, s := range stocks {
+		if i, exist := index[s.Code]; exist {
+			res[i].stock = s
+		}
+	}
+
+	highest := func(a unusualActivity) float64 {
+		var max float64
+		for _, m := range a.multiples {
+			if m > max {
+				max = m
+			}
+		}
+		return max
+	}
+	sort.SliceStable(res, func(i, j int) bool { return highest(res[i]) > highest(res[j]) })
+	return res
+}
+
+// updateSpikeEvents detects the spikes of the stocks of the latest trading day of the batch and stores them as events.
+func updateSpikeEvents(stocks []Stock, cfg SpikeConfig, bars DailyBarRepository, repo EventRepository) ([]unusualActivity, error) {
+	current, day, err := currentStocks(stocks)
+	if err != nil || len(current) == 0 {
+		return nil, err
+	}
+
+	// trading days are 5 a week, plus a margin for holidays
+	history, err := bars.AdjustedBetween(day.AddDate(0, 0, -cfg.Days*7/5-14), day)
+	if err != nil {
+		return nil, err
+	}
+
+	events := detectSpikes(current, day, history, cfg)
+	if err = repo.Upsert(events); err != nil {
+		return nil, err
+	}
+	return groupSpikes(current, events), nil
+}
+
+// formatSpikeTable renders the unusual activities as aligned columns of code, name, last price, change,
+// and the multiple of each spike.
+func formatSpikeTable(activities []unusualActivity) string {
+	rows := [][]string{{"Code", "Name", "Last", "Chg", "Vol x", "Val x", "Freq x"}}
+	for _, a := range activities {
+		row := []string{a.stock.Code, truncate(a.stock.Name, maxNameLength), formatPrice(a.stock.Last), formatPercent(a.stock.OneDay)}
+		for _, m := range spikeMetrics {
+			cell := "-"
+			if m, exist := a.multiples[m.eventType]; exist {
+				cell = fmt.Sprintf("%.1f", m)
+			}
+			row = append(row, cell)
+		}
+		rows = append(rows, row)
+	}
+
+	return alignColumns(rows, []bool{false, false, true, true, true, true, true})
+}
@@ -0,0 +1,80 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// flatBars returns n daily bars of code ending the day before end, with the same activity every day.
+func flatBars(code string, end time.Time, n int, volume, value, frequency float64) []Bar {
+	bars := make([]Bar, n)
+	for i := range bars {
+		bars[i] = Bar{Code: code, Date: end.AddDate(0, 0, i-n), Volume: volume, Value: value, Frequency: frequency}
+	}
+	return bars
+}
+
+func TestDetectSpikesShouldCompareToTheTrailingAverage(t *testing.T) {
+	day := date("2020-02-03")
+	cfg := SpikeConfig{Days: 3, Multiplier: 3, MinValue: 1000}
+	bars := append(flatBars("A", day, 5, 100, 1000, 10), flatBars("B", day, 3, 100, 100, 10)...)
+	bars = append(bars, flatBars("C", day, 2, 1, 1, 1)...)
+	bars[1].Volume = 1000 // too old to count
+	stocks := []Stock{
+		{Code: "A", Volume: 300, Value: 2999, Frequency: 10},
+		{Code: "B", Volume: 299, Value: 1000, Frequency: 30},
+		{Code: "C", Volume: 100, Value: 100, Frequency: 100},
+	}
+
+	actual := detectSpikes(stocks, day, bars, cfg)
+
+	expected := []Event{
+		{"A", day, eventVolumeSpike, 300, 100},
+		{"B", day, eventFrequencySpike, 30, 10},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+}
+
+func TestUpdateSpikeEventsShouldStoreEventsAndGroupThemByStock(t *testing.T) {
+	day := date("2020-02-03")
+	bars := &MemDailyBarRepository{}
+	bars.Upsert(append(flatBars("A", day, 2, 100, 100, 10), flatBars("B", day, 2, 100, 100, 10)...))
+	repo := &MemEventRepository{}
+	stocks := []Stock{
+		{Code: "A", Volume: 300, Value: 100, Frequency: 10, LastUpdate: "2020-02-03T16:00:00"},
+		{Code: "B", Volume: 500, Value: 400, Frequency: 10, LastUpdate: "2020-02-03T16:00:00"},
+	}
+
+	actual, err := updateSpikeEvents(stocks, SpikeConfig{Days: 2, Multiplier: 3}, bars, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []unusualActivity{
+		{stocks[1], map[string]float64{eventVolumeSpike: 5, eventValueSpike: 4}},
+		{stocks[0], map[string]float64{eventVolumeSpike: 3}},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %+v, got %+v", expected, actual)
+	}
+	if stored, _ := repo.Get("", day, day); len(stored) != 3 {
+		t.Errorf("Expect 3 events stored, got %+v", stored)
+	}
+}
+
+func TestFormatSpikeTableShouldShowTheMultipleOfEachSpike(t *testing.T) {
+	activities := []unusualActivity{
+		{Stock{Code: "BBCA", Name: "Bank Central Asia", Last: 9000, OneDay: 0.01}, map[string]float64{eventVolumeSpike: 5, eventValueSpike: 4.25}},
+	}
+
+	actual := formatSpikeTable(activities)
+
+	expected := "Code Name              Last    Chg Vol x Val x Freq x\n" +
+		"BBCA Bank Central Asia 9000 +1.00%   5.0   4.2      -"
+	if actual != expected {
+		t.Errorf("Expect\n%s\ngot\n%s", expected, actual)
+	}
+}
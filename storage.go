@@ -0,0 +1,133 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+const (
+	storagePostgres = "postgres"
+	storageSQLite   = "sqlite"
+)
+
+type storage struct {
+	stocks           StockRepository
+	lastUpdates      StockLastUpdateRepository
+	history          StockHistoryRepository
+	retention        StockRetentionRepository
+	dailyBars        DailyBarRepository
+	corporateActions CorporateActionRepository
+	sectors          SectorPerformanceRepository
+	breadth          MarketBreadthRepository
+	indicators       IndicatorRepository
+	events           EventRepository
+	alerts           AlertRepository
+	watchlists       WatchlistRepository
+	trades           TradeRepository
+	portfolio        PortfolioSnapshotRepository
+	indices          CustomIndexRepository
+	indexValues      IndexValueRepository
+	ratios           StockRatiosRepository
+	screens          ScreenRepository
+	close            func() error
+}
+
+func openStorage(cfg *Config) (*storage, error) {
+	switch cfg.Storage {
+	case "", storagePostgres:
+		return openPGStorage(cfg)
+	case storageSQLite:
+		return openSQLiteStorage(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+}
+
+// withStorage opens the storage configured by the environment, calls f with it and closes it.
+func withStorage(f func(*storage) error) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	return f(store)
+}
+
+func openPGStorage(cfg *Config) (*storage, error) {
+	if len(cfg.PG.Database) == 0 || len(cfg.PG.User) == 0 || len(cfg.PG.Password) == 0 {
+		return nil, errors.New("postgres storage requires PG_DATABASE, PG_USER and PG_PASSWORD")
+	}
+
+	db := pg.Connect(&pg.Options{
+		Network:  cfg.PG.Network,
+		Addr:     cfg.PG.Addr,
+		Database: cfg.PG.Database,
+		User:     cfg.PG.User,
+		Password: cfg.PG.Password,
+	})
+
+	stockRepo := PGStockRepository{db: db}
+	return &storage{
+		stocks:           stockRepo,
+		lastUpdates:      PGStockLastUpdateRepository{db: db},
+		history:          stockRepo,
+		retention:        stockRepo,
+		dailyBars:        PGDailyBarRepository{db: db},
+		corporateActions: PGCorporateActionRepository{db: db},
+		sectors:          PGSectorPerformanceRepository{db: db},
+		breadth:          PGMarketBreadthRepository{db: db},
+		indicators:       PGIndicatorRepository{db: db},
+		events:           PGEventRepository{db: db},
+		alerts:           PGAlertRepository{db: db},
+		watchlists:       PGWatchlistRepository{db: db},
+		trades:           PGTradeRepository{db: db},
+		portfolio:        PGPortfolioSnapshotRepository{db: db},
+		indices:          PGCustomIndexRepository{db: db},
+		indexValues:      PGIndexValueRepository{db: db},
+		ratios:           PGStockRatiosRepository{db: db},
+		screens:          PGScreenRepository{db: db},
+		close:            db.Close,
+	}, nil
+}
+
+func openSQLiteStorage(cfg *Config) (*storage, error) {
+	if len(cfg.SQLite.Path) == 0 {
+		return nil, errors.New("sqlite storage requires SQLITE_PATH")
+	}
+
+	db, err := openSQLite(cfg.SQLite.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	stockRepo := SQLiteStockRepository{db: db}
+	return &storage{
+		stocks:           stockRepo,
+		lastUpdates:      SQLiteStockLastUpdateRepository{db: db},
+		history:          stockRepo,
+		retention:        stockRepo,
+		dailyBars:        SQLiteDailyBarRepository{db: db},
+		corporateActions: SQLiteCorporateActionRepository{db: db},
+		sectors:          SQLiteSectorPerformanceRepository{db: db},
+		breadth:          SQLiteMarketBreadthRepository{db: db},
+		indicators:       SQLiteIndicatorRepository{db: db},
+		events:           SQLiteEventRepository{db: db},
+		alerts:           SQLiteAlertRepository{db: db},
+		watchlists:       SQLiteWatchlistRepository{db: db},
+		trades:           SQLiteTradeRepository{db: db},
+		portfolio:        SQLitePortfolioSnapshotRepository{db: db},
+		indices:          SQLiteCustomIndexRepository{db: db},
+		indexValues:      SQLiteIndexValueRepository{db: db},
+		ratios:           SQLiteStockRatiosRepository{db: db},
+		screens:          SQLiteScreenRepository{db: db},
+		close:            db.Close,
+	}, nil
+}
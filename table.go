@@ -0,0 +1,114 @@
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxNameLength = 20
+
+// ratioMetrics are the metrics formatted as percentages.
+var ratioMetrics = map[string]bool{
+	"one_day": true, "one_week": true, "one_month": true, "three_month": true, "six_month": true,
+	"one_year": true, "mtd": true, "ytd": true, "range": true, "gap": true, "from_open": true, "roe": true,
+}
+
+// formatStockTable renders stocks as aligned columns of code, name, last price, change and value,
+// followed by the given metric when it is none of those.
+func formatStockTable(stocks []Stock, metric string) string {
+	extra := metric != "" && metric != "last" && metric != "one_day" && metric != "value"
+
+	header := []string{"Code", "Name", "Last", "Chg", "Value"}
+	rightAligned := []bool{false, false, true, true, true}
+	if extra {
+		header = append(header, metric)
+		rightAligned = append(rightAligned, true)
+	}
+
+	rows := [][]string{header}
+	for _, s := range stocks {
+		row := []string{s.Code, truncate(s.Name, maxNameLength), formatPrice(s.Last), formatPercent(s.OneDay), formatAmount(s.Value)}
+		if extra {
+			row = append(row, formatMetric(metric, metrics[metric](s)))
+		}
+		rows = append(rows, row)
+	}
+
+	return alignColumns(rows, rightAligned)
+}
+
+// alignColumns pads the cells of rows into columns separated by a space,
+// right aligning the columns flagged in rightAligned, e.g. numbers.
+func alignColumns(rows [][]string, rightAligned []bool) string {
+	widths := make([]int, len(rightAligned))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	lines := make([]string, len(rows))
+	for r, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if rightAligned[i] {
+				cells[i] = pad + cell
+			} else if i < len(row)-1 {
+				cells[i] = cell + pad
+			} else {
+				cells[i] = cell
+			}
+		}
+		lines[r] = strings.Join(cells, " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func formatMetric(metric string, v float64) string {
+	if ratioMetrics[metric] {
+		return formatPercent(v)
+	}
+	if _, isIndicator := indicatorMetrics[metric]; isIndicator || metric == "per" || metric == "pbr" {
+		return fmt.Sprintf("%.2f", v)
+	}
+	return formatAmount(v)
+}
+
+func formatPrice(v float32) string {
+	return fmt.Sprintf("%g", v)
+}
+
+func formatPercent(v float64) string {
+	return fmt.Sprintf("%+.2f%%", v*100)
+}
+
+// formatAmount abbreviates large amounts, e.g. 41137150500 as 41.1B.
+func formatAmount(v float64) string {
+	abs := math.Abs(v)
+	switch {
+	case abs >= 1e12:
+		return fmt.Sprintf("%.1fT", v/1e12)
+	case abs >= 1e9:
+		return fmt.Sprintf("%.1fB", v/1e9)
+	case abs >= 1e6:
+		return fmt.Sprintf("%.1fM", v/1e6)
+	case abs >= 1e3:
+		return fmt.Sprintf("%.1fK", v/1e3)
+	default:
+		return fmt.Sprintf("%.0f", v)
+	}
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
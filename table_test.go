@@ -0,0 +1,41 @@
+package ingest
+
+import "testing"
+
+func TestFormatStockTableShouldAlignColumns(t *testing.T) {
+	stocks := []Stock{
+		{Code: "A", Name: "A Inc", Last: 1295, OneDay: 0.0077821, Value: 41137150500},
+		{Code: "BBCA", Name: "A Bank With A Very Long Name", Last: 50, OneDay: -0.1, Value: 950000},
+	}
+
+	expected := "" +
+		"Code Name                 Last     Chg  Value\n" +
+		"A    A Inc                1295  +0.78%  41.1B\n" +
+		"BBCA A Bank With A Very …   50 -10.00% 950.0K"
+
+	if actual := formatStockTable(stocks, "one_day"); actual != expected {
+		t.Errorf("Expect\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func TestFormatStockTableGivenOtherMetricShouldAddItsColumn(t *testing.T) {
+	stocks := []Stock{{Code: "A", Name: "A Inc", Last: 100, OneDay: 0.01, Value: 1e9, OneWeek: 0.05}}
+
+	expected := "" +
+		"Code Name  Last    Chg Value one_week\n" +
+		"A    A Inc  100 +1.00%  1.0B   +5.00%"
+
+	if actual := formatStockTable(stocks, "one_week"); actual != expected {
+		t.Errorf("Expect\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func TestFormatAmountShouldAbbreviateLargeAmounts(t *testing.T) {
+	tests := map[float64]string{999: "999", 1500: "1.5K", 2.5e6: "2.5M", 41137150500: "41.1B", 8.03e12: "8.0T", -2e9: "-2.0B"}
+
+	for v, expected := range tests {
+		if actual := formatAmount(v); actual != expected {
+			t.Errorf("%g: expect %s, got %s", v, expected, actual)
+		}
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"net/http"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/chrishadi/instock/reader"
 )
@@ -18,10 +20,30 @@ type Bot struct {
 }
 
 type SendMessageParams struct {
-	ChatId int    `json:"chat_id"`
-	Text   string `json:"text"`
+	ChatId    int    `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
 }
 
+// Update is an incoming update, as posted to a webhook. Only messages are of interest.
+type Update struct {
+	UpdateId int      `json:"update_id"`
+	Message  *Message `json:"message"`
+}
+
+type Message struct {
+	MessageId int    `json:"message_id"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+type Chat struct {
+	Id int `json:"id"`
+}
+
+// MaxMessageLength is the longest text the bot api accepts in a message.
+const MaxMessageLength = 4096
+
 func New(host, token string, chatId int) *Bot {
 	if len(token) == 0 {
 		return nil
@@ -31,6 +53,17 @@ func New(host, token string, chatId int) *Bot {
 	return &Bot{_host, token, chatId}
 }
 
+// WithChat returns a copy of the bot that sends messages to another chat.
+func (bot *Bot) WithChat(chatId int) *Bot {
+	if bot == nil {
+		return nil
+	}
+
+	b := *bot
+	b.chatId = chatId
+	return &b
+}
+
 func (bot Bot) apiUrlFor(command string) string {
 	return fmt.Sprintf("%s/bot%s/%s", bot.host, bot.token, command)
 }
@@ -40,8 +73,77 @@ func (bot Bot) SendMessage(text string) error {
 		return errors.New("not sending empty message")
 	}
 
+	for _, chunk := range splitLines(text, MaxMessageLength, func(s string) int { return len(s) }) {
+		if err := bot.send(SendMessageParams{ChatId: bot.chatId, Text: chunk}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendPreformatted sends text in a monospaced block, so that columns stay aligned.
+func (bot Bot) SendPreformatted(text string) error {
+	if len(text) == 0 {
+		return errors.New("not sending empty message")
+	}
+
+	const pre, endPre = "<pre>", "</pre>"
+	escapedLen := func(s string) int { return len(html.EscapeString(s)) }
+	for _, chunk := range splitLines(text, MaxMessageLength-len(pre)-len(endPre), escapedLen) {
+		params := SendMessageParams{
+			ChatId:    bot.chatId,
+			Text:      pre + html.EscapeString(chunk) + endPre,
+			ParseMode: "HTML",
+		}
+		if err := bot.send(params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitLines splits text into chunks whose size, as measured by size, is at most max,
+// at line ends where possible and otherwise between runes. The size of a chunk must be
+// the sum of the sizes of its parts, as with len or the length once escaped.
+func splitLines(text string, max int, size func(string) int) []string {
+	var chunks []string
+	start, n := 0, 0
+	for i := 0; i < len(text); {
+		end := strings.IndexByte(text[i:], '\n') + 1
+		if end == 0 {
+			end = len(text) - i
+		}
+		if m := size(text[i : i+end]); n+m <= max {
+			n += m
+			i += end
+			continue
+		}
+		if n > 0 {
+			chunks = append(chunks, text[start:i])
+			start, n = i, 0
+			continue
+		}
+
+		// the line alone is too long, so it is cut between runes, keeping at least one per chunk
+		for lineEnd := i + end; i < lineEnd; {
+			_, w := utf8.DecodeRuneInString(text[i:])
+			m := size(text[i : i+w])
+			if n > 0 && n+m > max {
+				chunks = append(chunks, text[start:i])
+				start, n = i, 0
+			}
+			n += m
+			i += w
+		}
+	}
+	if start < len(text) {
+		chunks = append(chunks, text[start:])
+	}
+	return chunks
+}
+
+func (bot Bot) send(params SendMessageParams) error {
 	url := bot.apiUrlFor("sendMessage")
-	params := SendMessageParams{bot.chatId, text}
 
 	json, _ := json.Marshal(params)
 	body := bytes.NewBuffer(json)
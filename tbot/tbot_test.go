@@ -1,8 +1,11 @@
 package tbot
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -76,3 +79,108 @@ func TestSendMessageWhenHttpPostOkShouldReturnNil(t *testing.T) {
 		t.Error("Expect error to be nil, got", err)
 	}
 }
+
+func TestSplitLinesShouldCutAtLineEndsWithinMax(t *testing.T) {
+	expected := []string{"ab\ncd\n", "efghij", "\nk"}
+	actual := splitLines("ab\ncd\nefghij\nk", 6, func(s string) int { return len(s) })
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %q, got %q", expected, actual)
+	}
+}
+
+func TestSplitLinesShouldNotCutARune(t *testing.T) {
+	expected := []string{"ab", "…c"}
+	actual := splitLines("ab…c", 4, func(s string) int { return len(s) })
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %q, got %q", expected, actual)
+	}
+}
+
+func TestSendMessageGivenLongTextShouldSendItInChunks(t *testing.T) {
+	sent := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		sent++
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	line := strings.Repeat("x", 99) + "\n"
+	bot := New(ts.URL, token, chatId)
+	err := bot.SendMessage(strings.Repeat(line, 50))
+
+	if err != nil {
+		t.Error("Expect error to be nil, got", err)
+	}
+	if sent != 2 {
+		t.Errorf("Expect 2 messages sent, got %d", sent)
+	}
+}
+
+func TestSendPreformattedShouldSendEscapedHtmlPreBlock(t *testing.T) {
+	var params SendMessageParams
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&params)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	bot := New(ts.URL, token, chatId)
+	err := bot.SendPreformatted("A & B")
+
+	if err != nil {
+		t.Error("Expect error to be nil, got", err)
+	}
+	expected := SendMessageParams{ChatId: chatId, Text: "<pre>A &amp; B</pre>", ParseMode: "HTML"}
+	if params != expected {
+		t.Errorf("Expect %+v, got %+v", expected, params)
+	}
+}
+
+func TestSendPreformattedGivenEscapesInOneLineShouldMeasureEachChunkEscaped(t *testing.T) {
+	var texts []string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var params SendMessageParams
+		json.NewDecoder(r.Body).Decode(&params)
+		texts = append(texts, params.Text)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	// the escapes of the first line must not shrink the chunks of the others
+	line := strings.Repeat("x", 99) + "\n"
+	text := strings.Repeat("&", 500) + "\n" + strings.Repeat(line, 80)
+	bot := New(ts.URL, token, chatId)
+	err := bot.SendPreformatted(text)
+
+	if err != nil {
+		t.Error("Expect error to be nil, got", err)
+	}
+	if len(texts) != 3 {
+		t.Errorf("Expect 3 messages sent, got %d", len(texts))
+	}
+	for _, text := range texts {
+		if len(text) > MaxMessageLength {
+			t.Errorf("Expect at most %d bytes, got %d", MaxMessageLength, len(text))
+		}
+	}
+}
+
+func TestWithChatShouldReturnCopyForAnotherChat(t *testing.T) {
+	bot := New(host, token, chatId)
+
+	other := bot.WithChat(456)
+
+	if other.chatId != 456 || other.token != token || bot.chatId != chatId {
+		t.Errorf("Expect copy for chat 456, got %v from %v", other, bot)
+	}
+}
+
+func TestWithChatGivenNilBotShouldReturnNil(t *testing.T) {
+	var bot *Bot
+
+	if other := bot.WithChat(456); other != nil {
+		t.Error("Expect nil, got", other)
+	}
+}
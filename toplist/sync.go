@@ -0,0 +1,39 @@
+package toplist
+
+import "sync"
+
+// SyncList is a TopList safe for concurrent use.
+type SyncList[T any] struct {
+	mu   sync.Mutex
+	list *TopList[T]
+}
+
+// Sync wraps a configured list for concurrent use. The list must not be used directly afterwards.
+func Sync[T any](tl *TopList[T]) *SyncList[T] {
+	return &SyncList[T]{list: tl}
+}
+
+func (sl *SyncList[T]) Add(v T) bool {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.list.Add(v)
+}
+
+func (sl *SyncList[T]) Len() int {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.list.Len()
+}
+
+func (sl *SyncList[T]) Values() []T {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.list.Values()
+}
+
+// List returns a copy of the current state as a TopList, e.g. to merge it.
+func (sl *SyncList[T]) List() *TopList[T] {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	return sl.list.clone()
+}
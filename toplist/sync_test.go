@@ -0,0 +1,93 @@
+package toplist
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSyncListGivenConcurrentAddsShouldKeepTheTopValues(t *testing.T) {
+	sl := Sync(New(size, func(a, b int) bool { return a > b }))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for v := g; v < 1000; v += 8 {
+				sl.Add(v)
+				sl.Len()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	expected := []int{999, 998, 997, 996, 995}
+	if actual := sl.Values(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+}
+
+func TestMergeShouldCombineListsIntoTheRequestedSize(t *testing.T) {
+	gt := func(a, b int) bool { return a > b }
+	shards := make([]*SyncList[int], 3)
+	for i := range shards {
+		shards[i] = Sync(New(size, gt))
+	}
+
+	// every shard is shared by several goroutines, and snapshotted while they add
+	var wg sync.WaitGroup
+	for g := 0; g < 9; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			shard := shards[g%len(shards)]
+			for v := g; v < 100; v += 9 {
+				shard.Add(v)
+				Merge(4, shard.List())
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	lists := make([]*TopList[int], len(shards))
+	for i, shard := range shards {
+		lists[i] = shard.List()
+	}
+	expected := []int{99, 98, 97, 96}
+	if actual := Merge(4, lists...).Values(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+}
+
+func TestMergeShouldKeepTieOptionsOfTheFirstList(t *testing.T) {
+	a := New(2, moreKey).BreakTiesBy(byName).IncludeTies()
+	a.Add(pair{2, "c"})
+	a.Add(pair{1, "d"})
+	b := New(2, moreKey)
+	b.Add(pair{1, "b"})
+	b.Add(pair{1, "a"})
+
+	expected := []pair{{2, "c"}, {1, "a"}, {1, "b"}, {1, "d"}}
+	if actual := Merge(2, a, b).Values(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+}
+
+func TestMergeGivenNoListShouldReturnNil(t *testing.T) {
+	if Merge[int](size) != nil {
+		t.Error("Expect merged list to be nil")
+	}
+}
+
+func TestSyncListListShouldReturnACopy(t *testing.T) {
+	sl := Sync(New(size, func(a, b int) bool { return a > b }))
+	sl.Add(1)
+
+	snapshot := sl.List()
+	sl.Add(2)
+
+	if snapshot.Len() != 1 {
+		t.Errorf("Expect snapshot length to be 1, got %d", snapshot.Len())
+	}
+}
@@ -1,46 +1,203 @@
 package toplist
 
-import "container/list"
+import (
+	"container/list"
+	"sort"
+)
 
-type TopList struct {
-	list *list.List
-	size int
-	more func(a, b interface{}) bool
+type entry[T any] struct {
+	value T
+	seq   uint64
 }
 
-func New(size int, moreFunc func(a, b interface{}) bool) *TopList {
-	return &TopList{
-		list: list.New(),
+// TopList keeps at most size values, ranked by more, the best first.
+// A value ranks after the values it is not more than, so ties keep insertion order.
+// The values are kept in a heap with the last ranked value at the root,
+// so adding a value takes O(log size).
+type TopList[T any] struct {
+	heap     []entry[T]
+	size     int
+	more     func(a, b T) bool
+	tieBreak func(a, b T) bool
+	seq      uint64
+
+	// ties holds the values tied with the root by more that did not fit, when including ties.
+	includeTies bool
+	ties        []entry[T]
+}
+
+// Legacy is the TopList of interface{} values that the package provided before TopList was generic.
+// Old callers only need to name the type Legacy; New still infers it from their more funcs.
+type Legacy = TopList[interface{}]
+
+func New[T any](size int, moreFunc func(a, b T) bool) *TopList[T] {
+	return &TopList[T]{
+		heap: make([]entry[T], 0, size),
 		size: size,
 		more: moreFunc,
 	}
 }
 
-func (tl *TopList) Add(v interface{}) bool {
-	list := tl.Elements()
-	if list.Len() == tl.size {
-		back := list.Back()
-		if !tl.more(v, back.Value) {
+// NewLegacy returns a Legacy list, for callers that cannot rely on New inferring its type.
+func NewLegacy(size int, moreFunc func(a, b interface{}) bool) *Legacy {
+	return New(size, moreFunc)
+}
+
+// BreakTiesBy ranks values that are not more than each other by tieBreak instead of insertion order.
+func (tl *TopList[T]) BreakTiesBy(tieBreak func(a, b T) bool) *TopList[T] {
+	tl.tieBreak = tieBreak
+	return tl
+}
+
+// IncludeTies makes the list keep, beyond its size, all values tied by more with the last ranked one.
+func (tl *TopList[T]) IncludeTies() *TopList[T] {
+	tl.includeTies = true
+	return tl
+}
+
+// Add inserts v at its rank, dropping the last value when the list is full.
+// It returns false if v does not make it into the list.
+func (tl *TopList[T]) Add(v T) bool {
+	e := entry[T]{v, tl.seq}
+	tl.seq++
+
+	if len(tl.heap) == tl.size {
+		if tl.size == 0 {
+			return false
+		}
+
+		root := tl.heap[0]
+		if !tl.rank(v, root.value) {
+			if tl.includeTies && tl.tied(v, root.value) {
+				tl.ties = append(tl.ties, e)
+				return true
+			}
 			return false
+		}
+
+		tl.heap[0] = e
+		tl.down(0)
+		if tl.includeTies && tl.tied(tl.heap[0].value, root.value) {
+			tl.ties = append(tl.ties, root)
 		} else {
-			list.Remove(back)
+			tl.ties = tl.ties[:0]
 		}
+		return true
 	}
 
-	front := list.Front()
-	if front == nil || tl.more(v, front.Value) {
-		list.PushFront(v)
-	} else {
-		el := list.Back()
-		for tl.more(v, el.Value) {
-			el = el.Prev()
+	tl.heap = append(tl.heap, e)
+	tl.up(len(tl.heap) - 1)
+	return true
+}
+
+func (tl *TopList[T]) Len() int {
+	return len(tl.heap) + len(tl.ties)
+}
+
+// Values returns a copy of the values in rank order.
+func (tl *TopList[T]) Values() []T {
+	entries := make([]entry[T], 0, tl.Len())
+	entries = append(entries, tl.heap...)
+	entries = append(entries, tl.ties...)
+	sort.Slice(entries, func(i, j int) bool {
+		return tl.before(entries[i], entries[j])
+	})
+
+	res := make([]T, len(entries))
+	for i, e := range entries {
+		res[i] = e.value
+	}
+	return res
+}
+
+// Merge combines lists into a new list of the given size, ranked like the first list.
+// Tied values keep the order of the lists, then their order within each list.
+func Merge[T any](size int, lists ...*TopList[T]) *TopList[T] {
+	if len(lists) == 0 {
+		return nil
+	}
+
+	first := lists[0]
+	merged := New(size, first.more)
+	merged.tieBreak = first.tieBreak
+	merged.includeTies = first.includeTies
+	for _, tl := range lists {
+		for _, v := range tl.Values() {
+			merged.Add(v)
 		}
-		list.InsertAfter(v, el)
 	}
 
-	return true
+	return merged
+}
+
+func (tl *TopList[T]) clone() *TopList[T] {
+	c := *tl
+	c.heap = append(make([]entry[T], 0, cap(tl.heap)), tl.heap...)
+	c.ties = append([]entry[T](nil), tl.ties...)
+	return &c
 }
 
-func (tl *TopList) Elements() *list.List {
-	return tl.list
+// rank tells whether a is more than b, breaking ties if a tie break is set.
+func (tl *TopList[T]) rank(a, b T) bool {
+	if tl.more(a, b) {
+		return true
+	}
+	if tl.tieBreak == nil || tl.more(b, a) {
+		return false
+	}
+	return tl.tieBreak(a, b)
+}
+
+func (tl *TopList[T]) tied(a, b T) bool {
+	return !tl.more(a, b) && !tl.more(b, a)
+}
+
+// before tells whether a ranks before b.
+func (tl *TopList[T]) before(a, b entry[T]) bool {
+	if tl.rank(a.value, b.value) {
+		return true
+	}
+	if tl.rank(b.value, a.value) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (tl *TopList[T]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !tl.before(tl.heap[parent], tl.heap[i]) {
+			break
+		}
+		tl.heap[parent], tl.heap[i] = tl.heap[i], tl.heap[parent]
+		i = parent
+	}
+}
+
+func (tl *TopList[T]) down(i int) {
+	n := len(tl.heap)
+	for {
+		last := i
+		if l := 2*i + 1; l < n && tl.before(tl.heap[last], tl.heap[l]) {
+			last = l
+		}
+		if r := 2*i + 2; r < n && tl.before(tl.heap[last], tl.heap[r]) {
+			last = r
+		}
+		if last == i {
+			return
+		}
+		tl.heap[i], tl.heap[last] = tl.heap[last], tl.heap[i]
+		i = last
+	}
+}
+
+// Elements returns the values in rank order as a linked list, as before TopList was generic.
+// Unlike before, the list is built on each call, so changing it does not change the ranking.
+func (tl *TopList[T]) Elements() *list.List {
+	ls := list.New()
+	for _, v := range tl.Values() {
+		ls.PushBack(v)
+	}
+	return ls
 }
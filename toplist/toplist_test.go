@@ -1,6 +1,11 @@
 package toplist
 
 import (
+	"container/list"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
 	"testing"
 )
 
@@ -99,3 +104,246 @@ func TestAddGivenNewValueIsGreaterThanSomeWhenListIsFullShouldRemoveLast(t *test
 		t.Error("Expect 106 at the bottom, got", bottom)
 	}
 }
+
+func TestLegacyShouldRankInterfaceValuesAsBeforeTheListWasGeneric(t *testing.T) {
+	var tl *Legacy = NewLegacy(3, more)
+	for _, v := range []interface{}{2, 4, 1, 3} {
+		tl.Add(v)
+	}
+
+	var ls *list.List = tl.Elements()
+	actual := make([]interface{}, 0, ls.Len())
+	for el := ls.Front(); el != nil; el = el.Next() {
+		actual = append(actual, el.Value)
+	}
+	if expected := []interface{}{4, 3, 2}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+	if inferred := New(size, more); reflect.TypeOf(inferred) != reflect.TypeOf(tl) {
+		t.Errorf("Expect New to return a %T, got %T", tl, inferred)
+	}
+}
+
+func TestListValuesShouldReturnValuesInRankOrder(t *testing.T) {
+	tl := New(size, func(a, b int) bool { return a > b })
+	for _, v := range []int{3, 7, 1, 9, 5, 8, 2} {
+		tl.Add(v)
+	}
+
+	expected := []int{9, 8, 7, 5, 3}
+	actual := tl.Values()
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+}
+
+func TestListAddGivenEqualValuesShouldKeepInsertionOrder(t *testing.T) {
+	type item struct {
+		key  int
+		name string
+	}
+	tl := New(size, func(a, b item) bool { return a.key > b.key })
+	tl.Add(item{1, "a"})
+	tl.Add(item{2, "b"})
+	tl.Add(item{1, "c"})
+
+	expected := []item{{2, "b"}, {1, "a"}, {1, "c"}}
+	actual := tl.Values()
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+}
+
+func TestListAddGivenZeroSizeShouldNotInsert(t *testing.T) {
+	tl := New(0, func(a, b int) bool { return a > b })
+
+	if tl.Add(1) {
+		t.Error("Expect add to fail, but succeed")
+	}
+	if tl.Len() != 0 {
+		t.Error("Expect list length to be 0, got", tl.Len())
+	}
+}
+
+func TestListShouldRankLikeSortingAllValues(t *testing.T) {
+	type item struct {
+		key, id int
+	}
+	rng := rand.New(rand.NewSource(1))
+	items := make([]item, 1000)
+	for i := range items {
+		items[i] = item{rng.Intn(50), i}
+	}
+
+	tl := New(100, func(a, b item) bool { return a.key > b.key })
+	for _, it := range items {
+		tl.Add(it)
+	}
+
+	expected := make([]item, len(items))
+	copy(expected, items)
+	sort.SliceStable(expected, func(i, j int) bool { return expected[i].key > expected[j].key })
+	expected = expected[:100]
+
+	if actual := tl.Values(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+}
+
+// linkedTopList is the former linked list implementation, kept to compare against.
+type linkedTopList struct {
+	list *list.List
+	size int
+	more func(a, b int) bool
+}
+
+func (tl *linkedTopList) Add(v int) bool {
+	if tl.list.Len() == tl.size {
+		back := tl.list.Back()
+		if !tl.more(v, back.Value.(int)) {
+			return false
+		}
+		tl.list.Remove(back)
+	}
+
+	front := tl.list.Front()
+	if front == nil || tl.more(v, front.Value.(int)) {
+		tl.list.PushFront(v)
+	} else {
+		el := tl.list.Back()
+		for tl.more(v, el.Value.(int)) {
+			el = el.Prev()
+		}
+		tl.list.InsertAfter(v, el)
+	}
+	return true
+}
+
+var benchSizes = []int{10, 100, 1000, 10000}
+
+func benchValues(n int) []int {
+	rng := rand.New(rand.NewSource(1))
+	values := make([]int, n)
+	for i := range values {
+		values[i] = rng.Int()
+	}
+	return values
+}
+
+func BenchmarkListAdd(b *testing.B) {
+	values := benchValues(100000)
+	gt := func(a, b int) bool { return a > b }
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tl := New(n, gt)
+				for _, v := range values {
+					tl.Add(v)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLinkedListAdd(b *testing.B) {
+	values := benchValues(100000)
+	gt := func(a, b int) bool { return a > b }
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tl := &linkedTopList{list.New(), n, gt}
+				for _, v := range values {
+					tl.Add(v)
+				}
+			}
+		})
+	}
+}
+
+type pair struct {
+	key  int
+	name string
+}
+
+var moreKey = func(a, b pair) bool { return a.key > b.key }
+
+var byName = func(a, b pair) bool { return a.name < b.name }
+
+func TestBreakTiesByGivenTiedValuesShouldRankByTieBreak(t *testing.T) {
+	tl := New(size, moreKey).BreakTiesBy(byName)
+	tl.Add(pair{1, "c"})
+	tl.Add(pair{2, "z"})
+	tl.Add(pair{1, "a"})
+	tl.Add(pair{1, "b"})
+
+	expected := []pair{{2, "z"}, {1, "a"}, {1, "b"}, {1, "c"}}
+	actual := tl.Values()
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+}
+
+func TestIncludeTiesShouldKeepValuesTiedWithTheLast(t *testing.T) {
+	tl := New(2, moreKey).IncludeTies()
+	tl.Add(pair{3, "a"})
+	tl.Add(pair{1, "b"})
+	tl.Add(pair{1, "c"})
+	tl.Add(pair{0, "d"})
+
+	expected := []pair{{3, "a"}, {1, "b"}, {1, "c"}}
+	actual := tl.Values()
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+}
+
+func TestIncludeTiesGivenValueAboveTheTiesShouldDropThem(t *testing.T) {
+	tl := New(2, moreKey).IncludeTies()
+	tl.Add(pair{3, "a"})
+	tl.Add(pair{1, "b"})
+	tl.Add(pair{1, "c"})
+	tl.Add(pair{2, "d"})
+
+	expected := []pair{{3, "a"}, {2, "d"}}
+	actual := tl.Values()
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+	if tl.Len() != 2 {
+		t.Errorf("Expect list length to be 2, got %d", tl.Len())
+	}
+}
+
+func TestIncludeTiesGivenNewLastTiedWithDroppedShouldKeepIt(t *testing.T) {
+	tl := New(2, moreKey).IncludeTies()
+	tl.Add(pair{1, "a"})
+	tl.Add(pair{1, "b"})
+	tl.Add(pair{2, "c"})
+
+	expected := []pair{{2, "c"}, {1, "a"}, {1, "b"}}
+	actual := tl.Values()
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+}
+
+func TestIncludeTiesWithTieBreakShouldKeepValuesTiedByMore(t *testing.T) {
+	tl := New(2, moreKey).BreakTiesBy(byName).IncludeTies()
+	tl.Add(pair{3, "a"})
+	tl.Add(pair{1, "c"})
+	tl.Add(pair{1, "b"})
+	tl.Add(pair{0, "d"})
+
+	expected := []pair{{3, "a"}, {1, "b"}, {1, "c"}}
+	actual := tl.Values()
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+}
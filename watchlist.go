@@ -0,0 +1,183 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Watchlist is a named basket of codes, reported in its own section of the ingest report,
+// or in a message to ChatId if it is not zero.
+type Watchlist struct {
+	Name   string   `pg:",pk"`
+	Codes  []string `pg:",array"`
+	ChatId int
+}
+
+// watchlistSection is a watchlist with the stocks of its codes, in order.
+type watchlistSection struct {
+	watchlist Watchlist
+	stocks    []Stock
+}
+
+func init() {
+	commands["watchlists"] = command{"watchlists: list the watchlists", listWatchlists}
+	commands["watchlist"] = command{"watchlist NAME: list the codes of a watchlist", showWatchlist}
+	commands["watchlist-add"] = command{"watchlist-add NAME CODE...: add codes to a watchlist, creating it if needed", addToWatchlist}
+	commands["watchlist-remove"] = command{"watchlist-remove NAME CODE...: remove codes from a watchlist", removeFromWatchlist}
+	commands["watchlist-delete"] = command{"watchlist-delete NAME: delete a watchlist", deleteWatchlist}
+	commands["watchlist-chat"] = command{"watchlist-chat NAME CHAT_ID: report a watchlist to another chat, or the default one if 0", setWatchlistChat}
+}
+
+func listWatchlists(w io.Writer, store *storage, _ []string) error {
+	watchlists, err := store.watchlists.List()
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{{"Name", "Codes", "Chat"}}
+	for _, wl := range watchlists {
+		chat := "default"
+		if wl.ChatId != 0 {
+			chat = strconv.Itoa(wl.ChatId)
+		}
+		rows = append(rows, []string{wl.Name, strconv.Itoa(len(wl.Codes)), chat})
+	}
+	_, err = fmt.Fprintln(w, alignColumns(rows, []bool{false, true, false}))
+	return err
+}
+
+func showWatchlist(w io.Writer, store *storage, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: watchlist NAME")
+	}
+
+	wl, err := getWatchlist(store, args[0])
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s: %s\n", wl.Name, strings.Join(wl.Codes, " "))
+	return err
+}
+
+func addToWatchlist(w io.Writer, store *storage, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: watchlist-add NAME CODE...")
+	}
+
+	wl, err := store.watchlists.Get(args[0])
+	if err != nil {
+		return err
+	}
+	if wl == nil {
+		wl = &Watchlist{Name: args[0]}
+	}
+
+	members := toSet(wl.Codes)
+	for _, code := range args[1:] {
+		code = strings.ToUpper(code)
+		if !members[code] {
+			members[code] = true
+			wl.Codes = append(wl.Codes, code)
+		}
+	}
+	return saveWatchlist(w, store, *wl)
+}
+
+func removeFromWatchlist(w io.Writer, store *storage, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: watchlist-remove NAME CODE...")
+	}
+
+	wl, err := getWatchlist(store, args[0])
+	if err != nil {
+		return err
+	}
+
+	removed := make(map[string]bool)
+	for _, code := range args[1:] {
+		removed[strings.ToUpper(code)] = true
+	}
+	codes := make([]string, 0, len(wl.Codes))
+	for _, code := range wl.Codes {
+		if !removed[code] {
+			codes = append(codes, code)
+		}
+	}
+	wl.Codes = codes
+	return saveWatchlist(w, store, *wl)
+}
+
+func deleteWatchlist(w io.Writer, store *storage, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: watchlist-delete NAME")
+	}
+
+	if _, err := getWatchlist(store, args[0]); err != nil {
+		return err
+	}
+	if err := store.watchlists.Delete(args[0]); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Deleted %s\n", args[0])
+	return err
+}
+
+func setWatchlistChat(w io.Writer, store *storage, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: watchlist-chat NAME CHAT_ID")
+	}
+
+	chatId, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid chat id %q", args[1])
+	}
+	wl, err := getWatchlist(store, args[0])
+	if err != nil {
+		return err
+	}
+	wl.ChatId = chatId
+	return saveWatchlist(w, store, *wl)
+}
+
+// getWatchlist returns the watchlist of the given name, or an error if there is none.
+func getWatchlist(store *storage, name string) (*Watchlist, error) {
+	wl, err := store.watchlists.Get(name)
+	if err == nil && wl == nil {
+		err = fmt.Errorf("watchlist %q not found", name)
+	}
+	return wl, err
+}
+
+func saveWatchlist(w io.Writer, store *storage, wl Watchlist) error {
+	if err := store.watchlists.Save(wl); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s: %s\n", wl.Name, strings.Join(wl.Codes, " "))
+	return err
+}
+
+// watchlistSections returns the stocks of every watchlist, skipping codes missing from stocks.
+func watchlistSections(stocks []Stock, watchlists []Watchlist) []watchlistSection {
+	byCode := make(map[string]Stock, len(stocks))
+	for _, s := range stocks {
+		byCode[s.Code] = s
+	}
+
+	sections := make([]watchlistSection, len(watchlists))
+	for i, wl := range watchlists {
+		sections[i].watchlist = wl
+		for _, code := range wl.Codes {
+			if s, exist := byCode[code]; exist {
+				sections[i].stocks = append(sections[i].stocks, s)
+			}
+		}
+	}
+	return sections
+}
+
+func (section watchlistSection) String() string {
+	return "Watchlist " + section.watchlist.Name + ":\n" + formatStockTable(section.stocks, "volume")
+}
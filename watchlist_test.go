@@ -0,0 +1,38 @@
+package ingest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWatchlistCommandsShouldManageWatchlists(t *testing.T) {
+	store := memStorage()
+
+	commandOutput(store, "watchlist-add", "core", "bbca", "BBRI", "BBCA")
+	commandOutput(store, "watchlist-add", "banks", "BMRI")
+	commandOutput(store, "watchlist-chat", "banks", "456")
+	commandOutput(store, "watchlist-remove", "core", "BBRI")
+
+	if out, expected := commandOutput(store, "watchlist", "core"), "core: BBCA\n"; out != expected {
+		t.Errorf("Expect %q, got %q", expected, out)
+	}
+	if out, expected := commandOutput(store, "watchlists"), "Name  Codes Chat\nbanks     1 456\ncore      1 default\n"; out != expected {
+		t.Errorf("Expect %q, got %q", expected, out)
+	}
+
+	commandOutput(store, "watchlist-delete", "core")
+	if out, expected := commandOutput(store, "watchlist", "core"), `watchlist "core" not found`; out != expected {
+		t.Errorf("Expect %q, got %q", expected, out)
+	}
+}
+
+func TestWatchlistSectionsShouldKeepTheOrderOfTheCodes(t *testing.T) {
+	stocks := []Stock{{Code: "A"}, {Code: "B"}, {Code: "C"}}
+	watchlists := []Watchlist{{Name: "w", Codes: []string{"C", "X", "A"}}}
+
+	sections := watchlistSections(stocks, watchlists)
+
+	if codes := extractCodes(sections[0].stocks); !reflect.DeepEqual(codes, []string{"C", "A"}) {
+		t.Errorf("Expect [C A], got %v", codes)
+	}
+}